@@ -0,0 +1,340 @@
+// Package bounce 识别退信并提取失败的收件人、状态码和失败类别，
+// 标准的投递状态通知（RFC 3464）直接使用其字段，其它退信按常见 MTA 模板（英文和中文）的规则识别，规则可以扩展
+package bounce
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// Category 失败类别
+type Category string
+
+const (
+	CategoryHard        Category = "hard"         // 永久失败
+	CategorySoft        Category = "soft"         // 临时失败，通常会重试
+	CategoryMailboxFull Category = "mailbox-full" // 邮箱已满
+	CategorySpamBlocked Category = "spam-blocked" // 被当作垃圾邮件拦截
+	CategoryUnknownUser Category = "unknown-user" // 收件人不存在
+)
+
+// IsPermanent 是否为地址本身永久失效，退订处理可据此删除地址
+func (c Category) IsPermanent() bool {
+	return c == CategoryHard || c == CategoryUnknownUser
+}
+
+// Rule 分类规则，Pattern 匹配失败说明时归为 Category
+type Rule struct {
+	Name     string
+	Category Category
+	Pattern  *regexp.Regexp
+}
+
+// maxDiagnosticLen Recipient.Diagnostic 的最大字符数
+const maxDiagnosticLen = 512
+
+// Recipient 一个失败的收件人
+type Recipient struct {
+	Address    string   // 小写，退信中找不到时为空
+	Status     string   // 增强状态码，如 5.1.1
+	SMTPCode   string   // SMTP 应答码，如 550
+	Action     string   // 投递状态通知的 Action，非标准退信时为空
+	Diagnostic string   // 失败说明，空白已合并
+	Category   Category // 无法判断时为空
+	Rule       string   // 命中的规则名，按状态码或 Action 判断时为空
+}
+
+// Result 识别结果
+type Result struct {
+	IsBounce   bool
+	Standard   bool     // 是否为标准的投递状态通知（RFC 3464）
+	Category   Category // 第一个收件人的类别
+	Recipients []*Recipient
+	// 退回的原始邮件或原始头部，没有时为nil
+	OriginalMessage *emailparser.EmailParser
+}
+
+// ClassifierOptions 识别参数，追加的规则和模式先于内置的匹配
+type ClassifierOptions struct {
+	Rules               []*Rule
+	SubjectPatterns     []*regexp.Regexp // 退信主题
+	SenderPatterns      []*regexp.Regexp // 退信发件人地址（小写）
+	RecipientPatterns   []*regexp.Regexp // 失败的收件人，第一个子匹配为地址
+	DisableDefaultRules bool             // 不使用内置的规则和模式
+}
+
+// Classifier 退信识别器，创建后可并发使用
+type Classifier struct {
+	rules             []*Rule
+	subjectPatterns   []*regexp.Regexp
+	senderPatterns    []*regexp.Regexp
+	recipientPatterns []*regexp.Regexp
+}
+
+// ClassifierNew 创建退信识别器
+func ClassifierNew(options ClassifierOptions) *Classifier {
+	c := &Classifier{
+		rules:             append([]*Rule(nil), options.Rules...),
+		subjectPatterns:   append([]*regexp.Regexp(nil), options.SubjectPatterns...),
+		senderPatterns:    append([]*regexp.Regexp(nil), options.SenderPatterns...),
+		recipientPatterns: append([]*regexp.Regexp(nil), options.RecipientPatterns...),
+	}
+	if !options.DisableDefaultRules {
+		c.rules = append(c.rules, defaultRules...)
+		c.subjectPatterns = append(c.subjectPatterns, defaultSubjectPatterns...)
+		c.senderPatterns = append(c.senderPatterns, defaultSenderPatterns...)
+		c.recipientPatterns = append(c.recipientPatterns, defaultRecipientPatterns...)
+	}
+	return c
+}
+
+var defaultClassifier = ClassifierNew(ClassifierOptions{})
+
+// Classify 使用内置规则识别退信
+func Classify(parser *emailparser.EmailParser) *Result {
+	return defaultClassifier.Classify(parser)
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyText 按规则对失败说明分类，返回类别和命中的规则名，没有命中时类别为空
+func (c *Classifier) ClassifyText(text string) (Category, string) {
+	for _, rule := range c.rules {
+		if rule.Pattern.MatchString(text) {
+			return rule.Category, rule.Name
+		}
+	}
+	return "", ""
+}
+
+// categoryFromStatus 按增强状态码或 SMTP 应答码分类
+func categoryFromStatus(status string, smtpCode string) Category {
+	if dot := strings.IndexByte(status, '.'); dot > 0 {
+		switch status[dot:] {
+		case ".1.1", ".1.10":
+			return CategoryUnknownUser
+		case ".2.2":
+			return CategoryMailboxFull
+		}
+		switch status[0] {
+		case '5':
+			return CategoryHard
+		case '4':
+			return CategorySoft
+		}
+	}
+	switch {
+	case strings.HasPrefix(smtpCode, "5"):
+		return CategoryHard
+	case strings.HasPrefix(smtpCode, "4"):
+		return CategorySoft
+	}
+	return ""
+}
+
+// classifyRecipient 从失败说明中提取状态码，并依次按规则、状态码、Action 确定类别
+func (c *Classifier) classifyRecipient(rcpt *Recipient, text string) {
+	rcpt.Diagnostic = normalizeDiagnostic(text)
+	if m := enhancedStatusRegexp.FindStringSubmatch(text); m != nil && rcpt.Status == "" {
+		rcpt.Status = m[1]
+	}
+	if m := smtpCodeRegexp.FindStringSubmatch(text); m != nil {
+		rcpt.SMTPCode = m[1]
+	}
+	if rcpt.Category, rcpt.Rule = c.ClassifyText(text); rcpt.Category != "" {
+		return
+	}
+	if rcpt.Category = categoryFromStatus(rcpt.Status, rcpt.SMTPCode); rcpt.Category != "" {
+		return
+	}
+	switch rcpt.Action {
+	case "failed":
+		rcpt.Category = CategoryHard
+	case "delayed":
+		rcpt.Category = CategorySoft
+	}
+}
+
+// normalizeDiagnostic 合并空白并截断
+func normalizeDiagnostic(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > maxDiagnosticLen {
+		text = string([]rune(text)[:maxDiagnosticLen])
+	}
+	return text
+}
+
+// Classify 识别退信；标准的投递状态通知中没有失败或延迟的收件人时 IsBounce 为 false
+func (c *Classifier) Classify(parser *emailparser.EmailParser) *Result {
+	var result *Result
+	if ds := parser.GetDeliveryStatus(); ds != nil {
+		result = c.classifyDeliveryStatus(ds)
+	} else {
+		result = c.classifyText(parser)
+	}
+	if len(result.Recipients) > 0 {
+		result.IsBounce = true
+		result.Category = result.Recipients[0].Category
+	}
+	return result
+}
+
+func (c *Classifier) classifyDeliveryStatus(ds *emailparser.DeliveryStatus) *Result {
+	result := &Result{Standard: true, OriginalMessage: ds.OriginalMessage}
+	for _, r := range ds.Recipients {
+		failed := r.Action == "failed" || r.Action == "delayed"
+		// 缺少 Action 时按状态码判断
+		if r.Action == "" {
+			failed = strings.HasPrefix(r.Status, "4.") || strings.HasPrefix(r.Status, "5.")
+		}
+		if !failed {
+			continue
+		}
+		address := r.FinalRecipient
+		if address == "" {
+			address = r.OriginalRecipient
+		}
+		rcpt := &Recipient{
+			Address: strings.ToLower(strings.Trim(address, "<>")),
+			Status:  r.Status,
+			Action:  r.Action,
+		}
+		c.classifyRecipient(rcpt, r.DiagnosticCode)
+		result.Recipients = append(result.Recipients, rcpt)
+	}
+	return result
+}
+
+// getBodyText 返回正文文字，有 TEXT/PLAIN 时只使用 TEXT/PLAIN，否则去掉 HTML 标签
+func getBodyText(parser *emailparser.EmailParser) string {
+	var plain, html []string
+	for _, node := range parser.GetTextNodes() {
+		switch node.ContentType {
+		case "TEXT/PLAIN":
+			plain = append(plain, node.GetDecodedTextContent())
+		case "TEXT/HTML":
+			html = append(html, node.GetDecodedTextContent())
+		}
+	}
+	if len(plain) > 0 {
+		return strings.Join(plain, "\n")
+	}
+	text := strings.Join(html, "\n")
+	text = htmlBreakRegexp.ReplaceAllString(text, "\n")
+	text = htmlTagRegexp.ReplaceAllString(text, "")
+	return strings.NewReplacer("&nbsp;", " ", "&lt;", "<", "&gt;", ">", "&quot;", "\"", "&amp;", "&").Replace(text)
+}
+
+var (
+	htmlBreakRegexp = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|tr|li|h\d)>`)
+	htmlTagRegexp   = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+type recipientMatch struct {
+	pos     int
+	address string
+	text    string // 失败说明
+}
+
+// findRecipients 按收件人模式查找失败的收件人，每个收件人的失败说明为其后到下一个收件人之前的文字
+func (c *Classifier) findRecipients(text string, skip map[string]bool) []recipientMatch {
+	var matches []recipientMatch
+	for _, pattern := range c.recipientPatterns {
+		for _, m := range pattern.FindAllStringSubmatchIndex(text, -1) {
+			if len(m) < 4 || m[2] < 0 {
+				continue
+			}
+			matches = append(matches, recipientMatch{pos: m[0], address: strings.ToLower(text[m[2]:m[3]])})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].pos < matches[j].pos
+	})
+	// 同一地址只取第一次出现的位置
+	seen := make(map[string]bool)
+	var firsts []recipientMatch
+	for _, m := range matches {
+		if seen[m.address] || skip[m.address] {
+			continue
+		}
+		seen[m.address] = true
+		firsts = append(firsts, m)
+	}
+	for i := range firsts {
+		end := len(text)
+		if i+1 < len(firsts) {
+			end = firsts[i+1].pos
+		}
+		firsts[i].text = text[firsts[i].pos:end]
+	}
+	return firsts
+}
+
+// findOriginalMessage 查找作为附件退回的原始邮件或原始头部
+func findOriginalMessage(parser *emailparser.EmailParser) *emailparser.EmailParser {
+	for _, node := range parser.GetAttachmentNodes() {
+		switch node.ContentType {
+		case "MESSAGE/RFC822", "MESSAGE/GLOBAL", "TEXT/RFC822-HEADERS", "MESSAGE/GLOBAL-HEADERS":
+			if original := node.GetEmbeddedEmailParser(); original != nil {
+				return original
+			}
+			return node.NewInnerEmailParser(node.GetDecodedContent())
+		}
+	}
+	return nil
+}
+
+// classifyText 识别非标准的退信：根据主题、发件人或 X-Failed-Recipients 判断是否为退信，再从正文中按模板提取
+func (c *Classifier) classifyText(parser *emailparser.EmailParser) *Result {
+	result := &Result{}
+	failedHeader := parser.GetTopMIMENode().GetHeaderValueIgnoreNotFound("X-FAILED-RECIPIENTS")
+	failedAddresses := emailparser.ParseMimeAddress(failedHeader, parser.DefaultCharset)
+	if len(failedAddresses) == 0 && !matchAny(c.subjectPatterns, parser.Subject) &&
+		!matchAny(c.senderPatterns, strings.ToLower(parser.From.Email)) {
+		return result
+	}
+	result.OriginalMessage = findOriginalMessage(parser)
+
+	text := getBodyText(parser)
+	if loc := originalMessageRegexp.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	// 退信的收件人（原邮件的发件人）和退信发件人的地址不是失败的收件人
+	skip := map[string]bool{strings.ToLower(parser.From.Email): true}
+	for _, to := range parser.To {
+		skip[strings.ToLower(to.Email)] = true
+	}
+	found := c.findRecipients(text, skip)
+	for _, addr := range failedAddresses {
+		email := strings.ToLower(addr.Email)
+		exist := email == ""
+		for _, m := range found {
+			exist = exist || m.address == email
+		}
+		if !exist {
+			found = append(found, recipientMatch{address: email, text: text})
+		}
+	}
+	if len(found) == 0 {
+		found = append(found, recipientMatch{text: text})
+	}
+	var recipients []*Recipient
+	for _, m := range found {
+		rcpt := &Recipient{Address: m.address}
+		c.classifyRecipient(rcpt, m.text)
+		recipients = append(recipients, rcpt)
+	}
+	result.Recipients = recipients
+	return result
+}
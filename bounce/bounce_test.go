@@ -0,0 +1,157 @@
+package bounce
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+func parseEmail(data string) *emailparser.EmailParser {
+	return emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte(data)})
+}
+
+func TestClassifyTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		address  string
+		status   string
+		category Category
+	}{
+		{"qmail", "From: MAILER-DAEMON@mx.example.org\r\n" +
+			"To: alice@example.net\r\n" +
+			"Subject: failure notice\r\n" +
+			"\r\n" +
+			"Hi. This is the qmail-send program at mx.example.org.\r\n" +
+			"I'm afraid I wasn't able to deliver your message to the following addresses.\r\n" +
+			"This is a permanent error; I've given up. Sorry it didn't work out.\r\n" +
+			"\r\n" +
+			"<bob@example.org>:\r\n" +
+			"Sorry, no mailbox here by that name. (#5.1.1)\r\n" +
+			"\r\n" +
+			"--- Below this line is a copy of the message.\r\n" +
+			"\r\n" +
+			"To: <carol@example.org>\r\n" +
+			"Subject: mailbox full\r\n",
+			"bob@example.org", "5.1.1", CategoryUnknownUser},
+		{"postfix", "From: MAILER-DAEMON@mx.example.net (Mail Delivery System)\r\n" +
+			"To: alice@example.net\r\n" +
+			"Subject: Undelivered Mail Returned to Sender\r\n" +
+			"\r\n" +
+			"<bob@example.org>: host mx.example.org[192.0.2.25] said: 552 5.2.2\r\n" +
+			"    Mailbox full (in reply to RCPT TO command)\r\n",
+			"bob@example.org", "5.2.2", CategoryMailboxFull},
+		{"exim", "From: Mail Delivery System <Mailer-Daemon@mx.example.net>\r\n" +
+			"To: alice@example.net\r\n" +
+			"Subject: Mail delivery failed: returning message to sender\r\n" +
+			"X-Failed-Recipients: bob@example.org\r\n" +
+			"\r\n" +
+			"A message that you sent could not be delivered to one or more of its\r\n" +
+			"recipients. This is a permanent error. The following address(es) failed:\r\n" +
+			"\r\n" +
+			"  bob@example.org\r\n" +
+			"    host mx.example.org [192.0.2.25]\r\n" +
+			"    SMTP error from remote mail server after end of data:\r\n" +
+			"    550 5.7.1 Message rejected as spam by Content Filtering\r\n",
+			"bob@example.org", "5.7.1", CategorySpamBlocked},
+		{"exchange", "From: postmaster@example.net\r\n" +
+			"To: alice@example.net\r\n" +
+			"Subject: Undeliverable: hello\r\n" +
+			"Content-Type: text/html; charset=utf-8\r\n" +
+			"\r\n" +
+			"<p>Delivery has failed to these recipients or groups:</p>\r\n" +
+			"<p><a href=\"mailto:bob@example.org\">bob@example.org</a><br>\r\n" +
+			"The e-mail address you entered couldn't be found.</p>\r\n" +
+			"<p>Remote Server returned '550 5.1.10 RESOLVER.ADR.RecipientNotFound; not found'</p>\r\n",
+			"bob@example.org", "5.1.10", CategoryUnknownUser},
+		{"chinese", "From: postmaster@qq.example\r\n" +
+			"To: alice@example.net\r\n" +
+			"Subject: =?UTF-8?B?57O757uf6YCA5L+h?=\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"\r\n" +
+			"很抱歉您发送的邮件被退回，以下是该邮件的相关信息：\r\n" +
+			"收件人：bob@example.org\r\n" +
+			"退信原因：收件人邮箱空间已满，请稍后再发。\r\n",
+			"bob@example.org", "", CategoryMailboxFull},
+		{"soft", "From: MAILER-DAEMON@mx.example.net\r\n" +
+			"To: alice@example.net\r\n" +
+			"Subject: Delayed Mail (still being retried)\r\n" +
+			"\r\n" +
+			"<bob@example.org>: connect to mx.example.org[192.0.2.25]:25: Connection timed out\r\n",
+			"bob@example.org", "", CategorySoft},
+	}
+	for _, test := range tests {
+		result := Classify(parseEmail(test.email))
+		if !result.IsBounce || result.Standard || len(result.Recipients) != 1 {
+			t.Fatalf("%s: unexpected result: %+v", test.name, result)
+		}
+		if rcpt := result.Recipients[0]; rcpt.Address != test.address || rcpt.Status != test.status ||
+			rcpt.Category != test.category || result.Category != test.category {
+			t.Fatalf("%s: unexpected recipient: %+v", test.name, rcpt)
+		}
+	}
+}
+
+func TestClassifyDeliveryStatus(t *testing.T) {
+	emailData := "From: MAILER-DAEMON@mx.example.org\r\n" +
+		"To: alice@example.net\r\n" +
+		"Subject: Delivery Status Notification\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=\"BB\"\r\n" +
+		"\r\n" +
+		"--BB\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Delivery to the following recipients failed.\r\n" +
+		"--BB\r\n" +
+		"Content-Type: message/delivery-status\r\n" +
+		"\r\n" +
+		"Reporting-MTA: dns; mx.example.org\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; bob@example.org\r\n" +
+		"Action: failed\r\n" +
+		"Status: 5.0.0\r\n" +
+		"Diagnostic-Code: smtp; 550 Requested action not taken: mailbox unavailable\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; carol@example.org\r\n" +
+		"Action: delivered\r\n" +
+		"Status: 2.0.0\r\n" +
+		"\r\n" +
+		"--BB--\r\n"
+	result := Classify(parseEmail(emailData))
+	if !result.IsBounce || !result.Standard || len(result.Recipients) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rcpt := result.Recipients[0]; rcpt.Address != "bob@example.org" || rcpt.SMTPCode != "550" ||
+		rcpt.Category != CategoryHard || !rcpt.Category.IsPermanent() {
+		t.Fatalf("unexpected recipient: %+v", rcpt)
+	}
+}
+
+func TestClassifierOptions(t *testing.T) {
+	emailData := "From: noreply@mail.example.com\r\n" +
+		"To: alice@example.net\r\n" +
+		"Subject: Message bounced\r\n" +
+		"\r\n" +
+		"Recipient bob@example.org: account suspended for non-payment\r\n"
+	if result := Classify(parseEmail(emailData)); result.IsBounce {
+		t.Fatalf("unexpected bounce: %+v", result)
+	}
+	classifier := ClassifierNew(ClassifierOptions{
+		Rules:             []*Rule{{Name: "suspended", Category: CategoryHard, Pattern: regexp.MustCompile(`account suspended`)}},
+		SubjectPatterns:   []*regexp.Regexp{regexp.MustCompile(`^Message bounced$`)},
+		RecipientPatterns: []*regexp.Regexp{regexp.MustCompile(`Recipient (\S+@\S+):`)},
+	})
+	result := classifier.Classify(parseEmail(emailData))
+	if !result.IsBounce || len(result.Recipients) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if rcpt := result.Recipients[0]; rcpt.Address != "bob@example.org" || rcpt.Category != CategoryHard || rcpt.Rule != "suspended" {
+		t.Fatalf("unexpected recipient: %+v", rcpt)
+	}
+
+	normal := parseEmail("From: bob@example.org\r\nTo: alice@example.net\r\nSubject: hello\r\n\r\nuser unknown\r\n")
+	if result := Classify(normal); result.IsBounce {
+		t.Fatalf("unexpected bounce: %+v", result)
+	}
+}
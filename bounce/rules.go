@@ -0,0 +1,62 @@
+package bounce
+
+import "regexp"
+
+// addressPattern 退信文字中的邮件地址
+const addressPattern = `[^\s<>@"'()\[\],;:：，（）]+@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?)+`
+
+// defaultRules 内置分类规则，按顺序匹配，具体的类别在前
+var defaultRules = []*Rule{
+	{"unknown-user", CategoryUnknownUser, regexp.MustCompile(`(?i)user unknown|unknown (?:user|recipient|local part)|no such (?:user|mailbox|recipient|address|account)|` +
+		`(?:mailbox|recipient|address|user|account)(?: name)? (?:does not exist|doesn't exist|not found|is invalid|invalid)|` +
+		`no mailbox here by that name|invalid (?:recipient|mailbox|address)|not our customer|recipnotfound|` +
+		`(?:e-?mail )?address (?:you entered )?couldn't be found|account (?:has been |is )?disabled|unrouteable address`)},
+	{"unknown-user-zh", CategoryUnknownUser, regexp.MustCompile(`(?:用户|收件人|收信人|邮箱|地址|账户|帐户|账号|帐号)[^\n。，,]{0,10}不存在|查无此人|无效的?收件人|收件人地址无效`)},
+	{"mailbox-full", CategoryMailboxFull, regexp.MustCompile(`(?i)mailbox (?:is )?full|(?:mailbox|disk) quota|quota exceeded|over ?quota|exceeded (?:the )?(?:storage|quota)|` +
+		`insufficient (?:storage|disk space)|mailbox size limit|storage allocation|quotaexceeded`)},
+	{"mailbox-full-zh", CategoryMailboxFull, regexp.MustCompile(`(?:邮箱|信箱|空间|容量)[^\n。，,]{0,6}(?:已满|不足)|超[出过][^\n。，,]{0,10}(?:容量|配额|限额)`)},
+	{"spam-blocked", CategorySpamBlocked, regexp.MustCompile(`(?i)spam|black ?list|block ?list|dnsbl|\brbl\b|spamhaus|` +
+		`(?:poor|bad|low) reputation|content (?:rejected|filter)|virus|blocked (?:by|because|due)|message (?:was )?blocked`)},
+	{"spam-blocked-zh", CategorySpamBlocked, regexp.MustCompile(`垃圾邮件|反垃圾|黑名单|被拦截|被屏蔽|病毒|信誉`)},
+	{"soft", CategorySoft, regexp.MustCompile(`(?i)temporar(?:y|ily)|try again later|will (?:continue|retry|keep)|not yet been delivered|` +
+		`delivery (?:is |has been )?delayed|deferred|timed? ?out|connection refused|greylist|too many (?:connections|messages|recipients)|rate limit`)},
+	{"soft-zh", CategorySoft, regexp.MustCompile(`暂时|稍后重试|延迟|超时|频率过高|发送过于频繁`)},
+	{"hard", CategoryHard, regexp.MustCompile(`(?i)host (?:or domain name )?not found|domain (?:not found|does not exist|doesn't exist)|no (?:mx|mail) (?:record|server|host)|` +
+		`name service error|relay(?:ing)? (?:denied|not permitted)|permanent(?:ly)? (?:error|failure|fatal)|failed permanently|` +
+		`message (?:size )?exceeds|too large|access denied`)},
+	{"hard-zh", CategoryHard, regexp.MustCompile(`域名不存在|找不到[^\n。，,]{0,10}服务器|永久性?错误|拒绝|邮件过大`)},
+}
+
+// defaultSubjectPatterns 常见的退信主题
+var defaultSubjectPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)undeliver|non[- ]?delivery|delivery (?:status notification|failure|failed|has failed|problem|report|delayed)|` +
+		`mail delivery (?:failed|failure|system|subsystem)|returned mail|returned to sender|failure notice|delayed mail|` +
+		`(?:could not|couldn't|wasn't|was not) be(?:en)? delivered|warning: could not send`),
+	regexp.MustCompile(`退信|退回|无法投递|投递失败|发送失败|未能送达|无法送达|被拒收|延迟投递`),
+}
+
+// defaultSenderPatterns 常见的退信发件人
+var defaultSenderPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^(?:mailer-daemon|mail-daemon|mailerdaemon|postmaster|microsoftexchange[0-9a-f]*)@`),
+}
+
+// defaultRecipientPatterns 常见退信模板中失败的收件人，第一个子匹配为地址
+var defaultRecipientPatterns = []*regexp.Regexp{
+	// qmail、Postfix："<user@example.com>: ..."
+	regexp.MustCompile(`(?m)^[ \t]*<(` + addressPattern + `)>:`),
+	// Exim、Exchange、Gmail：单独一行的地址，可能带有括号注释
+	regexp.MustCompile(`(?m)^[ \t]*<?(` + addressPattern + `)>?(?:[ \t]+\([^)\n]*\))?[ \t]*:?[ \t]*\r?$`),
+	regexp.MustCompile(`(?i)(?:your message to|delivery to|(?:wasn't|was not|couldn't be|could not be) delivered to)[ \t]*:?[ \t]*<?(` + addressPattern + `)`),
+	regexp.MustCompile(`(?:收件人|收信人|收件地址|收件人地址)[ \t]*[:：]?[ \t]*<?(` + addressPattern + `)`),
+	regexp.MustCompile(`(?:发送到|发往|发给|投递到|投递给)[ \t]*<?(` + addressPattern + `)`),
+}
+
+// originalMessageRegexp 退信文字中附带的原始邮件的开始位置，其后的内容不参与识别
+var originalMessageRegexp = regexp.MustCompile(`(?im)^[ \t>-]*(?:below this line is a copy of the message|this is a copy of the message|` +
+	`original message (?:follows|headers)|undelivered message (?:follows|headers)|-+ ?original message ?-+|以下是原邮件|原邮件内容|原始邮件(?:内容|信息)?[:：])`)
+
+// enhancedStatusRegexp 增强状态码（RFC 3463），如 5.1.1，排除 IP 地址
+var enhancedStatusRegexp = regexp.MustCompile(`(?:^|[^\d.])([245]\.\d{1,3}\.\d{1,3})(?:\.?[^\d.]|\.?$)`)
+
+// smtpCodeRegexp SMTP 应答码，如 550
+var smtpCodeRegexp = regexp.MustCompile(`(?:^|[^\d.\-])([45]\d\d)(?:[ \-]|$)`)
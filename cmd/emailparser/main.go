@@ -0,0 +1,268 @@
+// emailparser 命令行工具：查看、提取、转换 .eml 邮件
+//
+// 用法：emailparser <子命令> [选项] <邮件文件|->
+//
+//	show     输出 DebugShow 的内容
+//	json     输出 JSON（-jmap 输出 JMAP Email 对象）
+//	tree     输出 MIME 结构及偏移
+//	extract  将附件写入目录（-dir），文件名经过安全处理，不覆盖已有文件
+//	body     输出正文（-type show|text|html）
+//	headers  输出顶层头部（-decode 解码 RFC 2047）
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+const usage = `usage: emailparser <command> [options] <file.eml|->
+
+commands:
+  show     print parsed fields, text nodes, attachments and defects
+  json     print JSON (-jmap for the JMAP Email object)
+  tree     print the MIME structure with byte offsets
+  extract  write attachments to a directory (-dir)
+  body     print the message body (-type show|text|html)
+  headers  print top-level headers (-decode to decode RFC 2047 words)
+`
+
+var errUsage = errors.New("usage")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if err == errUsage {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "emailparser: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run 执行子命令，便于测试
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	command := args[0]
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	jmap := flags.Bool("jmap", false, "json: output the JMAP Email object")
+	dir := flags.String("dir", ".", "extract: output directory")
+	bodyType := flags.String("type", "show", "body: show, text or html")
+	decode := flags.Bool("decode", false, "headers: decode RFC 2047 encoded words")
+	charset := flags.String("charset", "UTF-8", "default charset for unlabeled text")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	var data []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{
+		DefaultCharset: *charset,
+		EmailData:      data,
+	})
+
+	switch command {
+	case "show":
+		parser.DebugShowTo(stdout)
+		return nil
+	case "json":
+		var value any = parser
+		if *jmap {
+			value = parser.GetJmapEmail(emailparser.JmapEmailOptions{FetchAllBodyValues: true})
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "tree":
+		writeTree(stdout, parser, "", "")
+		return nil
+	case "extract":
+		return extractAttachments(stdout, parser, *dir)
+	case "body":
+		return writeBody(stdout, parser, *bodyType)
+	case "headers":
+		return writeHeaders(stdout, parser, *decode)
+	}
+	return errUsage
+}
+
+// writeTree 输出 MIME 结构：部分编号、媒体类型、头部和正文的偏移及长度
+func writeTree(w io.Writer, parser *emailparser.EmailParser, prefix string, indent string) {
+	var walk func(node *emailparser.MIMENode, id string, indent string)
+	walk = func(node *emailparser.MIMENode, id string, indent string) {
+		label := id
+		if label == "" {
+			label = "*"
+		}
+		fmt.Fprintf(w, "%s%s %s header=%d+%d body=%d+%d", indent, label, strings.ToLower(node.ContentType),
+			node.HeaderStart, node.HeaderLen, node.BodyStart, node.BodyLen)
+		if node.Encoding != "" {
+			fmt.Fprintf(w, " encoding=%s", strings.ToLower(node.Encoding))
+		}
+		if node.Charset != "" {
+			fmt.Fprintf(w, " charset=%s", node.Charset)
+		}
+		if node.Disposition != "" {
+			fmt.Fprintf(w, " disposition=%s", strings.ToLower(node.Disposition))
+		}
+		if filename := attachmentName(node); filename != "" {
+			fmt.Fprintf(w, " filename=%q", filename)
+		}
+		fmt.Fprintln(w)
+		for i, child := range node.Childs {
+			walk(child, joinPartID(id, i+1), indent+"  ")
+		}
+		if embedded := node.GetEmbeddedEmailParser(); embedded != nil {
+			writeTree(w, embedded, id, indent+"  ")
+		}
+	}
+	top := parser.GetTopMIMENode()
+	if strings.HasPrefix(top.ContentType, "MULTIPART/") {
+		walk(top, prefix, indent)
+	} else {
+		walk(top, joinPartID(prefix, 1), indent)
+	}
+}
+
+func joinPartID(prefix string, n int) string {
+	if prefix == "" {
+		return strconv.Itoa(n)
+	}
+	return prefix + "." + strconv.Itoa(n)
+}
+
+func attachmentName(node *emailparser.MIMENode) string {
+	if node.Filename != "" {
+		return node.Filename
+	}
+	return node.Name
+}
+
+// safeFilename 去除路径、控制字符和保留字符，避免写到目标目录之外
+func safeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = name[strings.LastIndexByte(name, '/')+1:]
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if len(name) > 200 {
+		ext := filepath.Ext(name)
+		if len(ext) > 20 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:200-len(ext)], "") + ext
+	}
+	return name
+}
+
+// createUniqueFile 创建文件，重名时追加 " (N)"
+func createUniqueFile(dir string, name string) (*os.File, string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+		path := filepath.Join(dir, candidate)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return f, path, nil
+		}
+		if !os.IsExist(err) {
+			return nil, "", err
+		}
+	}
+}
+
+func extractAttachments(w io.Writer, parser *emailparser.EmailParser, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, node := range parser.GetAttachmentNodes() {
+		name := safeFilename(attachmentName(node))
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d.bin", i+1)
+		}
+		f, path, err := createUniqueFile(dir, name)
+		if err != nil {
+			return err
+		}
+		data := node.GetDecodedContent()
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", path, len(data), strings.ToLower(node.ContentType))
+	}
+	return nil
+}
+
+func writeBody(w io.Writer, parser *emailparser.EmailParser, bodyType string) error {
+	switch bodyType {
+	case "show":
+		for _, node := range parser.GetAlternativeShowNodes() {
+			fmt.Fprintln(w, node.GetDecodedTextContent())
+		}
+		return nil
+	case "text", "html":
+		email := parser.GetJmapEmail(emailparser.JmapEmailOptions{FetchTextBodyValues: true, FetchHTMLBodyValues: true})
+		parts := email.TextBody
+		if bodyType == "html" {
+			parts = email.HTMLBody
+		}
+		for _, part := range parts {
+			if part.PartID == nil {
+				continue
+			}
+			if value := email.BodyValues[*part.PartID]; value != nil {
+				fmt.Fprintln(w, value.Value)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown body type: %s", bodyType)
+}
+
+func writeHeaders(w io.Writer, parser *emailparser.EmailParser, decode bool) error {
+	if !decode {
+		header, err := parser.GetImapSection("HEADER")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(header)
+		return err
+	}
+	for _, header := range parser.GetJSON().Headers {
+		value := emailparser.ParseMimeValueString([]byte(header.Value), parser.DefaultCharset)
+		fmt.Fprintf(w, "%s: %s\n", header.Name, value)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testEmail = "From: alice@example.com\r\n" +
+	"Subject: =?UTF-8?B?5rWL6K+V?=\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"hello\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Disposition: attachment; filename=\"../../etc/passwd\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"aGVsbG8=\r\n" +
+	"--b1--\r\n"
+
+func runTest(t *testing.T, args ...string) string {
+	var out bytes.Buffer
+	if err := run(args, strings.NewReader(testEmail), &out); err != nil {
+		t.Fatalf("%v failed: %v", args, err)
+	}
+	return out.String()
+}
+
+func TestCommands(t *testing.T) {
+	if out := runTest(t, "tree", "-"); !strings.Contains(out, "* multipart/mixed header=0+") ||
+		!strings.Contains(out, "  2 application/octet-stream") {
+		t.Fatalf("unexpected tree:\n%s", out)
+	}
+	if out := runTest(t, "headers", "-decode", "-"); !strings.Contains(out, "Subject: 测试\n") {
+		t.Fatalf("unexpected headers:\n%s", out)
+	}
+	if out := runTest(t, "body", "-type", "text", "-"); out != "hello\n" {
+		t.Fatalf("unexpected body: %q", out)
+	}
+	if out := runTest(t, "json", "-"); !strings.Contains(out, `"subject": "测试"`) {
+		t.Fatalf("unexpected json:\n%s", out)
+	}
+
+	dir := t.TempDir()
+	runTest(t, "extract", "-dir", dir, "-")
+	runTest(t, "extract", "-dir", dir, "-")
+	for _, name := range []string{"passwd", "passwd (1)"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != "hello" {
+			t.Fatalf("attachment %s not extracted: %v", name, err)
+		}
+	}
+	if err := run([]string{"unknown", "-"}, strings.NewReader(testEmail), &bytes.Buffer{}); err != errUsage {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+}
+
+func TestSafeFilename(t *testing.T) {
+	cases := map[string]string{
+		"..\\..\\boot.ini": "boot.ini",
+		"a:b?.txt":         "a_b_.txt",
+		"..":               "",
+		".hidden":          "hidden",
+		"报告.pdf":           "报告.pdf",
+	}
+	for input, expected := range cases {
+		if got := safeFilename(input); got != expected {
+			t.Fatalf("safeFilename(%q) = %q", input, got)
+		}
+	}
+}
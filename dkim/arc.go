@@ -0,0 +1,351 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// ARC（RFC 8617）：ARC-Message-Signature 与 DKIM-Signature 的签名方式相同，
+// ARC-Seal 对所有 ARC 头部签名，头部规范化固定为 relaxed
+
+const StatusNone Status = "none"
+
+var (
+	ErrARCChainFailed   = errors.New("ARC chain already failed")
+	ErrARCTooManySets   = errors.New("too many ARC sets")
+	ErrARCTemporaryFail = errors.New("ARC chain validation temporarily failed")
+)
+
+// ARCSeal 解析后的 ARC-Seal
+type ARCSeal struct {
+	Instance        int
+	ChainValidation Status // cv=，none、pass 或 fail
+	Algorithm       string
+	Signature       []byte
+	Domain          string
+	Selector        string
+	Timestamp       int64
+	Tags            map[string]string
+}
+
+// ParseARCSeal 解析 ARC-Seal 头部的值
+func ParseARCSeal(value string) (*ARCSeal, error) {
+	tags, err := ParseTagList(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"i", "cv", "a", "b", "d", "s"} {
+		if _, ok := tags[name]; !ok {
+			return nil, fmt.Errorf("missing tag %s", name)
+		}
+	}
+	if _, ok := tags["h"]; ok {
+		return nil, errors.New("h= not allowed in ARC-Seal")
+	}
+	seal := &ARCSeal{
+		ChainValidation: Status(strings.ToLower(tags["cv"])),
+		Algorithm:       strings.ToLower(tags["a"]),
+		Domain:          strings.ToLower(strings.TrimSuffix(tags["d"], ".")),
+		Selector:        strings.ToLower(tags["s"]),
+		Tags:            tags,
+	}
+	if seal.Instance, err = parseARCInstance(tags["i"]); err != nil {
+		return nil, err
+	}
+	if seal.ChainValidation != StatusNone && seal.ChainValidation != StatusPass && seal.ChainValidation != StatusFail {
+		return nil, fmt.Errorf("invalid cv= tag %q", tags["cv"])
+	}
+	if seal.Signature, err = base64.StdEncoding.DecodeString(removeFWS(tags["b"])); err != nil {
+		return nil, fmt.Errorf("invalid b= tag: %w", err)
+	}
+	if t, ok := tags["t"]; ok {
+		if seal.Timestamp, err = strconv.ParseInt(t, 10, 64); err != nil {
+			return nil, errors.New("invalid t= tag")
+		}
+	}
+	return seal, nil
+}
+
+// ARCSet 同一序号的一组 ARC 头部
+type ARCSet struct {
+	Instance              int
+	AuthenticationResults string     // ARC-Authentication-Results 中 i= 之后的内容
+	MessageSignature      *Signature // ARC-Message-Signature
+	Seal                  *ARCSeal   // ARC-Seal
+	rawAAR                []byte
+	rawAMS                []byte
+	rawSeal               []byte
+}
+
+// ARCResult ARC 链的验证结果
+type ARCResult struct {
+	Status           Status    // none、pass、fail；查询公钥临时失败时为 temperror
+	Reason           string    // 非 pass、none 时的原因
+	Sets             []*ARCSet // 按序号排列，结构无效时为nil
+	MessageSignature *Result   // 最新的 ARC-Message-Signature 的验证结果
+}
+
+// collectARCSets 按序号收集 ARC 头部，并检查每个序号有且只有一组完整的头部，序号从1连续
+func collectARCSets(top *emailparser.MIMENode) ([]*ARCSet, error) {
+	byInstance := make(map[int]*ARCSet)
+	getSet := func(instance int) *ARCSet {
+		set := byInstance[instance]
+		if set == nil {
+			set = &ARCSet{Instance: instance}
+			byInstance[instance] = set
+		}
+		return set
+	}
+	for _, line := range top.Header {
+		if line.Name != "ARC-AUTHENTICATION-RESULTS" && line.Name != "ARC-MESSAGE-SIGNATURE" && line.Name != "ARC-SEAL" {
+			continue
+		}
+		raw := top.GetRawHeaderLine(line)
+		_, value, _ := strings.Cut(string(raw), ":")
+		switch line.Name {
+		case "ARC-AUTHENTICATION-RESULTS":
+			first, rest, _ := strings.Cut(value, ";")
+			name, v, _ := strings.Cut(first, "=")
+			if strings.TrimSpace(name) != "i" {
+				return nil, errors.New("ARC-Authentication-Results without i=")
+			}
+			instance, err := parseARCInstance(strings.TrimSpace(v))
+			if err != nil {
+				return nil, err
+			}
+			set := getSet(instance)
+			if set.rawAAR != nil {
+				return nil, fmt.Errorf("duplicate ARC-Authentication-Results i=%d", instance)
+			}
+			set.rawAAR = raw
+			set.AuthenticationResults = strings.TrimSpace(compressWSP(rest))
+		case "ARC-MESSAGE-SIGNATURE":
+			sig, err := ParseARCMessageSignature(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ARC-Message-Signature: %w", err)
+			}
+			set := getSet(sig.Instance)
+			if set.rawAMS != nil {
+				return nil, fmt.Errorf("duplicate ARC-Message-Signature i=%d", sig.Instance)
+			}
+			set.rawAMS = raw
+			set.MessageSignature = sig
+		case "ARC-SEAL":
+			seal, err := ParseARCSeal(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ARC-Seal: %w", err)
+			}
+			set := getSet(seal.Instance)
+			if set.rawSeal != nil {
+				return nil, fmt.Errorf("duplicate ARC-Seal i=%d", seal.Instance)
+			}
+			set.rawSeal = raw
+			set.Seal = seal
+		}
+	}
+	sets := make([]*ARCSet, len(byInstance))
+	for instance := 1; instance <= len(byInstance); instance++ {
+		set := byInstance[instance]
+		if set == nil {
+			return nil, fmt.Errorf("missing ARC set i=%d", instance)
+		}
+		if set.rawAAR == nil || set.rawAMS == nil || set.rawSeal == nil {
+			return nil, fmt.Errorf("incomplete ARC set i=%d", instance)
+		}
+		sets[instance-1] = set
+	}
+	return sets, nil
+}
+
+// arcSealData 返回 ARC-Seal 签名的数据：按序号依次为 AAR、AMS、AS，最后一个 AS 清空 b= 且不含结尾 CRLF
+func arcSealData(sets []*ARCSet) []byte {
+	var buf bytes.Buffer
+	for i, set := range sets {
+		buf.WriteString(canonicalizeHeader(set.rawAAR, "relaxed"))
+		buf.WriteString(canonicalizeHeader(set.rawAMS, "relaxed"))
+		if i == len(sets)-1 {
+			buf.Write(signatureHeaderData(set.rawSeal, "relaxed"))
+		} else {
+			buf.WriteString(canonicalizeHeader(set.rawSeal, "relaxed"))
+		}
+	}
+	return buf.Bytes()
+}
+
+// verifyARCSeal 验证 sets 中最后一个 ARC-Seal
+func verifyARCSeal(sets []*ARCSet, options *VerifyOptions) (Status, string) {
+	seal := sets[len(sets)-1].Seal
+	keyType, hash, err := hashAlgorithm(seal.Algorithm)
+	if err != nil {
+		return StatusFail, "unsupported algorithm " + seal.Algorithm
+	}
+	key, status, reason := resolveKey(options, seal.Selector, seal.Domain, keyType)
+	if status != StatusPass {
+		return status, reason
+	}
+	h := hash.New()
+	h.Write(arcSealData(sets))
+	if !verifyDigest(key.Key, hash, h.Sum(nil), seal.Signature) {
+		return StatusFail, "signature did not verify"
+	}
+	return StatusPass, ""
+}
+
+// VerifyARC 验证邮件的 ARC 链（RFC 8617 5.2）；邮件没有保存原始数据时结果为 temperror，原因为 ErrNoEmailData
+func VerifyARC(parser *emailparser.EmailParser, options VerifyOptions) *ARCResult {
+	options.setDefaults()
+	result := &ARCResult{}
+	fail := func(status Status, reason string) *ARCResult {
+		if status != StatusTempError {
+			status = StatusFail
+		}
+		result.Status = status
+		result.Reason = reason
+		return result
+	}
+
+	top := parser.GetTopMIMENode()
+	if !hasEmailData(parser) && (hasHeader(top, "ARC-Seal") || hasHeader(top, "ARC-Message-Signature") || hasHeader(top, "ARC-Authentication-Results")) {
+		return fail(StatusTempError, ErrNoEmailData.Error())
+	}
+	sets, err := collectARCSets(top)
+	if err != nil {
+		return fail(StatusFail, err.Error())
+	}
+	if len(sets) == 0 {
+		result.Status = StatusNone
+		return result
+	}
+	result.Sets = sets
+	latest := sets[len(sets)-1]
+	if latest.Seal.ChainValidation == StatusFail {
+		return fail(StatusFail, fmt.Sprintf("ARC-Seal i=%d has cv=fail", latest.Instance))
+	}
+	for _, set := range sets {
+		expected := StatusPass
+		if set.Instance == 1 {
+			expected = StatusNone
+		}
+		if set.Seal.ChainValidation != expected {
+			return fail(StatusFail, fmt.Sprintf("ARC-Seal i=%d has cv=%s", set.Instance, set.Seal.ChainValidation))
+		}
+	}
+
+	result.MessageSignature = verifyParsedSignature(top, latest.rawAMS, latest.MessageSignature, getBody(parser), &options)
+	if result.MessageSignature.Status != StatusPass {
+		return fail(result.MessageSignature.Status, fmt.Sprintf("ARC-Message-Signature i=%d: %s", latest.Instance, result.MessageSignature.Reason))
+	}
+	for i := len(sets); i > 0; i-- {
+		if status, reason := verifyARCSeal(sets[:i], &options); status != StatusPass {
+			return fail(status, fmt.Sprintf("ARC-Seal i=%d: %s", i, reason))
+		}
+	}
+	result.Status = StatusPass
+	return result
+}
+
+// ARCSealOptions 添加 ARC 头部的参数
+type ARCSealOptions struct {
+	SignOptions               // ARC-Message-Signature 的签名参数，Domain、Selector、Signer 同时用于 ARC-Seal；Identity 被忽略
+	AuthServID  string        // ARC-Authentication-Results 中的 authserv-id
+	AuthResults string        // 本次的认证结果，如 "dkim=pass header.d=example.com; spf=pass smtp.mailfrom=example.com"
+	Verify      VerifyOptions // 验证已有 ARC 链的参数
+}
+
+// SealARCParser 验证已有的 ARC 链，并在顶层头部最前面添加新的一组 ARC 头部
+// 已有链的最新 ARC-Seal 为 cv=fail 时返回 ErrARCChainFailed，验证临时失败时返回 ErrARCTemporaryFail
+func SealARCParser(parser *emailparser.EmailParser, options ARCSealOptions) error {
+	options.SignOptions.setDefaults()
+	options.Identity = ""
+	algorithm, signerOpts, err := signingAlgorithm(options.Signer)
+	if err != nil {
+		return err
+	}
+
+	verified, err := reparse(parser)
+	if err != nil {
+		return err
+	}
+	current := VerifyARC(verified, options.Verify)
+	switch {
+	case current.Status == StatusTempError:
+		return fmt.Errorf("%w: %s", ErrARCTemporaryFail, current.Reason)
+	case current.Status == StatusFail && current.Sets == nil:
+		return fmt.Errorf("invalid ARC chain: %s", current.Reason)
+	case len(current.Sets) > 0 && current.Sets[len(current.Sets)-1].Seal.ChainValidation == StatusFail:
+		return ErrARCChainFailed
+	case len(current.Sets) >= 50:
+		return ErrARCTooManySets
+	}
+	instance := len(current.Sets) + 1
+	top := parser.GetTopMIMENode()
+
+	authResults := options.AuthResults
+	if authResults == "" {
+		authResults = "none"
+	}
+	aar := fmt.Sprintf("i=%d; %s; %s", instance, options.AuthServID, authResults)
+	withAAR, err := reparse(parser)
+	if err != nil {
+		return err
+	}
+	if err := withAAR.GetTopMIMENode().PrependHeader("ARC-Authentication-Results", aar); err != nil {
+		return err
+	}
+	signed, err := reparse(withAAR)
+	if err != nil {
+		return err
+	}
+	ams, err := signMessage(signed.GetTopMIMENode(), getBody(signed), "ARC-Message-Signature", fmt.Sprintf("i=%d;", instance), &options.SignOptions)
+	if err != nil {
+		return err
+	}
+	if err := top.PrependHeader("ARC-Authentication-Results", aar); err != nil {
+		return err
+	}
+	if err := top.PrependHeader("ARC-Message-Signature", ams); err != nil {
+		return err
+	}
+
+	folder := &headerFolder{lineLen: len("ARC-Seal: ")}
+	folder.add("", fmt.Sprintf("i=%d;", instance))
+	folder.add(" ", "a="+algorithm+";")
+	folder.add(" ", "cv="+string(current.Status)+";")
+	folder.add(" ", "d="+options.Domain+";")
+	folder.add(" ", "s="+options.Selector+";")
+	folder.add(" ", "t="+strconv.FormatInt(options.Time.Unix(), 10)+";")
+	folder.add(" ", "b=")
+	sets := append(current.Sets, &ARCSet{
+		rawAAR:  top.GetRawHeaderLine(top.Header[1]),
+		rawAMS:  top.GetRawHeaderLine(top.Header[0]),
+		rawSeal: []byte("ARC-Seal: " + folder.sb.String()),
+	})
+	h := crypto.SHA256.New()
+	h.Write(arcSealData(sets))
+	signature, err := options.Signer.Sign(rand.Reader, h.Sum(nil), signerOpts)
+	if err != nil {
+		return err
+	}
+	folder.addBase64(base64.StdEncoding.EncodeToString(signature))
+	return top.PrependHeader("ARC-Seal", folder.sb.String())
+}
+
+// SealARC 对原始邮件添加 ARC 头部，返回添加后的邮件
+func SealARC(data []byte, options ARCSealOptions) ([]byte, error) {
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{
+		EmailData:       data,
+		MaxNestingDepth: -1,
+	})
+	if err := SealARCParser(parser, options); err != nil {
+		return nil, err
+	}
+	return parser.Serialize()
+}
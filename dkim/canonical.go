@@ -0,0 +1,97 @@
+package dkim
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// compressWSP 将连续的空白（包括折行）压缩为一个空格
+func compressWSP(s string) string {
+	var sb strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			space = true
+			continue
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		sb.WriteByte(c)
+	}
+	if space {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// canonicalizeHeader 规范化一个原始头部行（含折行和结尾换行），结果以 CRLF 结尾
+func canonicalizeHeader(raw []byte, canon string) string {
+	if canon == "simple" {
+		s := string(emailparser.CanonicalizeCRLF(raw))
+		if !strings.HasSuffix(s, "\r\n") {
+			s += "\r\n"
+		}
+		return s
+	}
+	name, value, _ := strings.Cut(string(raw), ":")
+	name = strings.ToLower(strings.TrimRight(name, " \t"))
+	value = strings.TrimSpace(compressWSP(value))
+	return name + ":" + value + "\r\n"
+}
+
+// canonicalizeBody 规范化正文（RFC 6376 3.4.3、3.4.4）
+func canonicalizeBody(body []byte, canon string) []byte {
+	body = emailparser.CanonicalizeCRLF(body)
+	if canon == "relaxed" {
+		lines := bytes.Split(body, []byte("\r\n"))
+		var buf bytes.Buffer
+		for i, line := range lines {
+			line = []byte(strings.TrimRight(compressWSP(string(line)), " "))
+			buf.Write(line)
+			if i < len(lines)-1 {
+				buf.WriteString("\r\n")
+			}
+		}
+		body = buf.Bytes()
+	} else {
+		body = append([]byte(nil), body...)
+	}
+	// 去除结尾的空行，非空正文以 CRLF 结尾
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if len(body) > 0 || canon == "simple" {
+		body = append(body, "\r\n"...)
+	}
+	return body
+}
+
+// removeSignatureValue 清空 DKIM-Signature 原始头部中 b= 的值（包括其中的空白和折行），保留其它内容
+// b= 为最后一个标签时结尾换行也被去除，调用者规范化后按无结尾换行处理
+func removeSignatureValue(raw string) string {
+	colon := strings.IndexByte(raw, ':')
+	if colon < 0 {
+		return raw
+	}
+	pos := colon + 1
+	for pos <= len(raw) {
+		end := strings.IndexByte(raw[pos:], ';')
+		if end < 0 {
+			end = len(raw)
+		} else {
+			end += pos
+		}
+		spec := raw[pos:end]
+		if name, _, found := strings.Cut(spec, "="); found && strings.TrimSpace(name) == "b" {
+			eq := pos + strings.IndexByte(spec, '=') + 1
+			return raw[:eq] + raw[end:]
+		}
+		pos = end + 1
+	}
+	return raw
+}
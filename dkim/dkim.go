@@ -0,0 +1,311 @@
+// Package dkim 验证和生成 DKIM 签名（RFC 6376、RFC 8463），公钥通过 Resolver 接口查询
+package dkim
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrKeyNotFound      = errors.New("dkim key not found")
+	ErrInvalidTagList   = errors.New("invalid tag list")
+	ErrUnsupportedAlgo  = errors.New("unsupported algorithm")
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	ErrNoEmailData      = errors.New("original email data not available, parse the message with EmailParserNew to verify it")
+)
+
+// Resolver 查询 TXT 记录；未找到记录时应返回 ErrKeyNotFound，其它错误视为临时错误
+type Resolver interface {
+	LookupTXT(name string) ([]string, error)
+}
+
+// MapResolver 使用内存中的记录，用于测试和离线验证，键为查询的域名（如 sel._domainkey.example.com）
+type MapResolver map[string][]string
+
+func (m MapResolver) LookupTXT(name string) ([]string, error) {
+	records, ok := m[strings.ToLower(strings.TrimSuffix(name, "."))]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return records, nil
+}
+
+// DNSResolver 使用系统 DNS 查询
+type DNSResolver struct {
+	Resolver *net.Resolver // 为nil时使用 net.DefaultResolver
+}
+
+func (r DNSResolver) LookupTXT(name string) ([]string, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	records, err := resolver.LookupTXT(context.Background(), name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, ErrKeyNotFound
+	}
+	return records, err
+}
+
+// ParseTagList 解析 tag=value 列表（RFC 6376 3.2），值中的空白被保留（去除首尾）
+func ParseTagList(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, value, found := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, ErrInvalidTagList
+		}
+		if _, ok := tags[name]; ok {
+			return nil, fmt.Errorf("duplicate tag %s", name)
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// removeFWS 去除所有空白（用于 base64 值）
+func removeFWS(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Signature 解析后的 DKIM-Signature
+type Signature struct {
+	Version      int
+	Algorithm    string   // a=，如 rsa-sha256
+	Signature    []byte   // b=
+	BodyHash     []byte   // bh=
+	HeaderCanon  string   // c= 头部规范化，simple 或 relaxed
+	BodyCanon    string   // c= 正文规范化，simple 或 relaxed
+	Domain       string   // d=
+	Headers      []string // h=，保留原始大小写
+	Identity     string   // i=，缺省为 @d
+	BodyLength   int64    // l=，-1 表示没有
+	Selector     string   // s=
+	Timestamp    int64    // t=，0 表示没有
+	Expiration   int64    // x=，0 表示没有
+	QueryMethods []string // q=
+	Instance     int      // ARC-Message-Signature 的 i=（ARC 序号），DKIM-Signature 为0
+	Tags         map[string]string
+}
+
+// ParseSignature 解析 DKIM-Signature 头部的值
+func ParseSignature(value string) (*Signature, error) {
+	return parseSignature(value, false)
+}
+
+// ParseARCMessageSignature 解析 ARC-Message-Signature 头部的值：没有 v=，i= 为 ARC 序号
+func ParseARCMessageSignature(value string) (*Signature, error) {
+	return parseSignature(value, true)
+}
+
+// parseARCInstance 解析 ARC 序号（1 到 50）
+func parseARCInstance(value string) (int, error) {
+	instance, err := strconv.Atoi(value)
+	if err != nil || instance < 1 || instance > 50 {
+		return 0, fmt.Errorf("invalid ARC instance %q", value)
+	}
+	return instance, nil
+}
+
+func parseSignature(value string, arc bool) (*Signature, error) {
+	tags, err := ParseTagList(value)
+	if err != nil {
+		return nil, err
+	}
+	required := []string{"v", "a", "b", "bh", "d", "h", "s"}
+	if arc {
+		required[0] = "i"
+	}
+	for _, name := range required {
+		if _, ok := tags[name]; !ok {
+			return nil, fmt.Errorf("missing tag %s", name)
+		}
+	}
+	sig := &Signature{Tags: tags, BodyLength: -1, HeaderCanon: "simple", BodyCanon: "simple"}
+	if arc {
+		if sig.Instance, err = parseARCInstance(tags["i"]); err != nil {
+			return nil, err
+		}
+	} else if tags["v"] != "1" {
+		return nil, fmt.Errorf("unsupported version %q", tags["v"])
+	} else {
+		sig.Version = 1
+	}
+	sig.Algorithm = strings.ToLower(tags["a"])
+	if sig.Signature, err = base64.StdEncoding.DecodeString(removeFWS(tags["b"])); err != nil {
+		return nil, fmt.Errorf("invalid b= tag: %w", err)
+	}
+	if sig.BodyHash, err = base64.StdEncoding.DecodeString(removeFWS(tags["bh"])); err != nil {
+		return nil, fmt.Errorf("invalid bh= tag: %w", err)
+	}
+	if c, ok := tags["c"]; ok {
+		header, body, found := strings.Cut(strings.ToLower(c), "/")
+		sig.HeaderCanon = header
+		if found {
+			sig.BodyCanon = body
+		}
+		for _, canon := range []string{sig.HeaderCanon, sig.BodyCanon} {
+			if canon != "simple" && canon != "relaxed" {
+				return nil, fmt.Errorf("unsupported canonicalization %q", canon)
+			}
+		}
+	}
+	sig.Domain = strings.ToLower(strings.TrimSuffix(tags["d"], "."))
+	sig.Selector = strings.ToLower(tags["s"])
+	for _, name := range strings.Split(tags["h"], ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			sig.Headers = append(sig.Headers, name)
+		}
+	}
+	hasFrom := false
+	for _, name := range sig.Headers {
+		if strings.EqualFold(name, "From") {
+			hasFrom = true
+		}
+		if arc && strings.EqualFold(name, "ARC-Seal") {
+			return nil, errors.New("ARC-Seal must not be signed")
+		}
+	}
+	if !hasFrom {
+		return nil, errors.New("From field not signed")
+	}
+	sig.Identity = "@" + sig.Domain
+	if i, ok := tags["i"]; ok && !arc {
+		sig.Identity = i
+		at := strings.LastIndexByte(i, '@')
+		if at < 0 {
+			return nil, errors.New("invalid i= tag")
+		}
+		domain := strings.ToLower(strings.TrimSuffix(i[at+1:], "."))
+		if domain != sig.Domain && !strings.HasSuffix(domain, "."+sig.Domain) {
+			return nil, errors.New("i= domain is not d= or its subdomain")
+		}
+	}
+	for name, field := range map[string]*int64{"l": &sig.BodyLength, "t": &sig.Timestamp, "x": &sig.Expiration} {
+		if v, ok := tags[name]; ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s= tag", name)
+			}
+			*field = n
+		}
+	}
+	if sig.Expiration > 0 && sig.Timestamp > 0 && sig.Expiration < sig.Timestamp {
+		return nil, errors.New("x= is earlier than t=")
+	}
+	if q, ok := tags["q"]; ok {
+		for _, method := range strings.Split(q, ":") {
+			sig.QueryMethods = append(sig.QueryMethods, strings.TrimSpace(method))
+		}
+	}
+	return sig, nil
+}
+
+// hashAlgorithm 返回签名算法和摘要算法
+func hashAlgorithm(algorithm string) (keyType string, hash crypto.Hash, err error) {
+	switch algorithm {
+	case "rsa-sha256":
+		return "rsa", crypto.SHA256, nil
+	case "ed25519-sha256":
+		return "ed25519", crypto.SHA256, nil
+	}
+	// rsa-sha1 已不再被接受（RFC 8301）
+	return "", 0, ErrUnsupportedAlgo
+}
+
+// PublicKey 解析后的 DKIM 公钥记录
+type PublicKey struct {
+	KeyType  string // k=，缺省为 rsa
+	Key      crypto.PublicKey
+	Hashes   []string // h=，为空表示不限制
+	Services []string // s=
+	Flags    []string // t=，如 y（测试）、s（i= 必须与 d= 相同）
+	Revoked  bool     // p= 为空
+}
+
+// ParsePublicKey 解析 DNS TXT 中的公钥记录
+func ParsePublicKey(record string) (*PublicKey, error) {
+	tags, err := ParseTagList(record)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("unsupported key version %q", v)
+	}
+	p, ok := tags["p"]
+	if !ok {
+		return nil, errors.New("missing p= tag")
+	}
+	key := &PublicKey{KeyType: "rsa"}
+	if k, ok := tags["k"]; ok {
+		key.KeyType = strings.ToLower(k)
+	}
+	for name, field := range map[string]*[]string{"h": &key.Hashes, "s": &key.Services, "t": &key.Flags} {
+		if v, ok := tags[name]; ok {
+			for _, item := range strings.Split(v, ":") {
+				*field = append(*field, strings.ToLower(strings.TrimSpace(item)))
+			}
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(removeFWS(p))
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	if len(data) == 0 {
+		key.Revoked = true
+		return key, nil
+	}
+	switch key.KeyType {
+	case "rsa":
+		pub, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			// 部分记录直接使用 PKCS#1 格式
+			if pub, err = x509.ParsePKCS1PublicKey(data); err != nil {
+				return nil, ErrInvalidPublicKey
+			}
+		}
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidPublicKey
+		}
+		key.Key = rsaKey
+	case "ed25519":
+		if len(data) != ed25519.PublicKeySize {
+			return nil, ErrInvalidPublicKey
+		}
+		key.Key = ed25519.PublicKey(data)
+	default:
+		return nil, ErrUnsupportedAlgo
+	}
+	return key, nil
+}
+
+// hasFlag 判断列表中是否有指定值
+func hasFlag(list []string, flag string) bool {
+	for _, item := range list {
+		if item == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+func TestCanonicalization(t *testing.T) {
+	// RFC 6376 3.4.5 的例子
+	if got := canonicalizeHeader([]byte("A: X\r\n"), "relaxed") + canonicalizeHeader([]byte("B : Y\t\r\n\tZ  \r\n"), "relaxed"); got != "a:X\r\nb:Y Z\r\n" {
+		t.Fatalf("unexpected relaxed header: %q", got)
+	}
+	body := []byte(" C \r\nD \t E\r\n\r\n\r\n")
+	if got := string(canonicalizeBody(body, "relaxed")); got != " C\r\nD E\r\n" {
+		t.Fatalf("unexpected relaxed body: %q", got)
+	}
+	if got := string(canonicalizeBody(body, "simple")); got != " C \r\nD \t E\r\n" {
+		t.Fatalf("unexpected simple body: %q", got)
+	}
+	if string(canonicalizeBody(nil, "simple")) != "\r\n" || len(canonicalizeBody([]byte("\r\n"), "relaxed")) != 0 {
+		t.Fatal("unexpected empty body canonicalization")
+	}
+	raw := "DKIM-Signature: v=1; b=abc\r\n def; bh=xyz\r\n"
+	if got := removeSignatureValue(raw); got != "DKIM-Signature: v=1; b=; bh=xyz\r\n" {
+		t.Fatalf("unexpected b= removal: %q", got)
+	}
+}
+
+const testMessage = "From: Alice <alice@example.com>\n" +
+	"To: bob@example.net\n" +
+	"Subject: hello\n" +
+	"  world\n" +
+	"\n" +
+	"Hi Bob,  \n" +
+	"\n" +
+	"bye\n\n\n"
+
+// testSign 使用与验证相同的规范化规则生成签名头部
+func testSign(t *testing.T, message string, key crypto.Signer, algorithm string, extraTags string) string {
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte(message)})
+	bodyHash, err := computeBodyHash(getBody(parser), "relaxed", -1, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := "v=1; a=" + algorithm + "; c=relaxed/relaxed; d=example.com; s=sel;" + extraTags +
+		"\r\n h=From:To:Subject:Subject; bh=" + base64.StdEncoding.EncodeToString(bodyHash) + "; b="
+	h := crypto.SHA256.New()
+	h.Write(signedHeaderData(parser.GetTopMIMENode(), []string{"From", "To", "Subject", "Subject"}, "relaxed"))
+	h.Write(signatureHeaderData([]byte("DKIM-Signature: "+value), "relaxed"))
+	var opts crypto.SignerOpts = crypto.SHA256
+	if algorithm == "ed25519-sha256" {
+		opts = crypto.Hash(0)
+	}
+	signature, err := key.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "DKIM-Signature: " + value + base64.StdEncoding.EncodeToString(signature) + "\n" + message
+}
+
+func verifyMessage(message string, resolver Resolver) []*Result {
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte(message)})
+	return Verify(parser, VerifyOptions{Resolver: resolver})
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	resolver := MapResolver{
+		"sel._domainkey.example.com": {"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)},
+	}
+
+	signed := testSign(t, testMessage, rsaKey, "rsa-sha256", "")
+	results := verifyMessage(signed, resolver)
+	if len(results) != 1 || results[0].Status != StatusPass || results[0].Signature.Domain != "example.com" {
+		t.Fatalf("unexpected result: %+v", results[0])
+	}
+	// 正文被修改
+	if results := verifyMessage(strings.Replace(signed, "bye", "Bye", 1), resolver); results[0].Status != StatusFail ||
+		results[0].Reason != "body hash did not verify" {
+		t.Fatalf("unexpected result: %+v", results[0])
+	}
+	// 头部被修改
+	if results := verifyMessage(strings.Replace(signed, "Subject: hello", "Subject: Hello", 1), resolver); results[0].Status != StatusFail ||
+		results[0].Reason != "signature did not verify" {
+		t.Fatalf("unexpected result: %+v", results[0])
+	}
+	// 追加第二个 Subject：h= 中签过两次 Subject，空实例也被签名，因此失败
+	if results := verifyMessage(strings.Replace(signed, "\n\nHi", "\nSubject: spoofed\n\nHi", 1), resolver); results[0].Status != StatusFail {
+		t.Fatalf("unexpected result: %+v", results[0])
+	}
+	if results := verifyMessage(signed, MapResolver{}); results[0].Status != StatusPermError {
+		t.Fatalf("unexpected result: %+v", results[0])
+	}
+
+	// l= 之后追加的内容不影响验证
+	canonLen := len(canonicalizeBody([]byte("Hi Bob,  \n\nbye\n"), "relaxed"))
+	signed = testSign(t, testMessage, rsaKey, "rsa-sha256", " l="+strconv.Itoa(canonLen)+";")
+	if results := verifyMessage(signed+"appended\n", resolver); results[0].Status != StatusPass {
+		t.Fatalf("unexpected l= result: %+v", results[0])
+	}
+
+	// x= 已过期
+	signed = testSign(t, testMessage, rsaKey, "rsa-sha256", " t=1000; x=2000;")
+	if results := verifyMessage(signed, resolver); results[0].Status != StatusFail || results[0].Reason != "signature expired" {
+		t.Fatalf("unexpected x= result: %+v", results[0])
+	}
+
+	resolver["sel._domainkey.example.com"] = []string{"v=DKIM1; k=ed25519; t=y; p=" + base64.StdEncoding.EncodeToString(edPublic)}
+	signed = testSign(t, testMessage, edKey, "ed25519-sha256", "")
+	if results := verifyMessage(signed, resolver); results[0].Status != StatusPass || !results[0].Testing {
+		t.Fatalf("unexpected ed25519 result: %+v", results[0])
+	}
+	resolver["sel._domainkey.example.com"] = []string{"v=DKIM1; k=ed25519; p="}
+	if results := verifyMessage(signed, resolver); results[0].Status != StatusPermError || results[0].Reason != "key revoked" {
+		t.Fatalf("unexpected revoked result: %+v", results[0])
+	}
+
+	if results := verifyMessage("DKIM-Signature: v=1; a=rsa-sha256\n"+testMessage, resolver); results[0].Status != StatusNeutral {
+		t.Fatalf("unexpected result: %+v", results[0])
+	}
+	if results := verifyMessage(testMessage, resolver); len(results) != 0 {
+		t.Fatal("unexpected results for unsigned message")
+	}
+}
+
+func TestSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	resolver := MapResolver{
+		"rsa._domainkey.example.com": {"v=DKIM1; p=" + base64.StdEncoding.EncodeToString(der)},
+		"ed._domainkey.example.com":  {"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edPublic)},
+	}
+
+	for _, options := range []SignOptions{
+		{Domain: "example.com", Selector: "rsa", Signer: rsaKey},
+		{Domain: "example.com", Selector: "rsa", Signer: rsaKey, HeaderCanon: "simple", BodyCanon: "simple", BodyLength: true, Expiration: time.Hour},
+		{Domain: "example.com", Selector: "ed", Signer: edKey, Identity: "alice@mail.example.com", Headers: []string{"From", "From", "Subject"}},
+	} {
+		signed, err := Sign([]byte(testMessage), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(signed), "\n") {
+			if len(line) > 78 {
+				t.Fatalf("line too long: %q", line)
+			}
+		}
+		results := verifyMessage(string(signed), resolver)
+		if len(results) != 1 || results[0].Status != StatusPass {
+			t.Fatalf("%s/%s: unexpected result: %+v\n%s", options.HeaderCanon, options.Selector, results[0], signed)
+		}
+	}
+
+	// 修改后的邮件再签名，原有签名因 Subject 改变而失效
+	signed, _ := Sign([]byte(testMessage), SignOptions{Domain: "example.com", Selector: "rsa", Signer: rsaKey})
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: signed})
+	parser.GetTopMIMENode().ReplaceHeader("Subject", "[list] hello")
+	if err := SignParser(parser, SignOptions{Domain: "example.com", Selector: "ed", Signer: edKey}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := parser.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := verifyMessage(string(data), resolver)
+	if len(results) != 2 || results[0].Status != StatusPass || results[1].Status != StatusFail {
+		t.Fatalf("unexpected results: %+v %+v", results[0], results[1])
+	}
+
+	if _, err := Sign([]byte("Subject: x\r\n\r\nbody\r\n"), SignOptions{Domain: "example.com", Selector: "rsa", Signer: rsaKey}); err != ErrFromNotSigned {
+		t.Fatalf("expected ErrFromNotSigned, got %v", err)
+	}
+	// 流式解析的邮件没有原始数据，无法验证
+	stream, err := emailparser.EmailParserNewFromReader(emailparser.EmailParserStreamOptions{Reader: bytes.NewReader(signed)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = Verify(stream, VerifyOptions{Resolver: resolver})
+	if len(results) != 1 || results[0].Status != StatusTempError || results[0].Reason != ErrNoEmailData.Error() {
+		t.Fatalf("unexpected result: %+v", results)
+	}
+}
+
+func TestARC(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	resolver := MapResolver{
+		"arc._domainkey.forwarder.example": {"v=DKIM1; p=" + base64.StdEncoding.EncodeToString(der)},
+		"arc._domainkey.list.example":      {"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edPublic)},
+	}
+	verifyARC := func(message []byte) *ARCResult {
+		parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: message})
+		return VerifyARC(parser, VerifyOptions{Resolver: resolver})
+	}
+	hop1 := ARCSealOptions{
+		SignOptions: SignOptions{Domain: "forwarder.example", Selector: "arc", Signer: rsaKey},
+		AuthServID:  "mx.forwarder.example",
+		AuthResults: "spf=pass smtp.mailfrom=example.com",
+		Verify:      VerifyOptions{Resolver: resolver},
+	}
+	hop2 := ARCSealOptions{
+		SignOptions: SignOptions{Domain: "list.example", Selector: "arc", Signer: edKey},
+		AuthServID:  "mx.list.example",
+		AuthResults: "arc=pass",
+		Verify:      VerifyOptions{Resolver: resolver},
+	}
+
+	if result := verifyARC([]byte(testMessage)); result.Status != StatusNone {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	sealed1, err := SealARC([]byte(testMessage), hop1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := verifyARC(sealed1)
+	if result.Status != StatusPass || len(result.Sets) != 1 || result.Sets[0].Seal.ChainValidation != StatusNone ||
+		result.Sets[0].AuthenticationResults != "mx.forwarder.example; spf=pass smtp.mailfrom=example.com" {
+		t.Fatalf("unexpected result: %+v\n%s", result, sealed1)
+	}
+
+	sealed2, err := SealARC(sealed1, hop2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = verifyARC(sealed2)
+	if result.Status != StatusPass || len(result.Sets) != 2 || result.Sets[1].Seal.ChainValidation != StatusPass {
+		t.Fatalf("unexpected result: %+v\n%s", result, sealed2)
+	}
+	// 修改第一组的认证结果，覆盖它的 ARC-Seal 失效
+	tampered := strings.Replace(string(sealed2), "spf=pass", "spf=fail", 1)
+	if result := verifyARC([]byte(tampered)); result.Status != StatusFail || !strings.HasPrefix(result.Reason, "ARC-Seal i=2") {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	// 邮件列表修改正文后，原链失效，新的一组记录 cv=fail，之后不再添加
+	modified := append(append([]byte(nil), sealed1...), "-- \nlist footer\n"...)
+	sealed2, err = SealARC(modified, hop2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := verifyARC(sealed2); result.Status != StatusFail || result.Sets[1].Seal.ChainValidation != StatusFail {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if _, err := SealARC(sealed2, hop1); err != ErrARCChainFailed {
+		t.Fatalf("expected ErrARCChainFailed, got %v", err)
+	}
+	stream, err := emailparser.EmailParserNewFromReader(emailparser.EmailParserStreamOptions{Reader: bytes.NewReader(sealed1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := VerifyARC(stream, VerifyOptions{Resolver: resolver}); result.Status != StatusTempError || result.Reason != ErrNoEmailData.Error() {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
@@ -0,0 +1,225 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// DefaultSignedHeaders 缺省签名的头部，只签名邮件中存在的
+var DefaultSignedHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc",
+	"Resent-Date", "Resent-From", "Resent-To", "Resent-Cc",
+	"In-Reply-To", "References", "Message-ID",
+	"List-Id", "List-Help", "List-Unsubscribe", "List-Unsubscribe-Post", "List-Subscribe", "List-Post", "List-Owner", "List-Archive",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// SignOptions 签名参数
+type SignOptions struct {
+	Domain      string        // d=
+	Selector    string        // s=
+	Signer      crypto.Signer // *rsa.PrivateKey 或 ed25519.PrivateKey
+	Identity    string        // i=，为空时不输出
+	HeaderCanon string        // simple 或 relaxed，为空表示 relaxed
+	BodyCanon   string        // simple 或 relaxed，为空表示 relaxed
+	Headers     []string      // 签名的头部，原样使用（可重复以防止追加同名头部）；为空时使用 DefaultSignedHeaders 中存在的
+	BodyLength  bool          // 是否输出 l=
+	Time        time.Time     // t=，零值表示当前时间
+	Expiration  time.Duration // x= 相对 t= 的有效期，0 表示不输出
+}
+
+var ErrFromNotSigned = errors.New("From field must be signed")
+
+// headerFolder 生成折行的头部值，每行不超过 78 个字符
+type headerFolder struct {
+	sb      strings.Builder
+	lineLen int
+}
+
+// add 追加 sep 和 atom，放不下时在 sep 之后折行
+func (f *headerFolder) add(sep string, atom string) {
+	if f.lineLen+len(sep)+len(atom) > 78 && f.lineLen > 1 {
+		f.sb.WriteString(strings.TrimRight(sep, " "))
+		f.sb.WriteString("\r\n\t")
+		f.lineLen = 1
+	} else {
+		f.sb.WriteString(sep)
+		f.lineLen += len(sep)
+	}
+	f.sb.WriteString(atom)
+	f.lineLen += len(atom)
+}
+
+// addBase64 追加 base64 值，在任意位置折行
+func (f *headerFolder) addBase64(value string) {
+	for len(value) > 0 {
+		room := 78 - f.lineLen
+		if room <= 0 {
+			f.sb.WriteString("\r\n\t")
+			f.lineLen = 1
+			room = 77
+		}
+		n := min(room, len(value))
+		f.sb.WriteString(value[:n])
+		f.lineLen += n
+		value = value[n:]
+	}
+}
+
+// signingAlgorithm 根据私钥类型返回 a= 和签名参数
+func signingAlgorithm(signer crypto.Signer) (string, crypto.SignerOpts, error) {
+	if signer == nil {
+		return "", nil, errors.New("no signer")
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		return "rsa-sha256", crypto.SHA256, nil
+	case ed25519.PublicKey:
+		// Ed25519 直接对摘要签名（RFC 8463）
+		return "ed25519-sha256", crypto.Hash(0), nil
+	}
+	return "", nil, ErrUnsupportedAlgo
+}
+
+func (o *SignOptions) setDefaults() {
+	if o.HeaderCanon == "" {
+		o.HeaderCanon = "relaxed"
+	}
+	if o.BodyCanon == "" {
+		o.BodyCanon = "relaxed"
+	}
+	if o.Time.IsZero() {
+		o.Time = time.Now()
+	}
+}
+
+// signMessage 生成 DKIM-Signature 或 ARC-Message-Signature 的值（已折行），firstTag 为 "v=1;" 或 "i=N;"
+func signMessage(top *emailparser.MIMENode, body []byte, headerName string, firstTag string, options *SignOptions) (string, error) {
+	algorithm, signerOpts, err := signingAlgorithm(options.Signer)
+	if err != nil {
+		return "", err
+	}
+	headers := options.Headers
+	if len(headers) == 0 {
+		for _, name := range DefaultSignedHeaders {
+			if hasHeader(top, name) {
+				headers = append(headers, name)
+			}
+		}
+	}
+	hasFrom := false
+	for _, name := range headers {
+		if strings.EqualFold(name, "From") {
+			hasFrom = true
+		}
+	}
+	if !hasFrom {
+		return "", ErrFromNotSigned
+	}
+
+	body = canonicalizeBody(body, options.BodyCanon)
+	h := crypto.SHA256.New()
+	h.Write(body)
+	bodyHash := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	folder := &headerFolder{lineLen: len(headerName) + 2}
+	folder.add("", firstTag)
+	folder.add(" ", "a="+algorithm+";")
+	folder.add(" ", "c="+options.HeaderCanon+"/"+options.BodyCanon+";")
+	folder.add(" ", "d="+options.Domain+";")
+	folder.add(" ", "s="+options.Selector+";")
+	folder.add(" ", "t="+strconv.FormatInt(options.Time.Unix(), 10)+";")
+	if options.Expiration > 0 {
+		folder.add(" ", "x="+strconv.FormatInt(options.Time.Add(options.Expiration).Unix(), 10)+";")
+	}
+	if options.Identity != "" {
+		folder.add(" ", "i="+options.Identity+";")
+	}
+	if options.BodyLength {
+		folder.add(" ", "l="+strconv.Itoa(len(body))+";")
+	}
+	for i, name := range headers {
+		atom := name
+		if i == 0 {
+			atom = "h=" + name
+		}
+		if i == len(headers)-1 {
+			atom += ";"
+		}
+		sep := ":"
+		if i == 0 {
+			sep = " "
+		}
+		folder.add(sep, atom)
+	}
+	folder.add(" ", "bh="+bodyHash+";")
+	folder.add(" ", "b=")
+
+	h = crypto.SHA256.New()
+	h.Write(signedHeaderData(top, headers, options.HeaderCanon))
+	h.Write(signatureHeaderData([]byte(headerName+": "+folder.sb.String()), options.HeaderCanon))
+	signature, err := options.Signer.Sign(rand.Reader, h.Sum(nil), signerOpts)
+	if err != nil {
+		return "", err
+	}
+	folder.addBase64(base64.StdEncoding.EncodeToString(signature))
+	return folder.sb.String(), nil
+}
+
+// reparse 重新解析（可能已修改的）邮件，签名按修改后的内容计算
+func reparse(parser *emailparser.EmailParser) (*emailparser.EmailParser, error) {
+	data, err := parser.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return emailparser.EmailParserNew(emailparser.EmailParserOptions{
+		EmailData:       data,
+		MaxNestingDepth: -1,
+	}), nil
+}
+
+// SignParser 对邮件（包括已修改的邮件）签名，在顶层头部最前面插入 DKIM-Signature
+func SignParser(parser *emailparser.EmailParser, options SignOptions) error {
+	options.setDefaults()
+	signed, err := reparse(parser)
+	if err != nil {
+		return err
+	}
+	value, err := signMessage(signed.GetTopMIMENode(), getBody(signed), "DKIM-Signature", "v=1;", &options)
+	if err != nil {
+		return err
+	}
+	return parser.GetTopMIMENode().PrependHeader("DKIM-Signature", value)
+}
+
+// hasHeader 判断头部是否存在
+func hasHeader(node *emailparser.MIMENode, name string) bool {
+	name = strings.ToUpper(name)
+	for _, line := range node.Header {
+		if line.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign 对原始邮件签名，返回插入 DKIM-Signature 后的邮件
+func Sign(data []byte, options SignOptions) ([]byte, error) {
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{
+		EmailData:       data,
+		MaxNestingDepth: -1,
+	})
+	if err := SignParser(parser, options); err != nil {
+		return nil, err
+	}
+	return parser.Serialize()
+}
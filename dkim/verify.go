@@ -0,0 +1,240 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// Status 验证结果（RFC 8601 2.7.1）
+type Status string
+
+const (
+	StatusPass      Status = "pass"
+	StatusFail      Status = "fail"
+	StatusNeutral   Status = "neutral"
+	StatusTempError Status = "temperror"
+	StatusPermError Status = "permerror"
+)
+
+// Result 一个 DKIM-Signature 的验证结果
+type Result struct {
+	Status    Status
+	Reason    string     // 非 pass 时的原因
+	Signature *Signature // 签名无法解析时为nil
+	Testing   bool       // 公钥记录中有 t=y
+}
+
+// VerifyOptions 验证参数
+type VerifyOptions struct {
+	Resolver      Resolver  // 为nil时使用 DNSResolver
+	CurrentTime   time.Time // 判断 x= 过期的时间，零值表示当前时间
+	MaxSignatures int       // 最多验证的签名数，0 表示 16
+	MinRSAKeyBits int       // RSA 公钥最小长度，0 表示 1024（RFC 8301）
+}
+
+func (o *VerifyOptions) setDefaults() {
+	if o.Resolver == nil {
+		o.Resolver = DNSResolver{}
+	}
+	if o.CurrentTime.IsZero() {
+		o.CurrentTime = time.Now()
+	}
+	if o.MaxSignatures == 0 {
+		o.MaxSignatures = 16
+	}
+	if o.MinRSAKeyBits == 0 {
+		o.MinRSAKeyBits = 1024
+	}
+}
+
+// signedHeaderData 按 h= 列表取出并规范化头部：同名头部从下往上依次使用，不存在的头部不输出
+func signedHeaderData(node *emailparser.MIMENode, names []string, canon string) []byte {
+	var buf bytes.Buffer
+	used := make(map[string]int)
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		skip := used[name]
+		used[name]++
+		for i := len(node.Header) - 1; i >= 0; i-- {
+			if node.Header[i].Name != name {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			buf.WriteString(canonicalizeHeader(node.GetRawHeaderLine(node.Header[i]), canon))
+			break
+		}
+	}
+	return buf.Bytes()
+}
+
+// signatureHeaderData 返回清空 b= 后规范化的 DKIM-Signature 头部，不含结尾的 CRLF
+func signatureHeaderData(raw []byte, canon string) []byte {
+	s := canonicalizeHeader([]byte(removeSignatureValue(string(raw))), canon)
+	return []byte(strings.TrimSuffix(s, "\r\n"))
+}
+
+// computeBodyHash 计算正文摘要，l= 大于正文长度时返回错误
+func computeBodyHash(body []byte, canon string, length int64, hash crypto.Hash) ([]byte, error) {
+	data := canonicalizeBody(body, canon)
+	if length >= 0 {
+		if length > int64(len(data)) {
+			return nil, errors.New("l= exceeds body length")
+		}
+		data = data[:length]
+	}
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// getBody 返回顶层正文的原始数据
+func getBody(parser *emailparser.EmailParser) []byte {
+	top := parser.GetTopMIMENode()
+	if top.BodyStart > len(parser.EmailData) {
+		return []byte{}
+	}
+	return parser.EmailData[top.BodyStart:]
+}
+
+// hasEmailData 是否保存了完整的原始邮件；流式解析（EmailParserNewFromReader）的邮件没有原始的头部和正文，无法验证
+func hasEmailData(parser *emailparser.EmailParser) bool {
+	top := parser.GetTopMIMENode()
+	return top.HeaderStart >= 0 && top.BodyStart+top.BodyLen <= len(parser.EmailData)
+}
+
+// Verify 验证邮件顶层头部中的所有 DKIM-Signature，按头部顺序返回结果；没有签名时返回空
+// 邮件没有保存原始数据时，每个签名的结果为 temperror，原因为 ErrNoEmailData
+func Verify(parser *emailparser.EmailParser, options VerifyOptions) []*Result {
+	options.setDefaults()
+	top := parser.GetTopMIMENode()
+	available := hasEmailData(parser)
+	body := getBody(parser)
+	var results []*Result
+	for _, line := range top.Header {
+		if line.Name != "DKIM-SIGNATURE" {
+			continue
+		}
+		if len(results) >= options.MaxSignatures {
+			break
+		}
+		if !available {
+			results = append(results, &Result{Status: StatusTempError, Reason: ErrNoEmailData.Error()})
+			continue
+		}
+		results = append(results, verifySignature(top, top.GetRawHeaderLine(line), body, &options))
+	}
+	return results
+}
+
+func verifySignature(top *emailparser.MIMENode, raw []byte, body []byte, options *VerifyOptions) *Result {
+	_, value, _ := strings.Cut(string(raw), ":")
+	sig, err := ParseSignature(value)
+	if err != nil {
+		return &Result{Status: StatusNeutral, Reason: "invalid signature: " + err.Error()}
+	}
+	return verifyParsedSignature(top, raw, sig, body, options)
+}
+
+// resolveKey 查询公钥并检查类型、摘要算法、用途和长度，失败时返回结果状态和原因
+func resolveKey(options *VerifyOptions, selector string, domain string, keyType string) (*PublicKey, Status, string) {
+	records, err := options.Resolver.LookupTXT(selector + "._domainkey." + domain)
+	if err == ErrKeyNotFound || (err == nil && len(records) == 0) {
+		return nil, StatusPermError, "no key for signature"
+	} else if err != nil {
+		return nil, StatusTempError, "key lookup failed: " + err.Error()
+	}
+	var key *PublicKey
+	for _, record := range records {
+		if key, err = ParsePublicKey(record); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, StatusPermError, "invalid key: " + err.Error()
+	}
+	switch {
+	case key.Revoked:
+		return key, StatusPermError, "key revoked"
+	case key.KeyType != keyType:
+		return key, StatusPermError, "key type mismatch"
+	case len(key.Hashes) > 0 && !hasFlag(key.Hashes, "sha256"):
+		return key, StatusPermError, "hash algorithm not allowed by key"
+	case len(key.Services) > 0 && !hasFlag(key.Services, "*") && !hasFlag(key.Services, "email"):
+		return key, StatusPermError, "key not for email"
+	}
+	if rsaKey, ok := key.Key.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < options.MinRSAKeyBits {
+		return key, StatusPermError, fmt.Sprintf("key too short (%d bits)", rsaKey.N.BitLen())
+	}
+	return key, StatusPass, ""
+}
+
+// verifyDigest 验证对摘要的签名
+func verifyDigest(key crypto.PublicKey, hash crypto.Hash, digest []byte, signature []byte) bool {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, digest, signature)
+	}
+	return false
+}
+
+// verifyParsedSignature 验证 DKIM-Signature 或 ARC-Message-Signature，raw 为签名头部的原始数据
+func verifyParsedSignature(top *emailparser.MIMENode, raw []byte, sig *Signature, body []byte, options *VerifyOptions) *Result {
+	result := &Result{Signature: sig}
+	fail := func(status Status, reason string) *Result {
+		result.Status = status
+		result.Reason = reason
+		return result
+	}
+
+	keyType, hash, err := hashAlgorithm(sig.Algorithm)
+	if err != nil {
+		return fail(StatusNeutral, "unsupported algorithm "+sig.Algorithm)
+	}
+	if len(sig.QueryMethods) > 0 && !hasFlag(sig.QueryMethods, "dns/txt") {
+		return fail(StatusNeutral, "unsupported query method")
+	}
+	if sig.Expiration > 0 && options.CurrentTime.Unix() > sig.Expiration {
+		return fail(StatusFail, "signature expired")
+	}
+
+	key, status, reason := resolveKey(options, sig.Selector, sig.Domain, keyType)
+	if key != nil {
+		result.Testing = hasFlag(key.Flags, "y")
+	}
+	if status != StatusPass {
+		return fail(status, reason)
+	}
+	if hasFlag(key.Flags, "s") && !strings.EqualFold(sig.Identity[strings.LastIndexByte(sig.Identity, '@')+1:], sig.Domain) {
+		return fail(StatusPermError, "i= domain must equal d= for this key")
+	}
+
+	bodyHash, err := computeBodyHash(body, sig.BodyCanon, sig.BodyLength, hash)
+	if err != nil {
+		return fail(StatusFail, err.Error())
+	}
+	if !bytes.Equal(bodyHash, sig.BodyHash) {
+		return fail(StatusFail, "body hash did not verify")
+	}
+
+	h := hash.New()
+	h.Write(signedHeaderData(top, sig.Headers, sig.HeaderCanon))
+	h.Write(signatureHeaderData(raw, sig.HeaderCanon))
+	if !verifyDigest(key.Key, hash, h.Sum(nil), sig.Signature) {
+		return fail(StatusFail, "signature did not verify")
+	}
+	result.Status = StatusPass
+	return result
+}
@@ -0,0 +1,170 @@
+// Package dmarc 实现 DMARC 策略查询、标识符对齐和处置计算（RFC 7489），
+// 策略记录通过 Resolver 接口查询，组织域名使用内嵌的公共后缀列表计算
+package dmarc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mailhonor/go-email/dkim"
+)
+
+var ErrNotFound = errors.New("dmarc record not found")
+
+// Resolver 查询 TXT 记录；未找到记录时应返回 ErrNotFound，其它错误视为临时错误
+type Resolver interface {
+	LookupTXT(name string) ([]string, error)
+}
+
+// MapResolver 使用内存中的记录，用于测试和离线评估，键为查询的域名（如 _dmarc.example.com）
+type MapResolver map[string][]string
+
+func (m MapResolver) LookupTXT(name string) ([]string, error) {
+	records, ok := m[strings.ToLower(strings.TrimSuffix(name, "."))]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return records, nil
+}
+
+// DNSResolver 使用系统 DNS 查询
+type DNSResolver struct {
+	Resolver *net.Resolver // 为nil时使用 net.DefaultResolver
+}
+
+func (r DNSResolver) LookupTXT(name string) ([]string, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	records, err := resolver.LookupTXT(context.Background(), name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, ErrNotFound
+	}
+	return records, err
+}
+
+// Disposition 处置策略
+type Disposition string
+
+const (
+	DispositionNone       Disposition = "none"
+	DispositionQuarantine Disposition = "quarantine"
+	DispositionReject     Disposition = "reject"
+)
+
+func parseDisposition(value string) (Disposition, bool) {
+	switch d := Disposition(strings.ToLower(value)); d {
+	case DispositionNone, DispositionQuarantine, DispositionReject:
+		return d, true
+	}
+	return "", false
+}
+
+// Record 解析后的 DMARC 记录
+type Record struct {
+	Policy              Disposition // p=
+	SubdomainPolicy     Disposition // sp=，未指定时为空（使用 p=）
+	DKIMAlignment       string      // adkim=，"r" 或 "s"
+	SPFAlignment        string      // aspf=，"r" 或 "s"
+	Percent             int         // pct=，缺省 100
+	AggregateReportURIs []string    // rua=
+	FailureReportURIs   []string    // ruf=
+	FailureOptions      string      // fo=，缺省 "0"
+	ReportFormat        string      // rf=，缺省 "afrf"
+	ReportInterval      int         // ri=，缺省 86400
+	Tags                map[string]string
+}
+
+// isDMARCRecord 判断 TXT 记录是否以 v=DMARC1 开头
+func isDMARCRecord(txt string) bool {
+	name, value, found := strings.Cut(strings.TrimSpace(txt), "=")
+	if !found || strings.TrimSpace(name) != "v" {
+		return false
+	}
+	value, _, _ = strings.Cut(value, ";")
+	return strings.TrimSpace(value) == "DMARC1"
+}
+
+func splitURIs(value string) []string {
+	var uris []string
+	for _, uri := range strings.Split(value, ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// ParseRecord 解析 DMARC 记录（RFC 7489 6.3）
+func ParseRecord(txt string) (*Record, error) {
+	if !isDMARCRecord(txt) {
+		return nil, errors.New("not a DMARC record")
+	}
+	tags, err := dkim.ParseTagList(txt)
+	if err != nil {
+		return nil, err
+	}
+	record := &Record{
+		DKIMAlignment:  "r",
+		SPFAlignment:   "r",
+		Percent:        100,
+		FailureOptions: "0",
+		ReportFormat:   "afrf",
+		ReportInterval: 86400,
+		Tags:           tags,
+	}
+	record.AggregateReportURIs = splitURIs(tags["rua"])
+	record.FailureReportURIs = splitURIs(tags["ruf"])
+	if p, ok := tags["p"]; ok {
+		if record.Policy, ok = parseDisposition(p); !ok {
+			return nil, fmt.Errorf("invalid p= tag %q", p)
+		}
+	} else if len(record.AggregateReportURIs) > 0 {
+		// 缺少 p= 但有 rua= 时按 p=none 处理（RFC 7489 6.6.3）
+		record.Policy = DispositionNone
+	} else {
+		return nil, errors.New("missing p= tag")
+	}
+	if sp, ok := tags["sp"]; ok {
+		if record.SubdomainPolicy, ok = parseDisposition(sp); !ok {
+			return nil, fmt.Errorf("invalid sp= tag %q", sp)
+		}
+	}
+	for _, alignment := range []struct {
+		name  string
+		field *string
+	}{{"adkim", &record.DKIMAlignment}, {"aspf", &record.SPFAlignment}} {
+		if value, ok := tags[alignment.name]; ok {
+			value = strings.ToLower(value)
+			if value != "r" && value != "s" {
+				return nil, fmt.Errorf("invalid %s= tag %q", alignment.name, value)
+			}
+			*alignment.field = value
+		}
+	}
+	if pct, ok := tags["pct"]; ok {
+		n, err := strconv.Atoi(pct)
+		if err != nil || n < 0 || n > 100 {
+			return nil, fmt.Errorf("invalid pct= tag %q", pct)
+		}
+		record.Percent = n
+	}
+	if fo, ok := tags["fo"]; ok {
+		record.FailureOptions = fo
+	}
+	if rf, ok := tags["rf"]; ok {
+		record.ReportFormat = strings.ToLower(rf)
+	}
+	if ri, ok := tags["ri"]; ok {
+		if n, err := strconv.Atoi(ri); err == nil && n > 0 {
+			record.ReportInterval = n
+		}
+	}
+	return record, nil
+}
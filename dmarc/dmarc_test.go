@@ -0,0 +1,101 @@
+package dmarc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mailhonor/go-email/dkim"
+	"github.com/mailhonor/go-email/emailparser"
+	"github.com/mailhonor/go-email/spf"
+)
+
+func TestOrganizationalDomain(t *testing.T) {
+	tests := map[string]string{
+		"example.com":              "example.com",
+		"mail.example.com":         "example.com",
+		"a.b.example.co.uk":        "example.co.uk",
+		"foo.bar.kawasaki.jp":      "foo.bar.kawasaki.jp",
+		"www.city.kawasaki.jp":     "city.kawasaki.jp",
+		"com":                      "com",
+		"Mail.Example.Unknowntld.": "example.unknowntld",
+	}
+	for domain, expected := range tests {
+		if org := OrganizationalDomain(domain); org != expected {
+			t.Fatalf("%s: expected %s, got %s", domain, expected, org)
+		}
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	record, err := ParseRecord("v=DMARC1; p=Reject; sp=none; adkim=s; pct=20; rua=mailto:a@example.com, mailto:b@example.com")
+	if err != nil || record.Policy != DispositionReject || record.SubdomainPolicy != DispositionNone || record.DKIMAlignment != "s" ||
+		record.SPFAlignment != "r" || record.Percent != 20 || len(record.AggregateReportURIs) != 2 || record.ReportInterval != 86400 {
+		t.Fatalf("unexpected record: %+v %v", record, err)
+	}
+	if record, err = ParseRecord("v=DMARC1; rua=mailto:a@example.com"); err != nil || record.Policy != DispositionNone {
+		t.Fatalf("unexpected record: %+v %v", record, err)
+	}
+	for _, txt := range []string{"v=DMARC1", "v=DMARC1; p=block", "v=DMARC1; p=none; aspf=x", "v=DMARC1; p=none; pct=101", "p=none; v=DMARC1", "v=spf1 -all"} {
+		if _, err := ParseRecord(txt); err == nil {
+			t.Fatalf("%s: expected error", txt)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	resolver := MapResolver{
+		"_dmarc.example.com":  {"v=DMARC1; p=reject; sp=quarantine; pct=50"},
+		"_dmarc.strict.org":   {"v=DMARC1; p=quarantine; adkim=s; aspf=s"},
+		"_dmarc.multiple.net": {"v=DMARC1; p=reject", "v=DMARC1; p=none"},
+	}
+	options := EvaluateOptions{Resolver: resolver, Sample: func(percent int) bool { return percent > 40 }}
+	dkimPass := func(domain string) []*dkim.Result {
+		return []*dkim.Result{{Status: dkim.StatusFail, Signature: &dkim.Signature{Domain: "example.com"}}, {Status: dkim.StatusPass, Signature: &dkim.Signature{Domain: domain}}}
+	}
+	spfPass := func(domain string) *spf.Result {
+		return &spf.Result{Status: spf.StatusPass, Domain: domain}
+	}
+
+	result := Evaluate("news.example.com", dkimPass("example.com"), nil, options)
+	if result.Status != StatusPass || !result.DKIMAligned || result.SPFAligned || result.PolicyDomain != "example.com" ||
+		result.Policy != DispositionQuarantine || result.Disposition != DispositionNone {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	result = Evaluate("example.com", dkimPass("other.com"), spfPass("bounces.example.com"), options)
+	if result.Status != StatusPass || result.DKIMAligned || !result.SPFAligned || result.SPFDomain != "bounces.example.com" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	result = Evaluate("example.com", dkimPass("other.com"), &spf.Result{Status: spf.StatusFail, Domain: "example.com"}, options)
+	if result.Status != StatusFail || result.Policy != DispositionReject || !result.Sampled || result.Disposition != DispositionReject {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	options.Sample = func(int) bool { return false }
+	if result = Evaluate("example.com", nil, nil, options); result.Disposition != DispositionQuarantine || result.Sampled {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result = Evaluate("sub.example.com", nil, nil, options); result.Policy != DispositionQuarantine || result.Disposition != DispositionNone {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	result = Evaluate("strict.org", dkimPass("mail.strict.org"), spfPass("mail.strict.org"), options)
+	if result.Status != StatusFail || result.DKIMAligned || result.SPFAligned || result.Disposition != DispositionQuarantine {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result = Evaluate("multiple.net", nil, nil, options); result.Status != StatusNone || result.Disposition != DispositionNone {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	failing := EvaluateOptions{Resolver: errorResolver{}}
+	if result = Evaluate("example.com", nil, nil, failing); result.Status != StatusTempError {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte("From: Alice <alice@Example.COM>\r\n\r\nbody\r\n")})
+	if result = EvaluateParser(parser, dkimPass("example.com"), nil, options); result.Status != StatusPass || result.FromDomain != "example.com" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+type errorResolver struct{}
+
+func (errorResolver) LookupTXT(name string) ([]string, error) {
+	return nil, errors.New("SERVFAIL")
+}
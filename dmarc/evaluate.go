@@ -0,0 +1,176 @@
+package dmarc
+
+import (
+	"math/rand/v2"
+	"strings"
+
+	"github.com/mailhonor/go-email/dkim"
+	"github.com/mailhonor/go-email/emailparser"
+	"github.com/mailhonor/go-email/spf"
+)
+
+// Status DMARC 评估结果
+type Status string
+
+const (
+	StatusPass      Status = "pass"
+	StatusFail      Status = "fail"
+	StatusNone      Status = "none" // 没有 DMARC 记录
+	StatusTempError Status = "temperror"
+	StatusPermError Status = "permerror"
+)
+
+// EvaluateOptions 评估参数
+type EvaluateOptions struct {
+	Resolver         Resolver               // 为nil时使用 DNSResolver
+	PublicSuffixList *PublicSuffixList      // 为nil时使用内嵌的列表
+	Sample           func(percent int) bool // pct= 抽样，返回 true 表示对本邮件应用策略；为nil时随机抽样
+}
+
+func (o *EvaluateOptions) setDefaults() {
+	if o.Resolver == nil {
+		o.Resolver = DNSResolver{}
+	}
+	if o.PublicSuffixList == nil {
+		o.PublicSuffixList = DefaultPublicSuffixList()
+	}
+	if o.Sample == nil {
+		o.Sample = func(percent int) bool {
+			return rand.IntN(100) < percent
+		}
+	}
+}
+
+// Result DMARC 评估结果
+type Result struct {
+	Status               Status
+	Reason               string
+	FromDomain           string
+	OrganizationalDomain string      // From 域名的组织域名
+	PolicyDomain         string      // 找到 DMARC 记录的域名（From 域名或组织域名）
+	Record               *Record     // 没有记录时为nil
+	Policy               Disposition // 适用的策略：p=，记录来自组织域名且指定了 sp= 时为 sp=
+	Disposition          Disposition // 实际处置，未通过且不在 pct 抽样范围内时降低一级
+	Sampled              bool        // 未通过时是否在 pct 抽样范围内
+	DKIMAligned          bool
+	DKIMDomain           string // 通过且对齐的 DKIM 签名的 d=
+	SPFAligned           bool
+	SPFDomain            string // 通过且对齐的 SPF 域名
+}
+
+// aligned 判断标识符是否与 From 域名对齐，mode 为 "s"（严格）或 "r"（宽松）
+func aligned(domain string, fromDomain string, mode string, list *PublicSuffixList) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" {
+		return false
+	}
+	if domain == fromDomain {
+		return true
+	}
+	return mode != "s" && list.OrganizationalDomain(domain) == list.OrganizationalDomain(fromDomain)
+}
+
+// lookupRecord 查询一个域名的 DMARC 记录；没有或有多条有效记录时返回nil
+func lookupRecord(resolver Resolver, domain string) (*Record, error) {
+	txts, err := resolver.LookupTXT("_dmarc." + domain)
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	for _, txt := range txts {
+		if !isDMARCRecord(txt) {
+			continue
+		}
+		// 无效的记录视为不存在（RFC 7489 6.6.3）
+		if record, err := ParseRecord(txt); err == nil {
+			records = append(records, record)
+		}
+	}
+	if len(records) != 1 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+// Evaluate 根据 From 域名、DKIM 验证结果和 SPF 检查结果评估 DMARC（RFC 7489 6.6）
+func Evaluate(fromDomain string, dkimResults []*dkim.Result, spfResult *spf.Result, options EvaluateOptions) *Result {
+	options.setDefaults()
+	list := options.PublicSuffixList
+	fromDomain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(fromDomain), "."))
+	result := &Result{FromDomain: fromDomain, Disposition: DispositionNone}
+	if fromDomain == "" {
+		result.Status = StatusPermError
+		result.Reason = "no From domain"
+		return result
+	}
+	result.OrganizationalDomain = list.OrganizationalDomain(fromDomain)
+
+	// 策略查询：先查 From 域名，没有时查组织域名
+	record, err := lookupRecord(options.Resolver, fromDomain)
+	result.PolicyDomain = fromDomain
+	if err == nil && record == nil && result.OrganizationalDomain != fromDomain {
+		record, err = lookupRecord(options.Resolver, result.OrganizationalDomain)
+		result.PolicyDomain = result.OrganizationalDomain
+	}
+	if err != nil {
+		result.Status = StatusTempError
+		result.Reason = "DNS lookup failed: " + err.Error()
+		return result
+	}
+
+	dkimMode, spfMode := "r", "r"
+	if record != nil {
+		dkimMode, spfMode = record.DKIMAlignment, record.SPFAlignment
+	}
+	for _, r := range dkimResults {
+		if r.Status == dkim.StatusPass && r.Signature != nil && aligned(r.Signature.Domain, fromDomain, dkimMode, list) {
+			result.DKIMAligned = true
+			result.DKIMDomain = r.Signature.Domain
+			break
+		}
+	}
+	if spfResult != nil && spfResult.Status == spf.StatusPass && aligned(spfResult.Domain, fromDomain, spfMode, list) {
+		result.SPFAligned = true
+		result.SPFDomain = spfResult.Domain
+	}
+
+	if record == nil {
+		result.Status = StatusNone
+		result.PolicyDomain = ""
+		return result
+	}
+	result.Record = record
+	result.Policy = record.Policy
+	if result.PolicyDomain != fromDomain && record.SubdomainPolicy != "" {
+		result.Policy = record.SubdomainPolicy
+	}
+	if result.DKIMAligned || result.SPFAligned {
+		result.Status = StatusPass
+		return result
+	}
+
+	result.Status = StatusFail
+	result.Sampled = record.Percent >= 100 || options.Sample(record.Percent)
+	result.Disposition = result.Policy
+	if !result.Sampled {
+		// 不在抽样范围内时降低一级（RFC 7489 6.6.4）
+		switch result.Policy {
+		case DispositionReject:
+			result.Disposition = DispositionQuarantine
+		case DispositionQuarantine:
+			result.Disposition = DispositionNone
+		}
+	}
+	return result
+}
+
+// EvaluateParser 使用邮件的 From 地址（EmailParser.From）评估 DMARC
+func EvaluateParser(parser *emailparser.EmailParser, dkimResults []*dkim.Result, spfResult *spf.Result, options EvaluateOptions) *Result {
+	domain := ""
+	if at := strings.LastIndexByte(parser.From.Email, '@'); at >= 0 {
+		domain = parser.From.Email[at+1:]
+	}
+	return Evaluate(domain, dkimResults, spfResult, options)
+}
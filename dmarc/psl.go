@@ -0,0 +1,103 @@
+package dmarc
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"strings"
+	"sync"
+)
+
+// public_suffix_list.dat 来自 https://publicsuffix.org/list/ ，更新时直接替换该文件
+//
+//go:embed public_suffix_list.dat
+var publicSuffixListData string
+
+// 规则类型
+const (
+	pslRuleNormal    = 1
+	pslRuleWildcard  = 2 // *.example
+	pslRuleException = 3 // !www.example
+)
+
+// PublicSuffixList 公共后缀列表，用于计算组织域名（RFC 7489 3.2）
+type PublicSuffixList struct {
+	rules map[string]int // 键为去掉 "*."、"!" 后的小写规则
+}
+
+// ParsePublicSuffixList 解析 public_suffix_list.dat 格式的数据，忽略注释和空行
+func ParsePublicSuffixList(r io.Reader) (*PublicSuffixList, error) {
+	list := &PublicSuffixList{rules: make(map[string]int)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// 规则到第一个空白为止
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			list.rules[rule[1:]] = pslRuleException
+		case strings.HasPrefix(rule, "*."):
+			list.rules[rule[2:]] = pslRuleWildcard
+		default:
+			if _, ok := list.rules[rule]; !ok {
+				list.rules[rule] = pslRuleNormal
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+var (
+	defaultPublicSuffixList     *PublicSuffixList
+	defaultPublicSuffixListOnce sync.Once
+)
+
+// DefaultPublicSuffixList 返回内嵌的公共后缀列表
+func DefaultPublicSuffixList() *PublicSuffixList {
+	defaultPublicSuffixListOnce.Do(func() {
+		defaultPublicSuffixList, _ = ParsePublicSuffixList(strings.NewReader(publicSuffixListData))
+	})
+	return defaultPublicSuffixList
+}
+
+// PublicSuffix 返回域名的公共后缀；没有匹配的规则时按 "*" 规则取顶级域名
+func (l *PublicSuffixList) PublicSuffix(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	labels := strings.Split(domain, ".")
+	// 从长到短查找，例外规则优先，其次是最长的匹配
+	for i := 0; i < len(labels); i++ {
+		name := strings.Join(labels[i:], ".")
+		if l.rules[name] == pslRuleException {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if i > 0 && l.rules[name] == pslRuleWildcard {
+			return strings.Join(labels[i-1:], ".")
+		}
+		if _, ok := l.rules[name]; ok {
+			return name
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// OrganizationalDomain 返回组织域名：公共后缀再加一个标签；域名本身是公共后缀时返回其本身
+func (l *PublicSuffixList) OrganizationalDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	suffix := l.PublicSuffix(domain)
+	if len(domain) <= len(suffix) {
+		return domain
+	}
+	rest := strings.TrimSuffix(domain[:len(domain)-len(suffix)], ".")
+	return rest[strings.LastIndexByte(rest, '.')+1:] + "." + suffix
+}
+
+// OrganizationalDomain 使用内嵌的公共后缀列表计算组织域名
+func OrganizationalDomain(domain string) string {
+	return DefaultPublicSuffixList().OrganizationalDomain(domain)
+}
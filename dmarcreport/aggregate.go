@@ -0,0 +1,247 @@
+// Package dmarcreport 解析 DMARC 聚合报告（RFC 7489 附录 C，zip/gzip 压缩的 XML）和失败报告（AFRF，RFC 6591）
+package dmarcreport
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// MaxReportSize 解压后报告的最大长度，防止压缩炸弹
+var MaxReportSize int64 = 64 << 20
+
+var (
+	ErrNoReport       = errors.New("no DMARC report found")
+	ErrReportTooLarge = errors.New("DMARC report too large")
+)
+
+// DateRange 报告覆盖的时间范围（UNIX 时间）
+type DateRange struct {
+	Begin int64 `xml:"begin"`
+	End   int64 `xml:"end"`
+}
+
+func (d DateRange) BeginTime() time.Time {
+	return time.Unix(d.Begin, 0)
+}
+
+func (d DateRange) EndTime() time.Time {
+	return time.Unix(d.End, 0)
+}
+
+// ReportMetadata 报告方信息
+type ReportMetadata struct {
+	OrgName          string    `xml:"org_name"`
+	Email            string    `xml:"email"`
+	ExtraContactInfo string    `xml:"extra_contact_info"`
+	ReportID         string    `xml:"report_id"`
+	DateRange        DateRange `xml:"date_range"`
+	Errors           []string  `xml:"error"`
+}
+
+// PolicyPublished 报告方看到的 DMARC 记录
+type PolicyPublished struct {
+	Domain          string `xml:"domain"`
+	DKIMAlignment   string `xml:"adkim"`
+	SPFAlignment    string `xml:"aspf"`
+	Policy          string `xml:"p"`
+	SubdomainPolicy string `xml:"sp"`
+	Percent         string `xml:"pct"` // 部分报告方省略或写成空值，保留原文
+	FailureOptions  string `xml:"fo"`
+}
+
+// PolicyOverrideReason 处置与策略不同的原因
+type PolicyOverrideReason struct {
+	Type    string `xml:"type"` // forwarded、sampled_out、trusted_forwarder、mailing_list、local_policy、other
+	Comment string `xml:"comment"`
+}
+
+// PolicyEvaluated 报告方的 DMARC 评估结果
+type PolicyEvaluated struct {
+	Disposition string                 `xml:"disposition"`
+	DKIM        string                 `xml:"dkim"` // 对齐后的结果，pass 或 fail
+	SPF         string                 `xml:"spf"`
+	Reasons     []PolicyOverrideReason `xml:"reason"`
+}
+
+// Row 一个来源 IP 的统计
+type Row struct {
+	SourceIP        string          `xml:"source_ip"`
+	Count           int64           `xml:"count"`
+	PolicyEvaluated PolicyEvaluated `xml:"policy_evaluated"`
+}
+
+// Identifiers 邮件中的标识符
+type Identifiers struct {
+	EnvelopeTo   string `xml:"envelope_to"`
+	EnvelopeFrom string `xml:"envelope_from"`
+	HeaderFrom   string `xml:"header_from"`
+}
+
+// DKIMAuthResult 一个 DKIM 签名的验证结果
+type DKIMAuthResult struct {
+	Domain      string `xml:"domain"`
+	Selector    string `xml:"selector"`
+	Result      string `xml:"result"`
+	HumanResult string `xml:"human_result"`
+}
+
+// SPFAuthResult SPF 检查结果
+type SPFAuthResult struct {
+	Domain      string `xml:"domain"`
+	Scope       string `xml:"scope"` // helo 或 mfrom
+	Result      string `xml:"result"`
+	HumanResult string `xml:"human_result"`
+}
+
+// AuthResults 未经对齐的认证结果
+type AuthResults struct {
+	DKIM []DKIMAuthResult `xml:"dkim"`
+	SPF  []SPFAuthResult  `xml:"spf"`
+}
+
+// Record 一条统计记录
+type Record struct {
+	Row         Row         `xml:"row"`
+	Identifiers Identifiers `xml:"identifiers"`
+	AuthResults AuthResults `xml:"auth_results"`
+}
+
+// AggregateReport 聚合报告
+type AggregateReport struct {
+	XMLName  xml.Name        `xml:"feedback"`
+	Version  string          `xml:"version"`
+	Metadata ReportMetadata  `xml:"report_metadata"`
+	Policy   PolicyPublished `xml:"policy_published"`
+	Records  []Record        `xml:"record"`
+}
+
+// MessageCount 返回所有记录的邮件总数
+func (r *AggregateReport) MessageCount() int64 {
+	var n int64
+	for _, record := range r.Records {
+		n += record.Row.Count
+	}
+	return n
+}
+
+// readLimited 读取全部数据，超过 MaxReportSize 时返回 ErrReportTooLarge
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxReportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxReportSize {
+		return nil, ErrReportTooLarge
+	}
+	return data, nil
+}
+
+// decompressReport 按数据头部识别 zip、gzip，返回 XML 数据；未压缩的数据原样返回
+func decompressReport(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		// 使用第一个 XML 文件，没有时使用第一个文件
+		var file *zip.File
+		for _, f := range archive.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if file == nil || (strings.EqualFold(path.Ext(f.Name), ".xml") && !strings.EqualFold(path.Ext(file.Name), ".xml")) {
+				file = f
+			}
+		}
+		if file == nil {
+			return nil, errors.New("empty zip archive")
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return readLimited(rc)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return readLimited(gz)
+	}
+	return data, nil
+}
+
+// ParseAggregateReport 解析聚合报告，data 可以是 zip、gzip 压缩的或未压缩的 XML
+func ParseAggregateReport(data []byte) (*AggregateReport, error) {
+	xmlData, err := decompressReport(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(xmlData))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("unknown charset(%s)", charset)
+		}
+		return enc.NewDecoder().Reader(input), nil
+	}
+	report := &AggregateReport{}
+	if err := decoder.Decode(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// isAggregateReportNode 根据类型和文件名判断附件是否可能为聚合报告
+func isAggregateReportNode(node *emailparser.MIMENode) bool {
+	switch node.ContentType {
+	case "APPLICATION/ZIP", "APPLICATION/X-ZIP-COMPRESSED", "APPLICATION/GZIP", "APPLICATION/X-GZIP",
+		"APPLICATION/XML", "TEXT/XML":
+		return true
+	}
+	filename := strings.ToLower(node.Filename)
+	if filename == "" {
+		filename = strings.ToLower(node.Name)
+	}
+	return strings.HasSuffix(filename, ".zip") || strings.HasSuffix(filename, ".gz") || strings.HasSuffix(filename, ".xml")
+}
+
+// ParseAggregateReports 从邮件附件中找出并解析聚合报告；没有可解析的报告时返回第一个错误或 ErrNoReport
+func ParseAggregateReports(parser *emailparser.EmailParser) ([]*AggregateReport, error) {
+	var reports []*AggregateReport
+	var firstErr error
+	for _, node := range parser.GetAttachmentNodes() {
+		if !isAggregateReportNode(node) {
+			continue
+		}
+		report, err := ParseAggregateReport(node.GetDecodedContent())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", node.Filename, err)
+			}
+			continue
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ErrNoReport
+	}
+	return reports, nil
+}
@@ -0,0 +1,168 @@
+package dmarcreport
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+const testAggregateXML = `<?xml version="1.0" encoding="windows-1252"?>
+<feedback>
+  <version>1.0</version>
+  <report_metadata>
+    <org_name>google.com</org_name>
+    <email>noreply-dmarc-support@google.com</email>
+    <report_id>1234567890</report_id>
+    <date_range><begin>1700000000</begin><end>1700086399</end></date_range>
+  </report_metadata>
+  <policy_published>
+    <domain>example.com</domain><adkim>r</adkim><aspf>r</aspf><p>reject</p><sp>reject</sp><pct>100</pct>
+  </policy_published>
+  <record>
+    <row>
+      <source_ip>192.0.2.1</source_ip><count>3</count>
+      <policy_evaluated><disposition>none</disposition><dkim>pass</dkim><spf>fail</spf></policy_evaluated>
+    </row>
+    <identifiers><header_from>example.com</header_from></identifiers>
+    <auth_results>
+      <dkim><domain>example.com</domain><selector>s1</selector><result>pass</result></dkim>
+      <spf><domain>bounce.example.net</domain><scope>mfrom</scope><result>pass</result></spf>
+    </auth_results>
+  </record>
+  <record>
+    <row>
+      <source_ip>198.51.100.9</source_ip><count>2</count>
+      <policy_evaluated>
+        <disposition>reject</disposition><dkim>fail</dkim><spf>fail</spf>
+        <reason><type>local_policy</type><comment>Caf` + "\xe9" + `</comment></reason>
+      </policy_evaluated>
+    </row>
+    <identifiers><header_from>example.com</header_from></identifiers>
+    <auth_results><spf><domain>example.com</domain><result>fail</result></spf></auth_results>
+  </record>
+</feedback>
+`
+
+func testReportEmail(contentType string, filename string, data []byte) []byte {
+	return []byte("From: noreply-dmarc-support@google.com\r\n" +
+		"Subject: Report domain: example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"This is an aggregate report.\r\n" +
+		"--b\r\n" +
+		"Content-Type: " + contentType + "; name=\"" + filename + "\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=\"" + filename + "\"\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(data) + "\r\n" +
+		"--b--\r\n")
+}
+
+func TestAggregateReport(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, _ := zw.Create("google.com!example.com!1700000000!1700086399.xml")
+	w.Write([]byte(testAggregateXML))
+	zw.Close()
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte(testAggregateXML))
+	gw.Close()
+
+	for _, message := range [][]byte{
+		testReportEmail("application/zip", "report.zip", zipped.Bytes()),
+		testReportEmail("application/octet-stream", "report.xml.gz", gzipped.Bytes()),
+		testReportEmail("text/xml", "report.xml", []byte(testAggregateXML)),
+	} {
+		parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: message})
+		reports, err := ParseAggregateReports(parser)
+		if err != nil || len(reports) != 1 {
+			t.Fatalf("unexpected result: %v %v", reports, err)
+		}
+		report := reports[0]
+		if report.Metadata.OrgName != "google.com" || report.Metadata.ReportID != "1234567890" ||
+			report.Metadata.DateRange.BeginTime().Unix() != 1700000000 || report.Policy.Domain != "example.com" ||
+			report.Policy.Policy != "reject" || len(report.Records) != 2 || report.MessageCount() != 5 {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+		record := report.Records[1]
+		if record.Row.SourceIP != "198.51.100.9" || record.Row.PolicyEvaluated.Disposition != "reject" ||
+			len(record.Row.PolicyEvaluated.Reasons) != 1 || record.Row.PolicyEvaluated.Reasons[0].Comment != "Café" ||
+			report.Records[0].AuthResults.DKIM[0].Selector != "s1" || report.Records[0].AuthResults.SPF[0].Scope != "mfrom" {
+			t.Fatalf("unexpected record: %+v", record)
+		}
+	}
+
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: testReportEmail("application/gzip", "bad.gz", []byte{0x1f, 0x8b, 0})})
+	if _, err := ParseAggregateReports(parser); err == nil || err == ErrNoReport {
+		t.Fatalf("expected decompression error, got %v", err)
+	}
+	saved := MaxReportSize
+	MaxReportSize = 100
+	defer func() { MaxReportSize = saved }()
+	if _, err := ParseAggregateReport(gzipped.Bytes()); err != ErrReportTooLarge {
+		t.Fatalf("expected ErrReportTooLarge, got %v", err)
+	}
+}
+
+func TestFailureReport(t *testing.T) {
+	message := "From: dmarc-noreply@mx.example.org\r\n" +
+		"Subject: FW: Earn money\r\n" +
+		"Content-Type: multipart/report; report-type=feedback-report; boundary=\"part\"\r\n" +
+		"\r\n" +
+		"--part\r\n" +
+		"Content-Type: text/plain; charset=\"US-ASCII\"\r\n" +
+		"\r\n" +
+		"This is an authentication failure report for an email message received from IP 192.0.2.1.\r\n" +
+		"--part\r\n" +
+		"Content-Type: message/feedback-report\r\n" +
+		"\r\n" +
+		"Feedback-Type: auth-failure\r\n" +
+		"User-Agent: SomeGenerator/1.0\r\n" +
+		"Version: 1\r\n" +
+		"Original-Mail-From: <bounce@example.com>\r\n" +
+		"Original-Rcpt-To: <user1@example.org>\r\n" +
+		"Original-Rcpt-To: <user2@example.org>\r\n" +
+		"Arrival-Date: Thu, 8 Mar 2005 14:00:00 EDT\r\n" +
+		"Source-IP: 192.0.2.1\r\n" +
+		"Authentication-Results: mx.example.org;\r\n" +
+		" dmarc=fail header.from=example.com\r\n" +
+		"Auth-Failure: DMARC\r\n" +
+		"Identity-Alignment: none\r\n" +
+		"Reported-Domain: example.com\r\n" +
+		"\r\n" +
+		"--part\r\n" +
+		"Content-Type: text/rfc822-headers\r\n" +
+		"\r\n" +
+		"From: <somebody@example.com>\r\n" +
+		"Subject: Earn money\r\n" +
+		"Message-ID: <8787KJKJ3K4J3K4J3K4J3.mail@example.com>\r\n" +
+		"\r\n" +
+		"--part--\r\n"
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte(message)})
+	report, err := ParseFailureReport(parser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FeedbackType != "auth-failure" || report.AuthFailure != "dmarc" || report.OriginalMailFrom != "bounce@example.com" ||
+		len(report.OriginalRcptTo) != 2 || report.OriginalRcptTo[1] != "user2@example.org" || report.SourceIP != "192.0.2.1" ||
+		report.ArrivalDateUnix == 0 || report.ReportedDomain[0] != "example.com" ||
+		report.AuthenticationResults != "mx.example.org; dmarc=fail header.from=example.com" ||
+		!strings.HasPrefix(report.Description, "This is an authentication failure report") {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.OriginalMessage == nil || report.OriginalMessage.MessageID != "8787KJKJ3K4J3K4J3K4J3.mail@example.com" {
+		t.Fatalf("unexpected original message")
+	}
+	if _, err := ParseFailureReport(emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte("Subject: x\r\n\r\nbody\r\n")})); err != ErrNoReport {
+		t.Fatalf("expected ErrNoReport, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package dmarcreport
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// FailureReport 失败报告（RFC 6591 的 Authentication Failure 报告，ARF 格式）
+type FailureReport struct {
+	FeedbackType          string // 通常为 auth-failure
+	UserAgent             string
+	Version               string
+	AuthFailure           string // dmarc、dkim、spf、adsp、bodyhash、revoked、signature，小写
+	IdentityAlignment     string // dkim、spf、none 等
+	DeliveryResult        string // delivered、spam、policy、reject、other
+	OriginalMailFrom      string
+	OriginalRcptTo        []string
+	OriginalEnvelopeID    string
+	ArrivalDate           string
+	ArrivalDateUnix       int64 // 无法解析时为0
+	SourceIP              string
+	ReportedDomain        []string
+	ReportedURI           []string
+	AuthenticationResults string
+	DKIMDomain            string
+	DKIMIdentity          string
+	DKIMSelector          string
+	SPFDNS                string
+	Fields                map[string][]string // 所有字段，键为大写的字段名
+	Description           string              // 第一部分的说明文字
+	// 原始邮件（MESSAGE/RFC822）或原始头部（TEXT/RFC822-HEADERS），都没有时为nil
+	OriginalMessage *emailparser.EmailParser
+}
+
+// walkNodes 深度优先遍历节点（不进入内嵌邮件）
+func walkNodes(node *emailparser.MIMENode, fn func(node *emailparser.MIMENode)) {
+	fn(node)
+	for _, child := range node.Childs {
+		walkNodes(child, fn)
+	}
+}
+
+// parseFeedbackFields 解析 MESSAGE/FEEDBACK-REPORT 的字段，字段与头部格式相同
+func parseFeedbackFields(data []byte) map[string][]string {
+	fieldsParser := emailparser.EmailParserNew(emailparser.EmailParserOptions{
+		EmailData:       data,
+		MaxNestingDepth: -1,
+	})
+	fields := make(map[string][]string)
+	for _, line := range fieldsParser.GetTopMIMENode().Header {
+		fields[line.Name] = append(fields[line.Name], string(line.Value))
+	}
+	return fields
+}
+
+// ParseFailureReport 从邮件中找出 MESSAGE/FEEDBACK-REPORT 部分并解析，没有时返回 ErrNoReport
+func ParseFailureReport(parser *emailparser.EmailParser) (*FailureReport, error) {
+	var feedback, original, description *emailparser.MIMENode
+	walkNodes(parser.GetTopMIMENode(), func(node *emailparser.MIMENode) {
+		switch node.ContentType {
+		case "MESSAGE/FEEDBACK-REPORT":
+			if feedback == nil {
+				feedback = node
+			}
+		case "MESSAGE/RFC822", "MESSAGE/GLOBAL", "TEXT/RFC822-HEADERS":
+			if original == nil {
+				original = node
+			}
+		case "TEXT/PLAIN":
+			if description == nil {
+				description = node
+			}
+		}
+	})
+	if feedback == nil {
+		return nil, ErrNoReport
+	}
+
+	fields := parseFeedbackFields(feedback.GetDecodedContent())
+	first := func(name string) string {
+		if values := fields[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	report := &FailureReport{
+		FeedbackType:          strings.ToLower(first("FEEDBACK-TYPE")),
+		UserAgent:             first("USER-AGENT"),
+		Version:               first("VERSION"),
+		AuthFailure:           strings.ToLower(first("AUTH-FAILURE")),
+		IdentityAlignment:     strings.ToLower(first("IDENTITY-ALIGNMENT")),
+		DeliveryResult:        strings.ToLower(first("DELIVERY-RESULT")),
+		OriginalMailFrom:      strings.Trim(first("ORIGINAL-MAIL-FROM"), "<>"),
+		OriginalEnvelopeID:    first("ORIGINAL-ENVELOPE-ID"),
+		ArrivalDate:           first("ARRIVAL-DATE"),
+		SourceIP:              first("SOURCE-IP"),
+		ReportedDomain:        fields["REPORTED-DOMAIN"],
+		ReportedURI:           fields["REPORTED-URI"],
+		AuthenticationResults: first("AUTHENTICATION-RESULTS"),
+		DKIMDomain:            first("DKIM-DOMAIN"),
+		DKIMIdentity:          first("DKIM-IDENTITY"),
+		DKIMSelector:          first("DKIM-SELECTOR"),
+		SPFDNS:                first("SPF-DNS"),
+		Fields:                fields,
+	}
+	for _, rcpt := range fields["ORIGINAL-RCPT-TO"] {
+		report.OriginalRcptTo = append(report.OriginalRcptTo, strings.Trim(rcpt, "<>"))
+	}
+	if t, err := mail.ParseDate(report.ArrivalDate); err == nil {
+		report.ArrivalDateUnix = t.Unix()
+	}
+	if description != nil {
+		report.Description = strings.TrimSpace(description.GetDecodedTextContent())
+	}
+	if original != nil {
+		// TEXT/RFC822-HEADERS 和未能展开的内嵌邮件按内层邮件解析
+		if report.OriginalMessage = original.GetEmbeddedEmailParser(); report.OriginalMessage == nil {
+			report.OriginalMessage = original.NewInnerEmailParser(original.GetDecodedContent())
+		}
+	}
+	return report, nil
+}
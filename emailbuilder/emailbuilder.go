@@ -0,0 +1,493 @@
+// Package emailbuilder 生成符合 RFC 5322 / MIME 的邮件
+package emailbuilder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// EmailBuilderAttachment 附件或内嵌资源
+type EmailBuilderAttachment struct {
+	Filename    string // 文件名
+	ContentType string // 媒体类型（如 image/png），为空时根据文件名推断
+	ContentID   string // 内容ID（不含尖括号），非空表示内嵌资源（HTML 中以 cid: 引用）
+	Data        []byte // 原始数据
+}
+
+// EmailBuilder 邮件生成器，字段与 EmailParser 对应
+type EmailBuilder struct {
+	MessageID                 string // 为空时自动生成
+	Subject                   string
+	Date                      time.Time // 为零值时使用当前时间
+	From                      emailparser.MimeAddress
+	To                        []emailparser.MimeAddress
+	Cc                        []emailparser.MimeAddress
+	Bcc                       []emailparser.MimeAddress // 不写入邮件头，仅供投递使用
+	Sender                    emailparser.MimeAddress
+	ReplyTo                   emailparser.MimeAddress
+	DispositionNotificationTo emailparser.MimeAddress
+	InReplyTo                 string
+	References                []string
+	Headers                   []emailparser.MimeLine // 自定义头部，按顺序写在标准头部之后
+	TextBody                  string
+	HTMLBody                  string
+	Inlines                   []EmailBuilderAttachment // 内嵌资源（与 HTMLBody 组成 MULTIPART/RELATED）
+	Attachments               []EmailBuilderAttachment
+	HeaderCharset             string // 头部与附件文件名的编码字符集（如 UTF-8、GBK、ISO-2022-JP），默认为 UTF-8
+}
+
+// EmailBuilderNew 创建邮件生成器
+func EmailBuilderNew() *EmailBuilder {
+	return &EmailBuilder{}
+}
+
+// AddHeader 追加自定义头部，非 ASCII 值会按 RFC 2047 编码；名称或值无效（含 CR、LF 等）时 Build 返回错误
+func (b *EmailBuilder) AddHeader(name string, value string) {
+	b.Headers = append(b.Headers, emailparser.MimeLine{
+		Name:  name,
+		Value: []byte(value),
+	})
+}
+
+// AddAttachment 追加附件
+func (b *EmailBuilder) AddAttachment(filename string, contentType string, data []byte) {
+	b.Attachments = append(b.Attachments, EmailBuilderAttachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+	})
+}
+
+// AddInline 追加内嵌资源，HTMLBody 中以 "cid:<contentID>" 引用
+func (b *EmailBuilder) AddInline(filename string, contentType string, contentID string, data []byte) {
+	b.Inlines = append(b.Inlines, EmailBuilderAttachment{
+		Filename:    filename,
+		ContentType: contentType,
+		ContentID:   contentID,
+		Data:        data,
+	})
+}
+
+// Build 生成邮件数据
+func (b *EmailBuilder) Build() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo 生成邮件并写入 w
+func (b *EmailBuilder) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	if b.From.Email == "" {
+		return 0, fmt.Errorf("emailbuilder: From is required")
+	}
+	// 先组装正文，附件头部无效时不输出任何数据
+	root, err := b.buildTree()
+	if err != nil {
+		return 0, err
+	}
+	if err := b.writeHeaders(cw); err != nil {
+		return cw.n, err
+	}
+	if err := root.writeTo(cw); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (b *EmailBuilder) writeHeaders(w io.Writer) error {
+	date := b.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := strings.Trim(b.MessageID, "<> ")
+	if messageID == "" {
+		messageID = generateMessageID(b.From.Email)
+	}
+
+	var hb headerBuilder
+	charset := b.HeaderCharset
+	addAddress := func(name string, a emailparser.MimeAddress) error {
+		if a.Email == "" {
+			return nil
+		}
+		value, err := formatAddress(a, charset)
+		if err != nil {
+			return err
+		}
+		hb.addRaw(name, value)
+		return nil
+	}
+	addAddressList := func(name string, as []emailparser.MimeAddress) error {
+		if len(as) == 0 {
+			return nil
+		}
+		value, err := formatAddressList(as, charset)
+		if err != nil {
+			return err
+		}
+		hb.addRaw(name, value)
+		return nil
+	}
+	addText := func(name string, value string) error {
+		if err := checkHeaderValue(name, value); err != nil {
+			return err
+		}
+		encoded, err := emailparser.EncodeMimeValueString(value, charset, "")
+		if err != nil {
+			return err
+		}
+		hb.addRaw(name, encoded)
+		return nil
+	}
+
+	hb.addRaw("Date", date.Format(time.RFC1123Z))
+	if err := addAddress("From", b.From); err != nil {
+		return err
+	}
+	if err := addAddress("Sender", b.Sender); err != nil {
+		return err
+	}
+	if err := addAddressList("To", b.To); err != nil {
+		return err
+	}
+	if err := addAddressList("Cc", b.Cc); err != nil {
+		return err
+	}
+	if err := addAddress("Reply-To", b.ReplyTo); err != nil {
+		return err
+	}
+	if err := addAddress("Disposition-Notification-To", b.DispositionNotificationTo); err != nil {
+		return err
+	}
+	hb.addRaw("Message-ID", "<"+messageID+">")
+	if b.InReplyTo != "" {
+		hb.addRaw("In-Reply-To", "<"+strings.Trim(b.InReplyTo, "<> ")+">")
+	}
+	if len(b.References) > 0 {
+		refs := make([]string, 0, len(b.References))
+		for _, ref := range b.References {
+			refs = append(refs, "<"+strings.Trim(ref, "<> ")+">")
+		}
+		hb.addRaw("References", strings.Join(refs, " "))
+	}
+	if err := addText("Subject", b.Subject); err != nil {
+		return err
+	}
+	for _, line := range b.Headers {
+		if err := addText(line.Name, string(line.Value)); err != nil {
+			return err
+		}
+	}
+	hb.addRaw("MIME-Version", "1.0")
+	if hb.err != nil {
+		return hb.err
+	}
+	_, err := w.Write(hb.buf.Bytes())
+	return err
+}
+
+// part 待输出的 MIME 部分
+type part struct {
+	header   headerBuilder
+	body     []byte
+	encoding string
+	boundary string
+	childs   []*part
+}
+
+func (p *part) writeTo(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.Write(p.header.buf.Bytes())
+	buf.WriteString("\r\n")
+	if len(p.childs) == 0 {
+		switch p.encoding {
+		case "base64":
+			writeBase64(&buf, p.body)
+		case "quoted-printable":
+			qw := quotedprintable.NewWriter(&buf)
+			qw.Write(p.body)
+			qw.Close()
+		default:
+			buf.Write(p.body)
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	for _, child := range p.childs {
+		if _, err := io.WriteString(w, "\r\n--"+p.boundary+"\r\n"); err != nil {
+			return err
+		}
+		if err := child.writeTo(w); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\r\n--"+p.boundary+"--\r\n")
+	return err
+}
+
+func newMultipart(subType string) *part {
+	p := &part{boundary: generateBoundary()}
+	p.header.addRaw("Content-Type", "multipart/"+subType+"; boundary=\""+p.boundary+"\"")
+	return p
+}
+
+func newTextPart(subType string, text string) *part {
+	body := []byte(normalizeNewlines(text))
+	p := &part{body: body, encoding: chooseTextEncoding(body)}
+	p.header.addRaw("Content-Type", "text/"+subType+"; charset=utf-8")
+	p.header.addRaw("Content-Transfer-Encoding", p.encoding)
+	return p
+}
+
+func newAttachmentPart(a EmailBuilderAttachment, disposition string, charset string) (*part, error) {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(fileExt(a.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	p := &part{body: a.Data, encoding: "base64"}
+	if err := checkHeaderValue("filename", a.Filename); err != nil {
+		return nil, err
+	}
+	if a.Filename != "" {
+		name, err := emailparser.EncodeMimeParam2231("name", a.Filename, charset)
+		if err != nil {
+			return nil, err
+		}
+		filename, err := emailparser.EncodeMimeParam2231("filename", a.Filename, charset)
+		if err != nil {
+			return nil, err
+		}
+		p.header.addRaw("Content-Type", contentType+"; "+name)
+		p.header.addRaw("Content-Disposition", disposition+"; "+filename)
+	} else {
+		p.header.addRaw("Content-Type", contentType)
+		p.header.addRaw("Content-Disposition", disposition)
+	}
+	p.header.addRaw("Content-Transfer-Encoding", "base64")
+	if a.ContentID != "" {
+		p.header.addRaw("Content-ID", "<"+strings.Trim(a.ContentID, "<> ")+">")
+	}
+	if p.header.err != nil {
+		return nil, p.header.err
+	}
+	return p, nil
+}
+
+// buildTree 组装 MIME 结构：MIXED( RELATED( ALTERNATIVE(PLAIN, HTML), 内嵌资源 ), 附件 )
+func (b *EmailBuilder) buildTree() (*part, error) {
+	var body *part
+	var text, html *part
+	if b.TextBody != "" || b.HTMLBody == "" {
+		text = newTextPart("plain", b.TextBody)
+	}
+	if b.HTMLBody != "" {
+		html = newTextPart("html", b.HTMLBody)
+	}
+	if text != nil && html != nil {
+		body = newMultipart("alternative")
+		body.childs = append(body.childs, text, html)
+	} else if html != nil {
+		body = html
+	} else {
+		body = text
+	}
+
+	if len(b.Inlines) > 0 {
+		related := newMultipart("related")
+		related.childs = append(related.childs, body)
+		for _, a := range b.Inlines {
+			if a.ContentID == "" {
+				return nil, fmt.Errorf("emailbuilder: inline %q has no Content-ID", a.Filename)
+			}
+			p, err := newAttachmentPart(a, "inline", b.HeaderCharset)
+			if err != nil {
+				return nil, err
+			}
+			related.childs = append(related.childs, p)
+		}
+		body = related
+	}
+
+	if len(b.Attachments) > 0 {
+		mixed := newMultipart("mixed")
+		mixed.childs = append(mixed.childs, body)
+		for _, a := range b.Attachments {
+			p, err := newAttachmentPart(a, "attachment", b.HeaderCharset)
+			if err != nil {
+				return nil, err
+			}
+			mixed.childs = append(mixed.childs, p)
+		}
+		body = mixed
+	}
+	return body, nil
+}
+
+// headerBuilder 逐行生成头部，超长行按空白折行
+type headerBuilder struct {
+	buf bytes.Buffer
+	err error // 第一个无效的头部，WriteTo 时返回
+}
+
+// checkHeaderName 头部名称只能由可打印 ASCII 字符组成，不能含冒号和空白（RFC 5322 2.2）
+func checkHeaderName(name string) error {
+	if name == "" {
+		return fmt.Errorf("emailbuilder: empty header name")
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c <= ' ' || c >= 0x7f || c == ':' {
+			return fmt.Errorf("emailbuilder: invalid header name %q", name)
+		}
+	}
+	return nil
+}
+
+// checkHeaderValue 头部值不能含 CR、LF，否则可以插入额外的头部（如 Bcc）
+func checkHeaderValue(name string, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("emailbuilder: %s contains CR or LF", name)
+	}
+	return nil
+}
+
+func (h *headerBuilder) addRaw(name string, value string) {
+	if h.err != nil {
+		return
+	}
+	if h.err = checkHeaderName(name); h.err != nil {
+		return
+	}
+	if h.err = checkHeaderValue(name, value); h.err != nil {
+		return
+	}
+	h.buf.WriteString(emailparser.FoldMimeHeaderLine(name, value))
+	h.buf.WriteString("\r\n")
+}
+
+func escapeQuoted(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(s)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// formatAddress 生成单个地址，ASCII 名称加引号，非 ASCII 名称整体按 RFC 2047 编码为 encoded-word 序列
+// （名称中的 ASCII 部分也要编码，原样输出时 ,;<>"@ 等特殊字符会破坏地址结构）
+func formatAddress(a emailparser.MimeAddress, charset string) (string, error) {
+	if err := checkHeaderValue("address", a.Email); err != nil {
+		return "", err
+	}
+	if err := checkHeaderValue("address name", a.Name); err != nil {
+		return "", err
+	}
+	if a.Name == "" {
+		return "<" + a.Email + ">", nil
+	}
+	if !isASCII(a.Name) {
+		words, err := emailparser.EncodeMimeValueWords(a.Name, charset, "")
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(words, " ") + " <" + a.Email + ">", nil
+	}
+	return "\"" + escapeQuoted(a.Name) + "\" <" + a.Email + ">", nil
+}
+
+func formatAddressList(as []emailparser.MimeAddress, charset string) (string, error) {
+	items := make([]string, 0, len(as))
+	for _, a := range as {
+		item, err := formatAddress(a, charset)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, ", "), nil
+}
+
+func normalizeNewlines(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// chooseTextEncoding 纯 ASCII 且行长合规时使用 7bit，否则使用 quoted-printable
+func chooseTextEncoding(body []byte) string {
+	for _, line := range bytes.Split(body, []byte("\r\n")) {
+		if len(line) > 76 || !isASCII(string(line)) {
+			return "quoted-printable"
+		}
+	}
+	return "7bit"
+}
+
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+}
+
+func fileExt(filename string) string {
+	pos := strings.LastIndex(filename, ".")
+	if pos < 0 {
+		return ""
+	}
+	return strings.ToLower(filename[pos:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func generateBoundary() string {
+	return "=_Part_" + randomHex(12)
+}
+
+func generateMessageID(from string) string {
+	domain := "localhost"
+	if pos := strings.LastIndex(from, "@"); pos >= 0 && pos+1 < len(from) {
+		domain = from[pos+1:]
+	}
+	return fmt.Sprintf("%d.%s@%s", time.Now().UnixNano(), randomHex(8), domain)
+}
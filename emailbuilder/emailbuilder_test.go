@@ -0,0 +1,171 @@
+package emailbuilder
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+func TestBuildRoundTrip(t *testing.T) {
+	b := EmailBuilderNew()
+	b.Subject = "测试邮件 with a fairly long subject line that needs to be folded across lines"
+	b.Date = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	b.From = emailparser.MimeAddress{Name: "张三", Email: "zhangsan@example.com"}
+	b.To = []emailparser.MimeAddress{
+		{Name: "Bob \"the\" Builder", Email: "bob@example.com"},
+		{Email: "carol@example.com"},
+	}
+	b.AddHeader("X-Mailer", "go-email")
+	b.TextBody = "hello\nworld, 你好"
+	b.HTMLBody = "<p>hello <img src=\"cid:logo@x\"></p>"
+	b.AddInline("logo.png", "image/png", "logo@x", []byte{0x89, 'P', 'N', 'G'})
+	b.AddAttachment("报告.pdf", "", bytes.Repeat([]byte("pdf data "), 50))
+	b.AddAttachment("notes.bin", "", []byte("notes"))
+
+	data, err := b.Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: data})
+	if parser.Subject != b.Subject {
+		t.Fatalf("subject mismatch: %q", parser.Subject)
+	}
+	if parser.From.Name != b.From.Name || parser.From.Email != b.From.Email {
+		t.Fatalf("from mismatch: %+v", parser.From)
+	}
+	if len(parser.To) != 2 || parser.To[0].Name != "Bob \"the\" Builder" || parser.To[1].Email != "carol@example.com" {
+		t.Fatalf("to mismatch: %+v", parser.To)
+	}
+	if string(parser.GetTopMIMENode().GetHeaderValueIgnoreNotFound("X-Mailer")) != "go-email" {
+		t.Fatalf("custom header missing")
+	}
+	if defects := parser.GetDefects(); len(defects) > 0 {
+		t.Fatalf("unexpected defects: %v", defects)
+	}
+
+	shows := parser.GetAlternativeShowNodes()
+	if len(shows) != 1 || shows[0].ContentType != "TEXT/HTML" {
+		t.Fatalf("unexpected show nodes: %d", len(shows))
+	}
+	texts := parser.GetTextNodes()
+	if len(texts) != 2 || texts[0].GetDecodedTextContent() != "hello\r\nworld, 你好" {
+		t.Fatalf("unexpected text nodes: %d", len(texts))
+	}
+
+	attachments := parser.GetAttachmentNodes()
+	if len(attachments) != 3 {
+		t.Fatalf("unexpected attachment count: %d", len(attachments))
+	}
+	if !attachments[0].IsInlineAttachment() || attachments[0].ContentID != "logo@x" {
+		t.Fatalf("inline image not recognised")
+	}
+	if attachments[1].Filename != "报告.pdf" || attachments[1].ContentType != "APPLICATION/PDF" ||
+		!bytes.Equal(attachments[1].GetDecodedContent(), b.Attachments[0].Data) {
+		t.Fatalf("attachment mismatch: %q %q", attachments[1].Filename, attachments[1].ContentType)
+	}
+	if attachments[2].Filename != "notes.bin" || string(attachments[2].GetDecodedContent()) != "notes" {
+		t.Fatalf("attachment mismatch: %q", attachments[2].Filename)
+	}
+}
+
+func TestBuildHeaderCharset(t *testing.T) {
+	b := EmailBuilderNew()
+	b.HeaderCharset = "GBK"
+	b.Subject = "季度报告"
+	b.From = emailparser.MimeAddress{Name: "李四", Email: "lisi@example.com"}
+	b.TextBody = "see attachment"
+	filename := "二〇二四年第三季度销售数据汇总以及各区域分析报告最终版本.xlsx"
+	b.AddAttachment(filename, "", []byte("xlsx"))
+	data, err := b.Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if !bytes.Contains(data, []byte("=?GBK?")) || !bytes.Contains(data, []byte("filename*1*=")) {
+		t.Fatalf("headers not encoded with GBK continuations:\n%s", data)
+	}
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: data})
+	if parser.Subject != b.Subject || parser.From.Name != b.From.Name {
+		t.Fatalf("header mismatch: %q %q", parser.Subject, parser.From.Name)
+	}
+	if attachments := parser.GetAttachmentNodes(); len(attachments) != 1 || attachments[0].Filename != filename || attachments[0].Name != filename {
+		t.Fatalf("attachment filename mismatch")
+	}
+
+	b.HeaderCharset = "ISO-8859-1"
+	if _, err := b.Build(); err == nil {
+		t.Fatalf("expected error for unrepresentable charset")
+	}
+}
+
+func TestBuildAddressPhrase(t *testing.T) {
+	names := []string{
+		"Zhang, 三",
+		"张三 <boss@example.com>",
+		"李\"四\"; 王五",
+		"赵六 @ 研发部",
+		"Smith, John (史密斯)",
+	}
+	for _, charset := range []string{"UTF-8", "GBK"} {
+		b := EmailBuilderNew()
+		b.HeaderCharset = charset
+		b.From = emailparser.MimeAddress{Name: names[0], Email: "z@example.com"}
+		for i, name := range names {
+			b.To = append(b.To, emailparser.MimeAddress{Name: name, Email: fmt.Sprintf("u%d@example.com", i)})
+		}
+		b.TextBody = "hello"
+		data, err := b.Build()
+		if err != nil {
+			t.Fatalf("build failed: %v", err)
+		}
+		parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: data})
+		if parser.From.Name != names[0] || parser.From.Email != "z@example.com" {
+			t.Fatalf("%s: from mismatch: %+v", charset, parser.From)
+		}
+		if len(parser.To) != len(names) {
+			t.Fatalf("%s: to mismatch: %+v", charset, parser.To)
+		}
+		for i, name := range names {
+			if parser.To[i].Name != name || parser.To[i].Email != fmt.Sprintf("u%d@example.com", i) {
+				t.Fatalf("%s: address %d mismatch: %+v", charset, i, parser.To[i])
+			}
+		}
+	}
+}
+
+func TestBuildHeaderInjection(t *testing.T) {
+	newBuilder := func() *EmailBuilder {
+		b := EmailBuilderNew()
+		b.From = emailparser.MimeAddress{Email: "alice@example.com"}
+		b.To = []emailparser.MimeAddress{{Email: "bob@example.com"}}
+		b.TextBody = "hello"
+		return b
+	}
+	cases := map[string]func(b *EmailBuilder){
+		"subject":         func(b *EmailBuilder) { b.Subject = "hi\r\nBcc: eve@example.com" },
+		"header value":    func(b *EmailBuilder) { b.AddHeader("X-Test", "a\nBcc: eve@example.com") },
+		"header name":     func(b *EmailBuilder) { b.AddHeader("Bcc: eve@example.com\r\nX-Test", "a") },
+		"name colon":      func(b *EmailBuilder) { b.AddHeader("X-Test:", "a") },
+		"name space":      func(b *EmailBuilder) { b.AddHeader("X Test", "a") },
+		"address":         func(b *EmailBuilder) { b.To[0].Email = "bob@example.com>\r\nBcc: <eve@example.com" },
+		"address name":    func(b *EmailBuilder) { b.To[0].Name = "Bob\r\nBcc: eve@example.com" },
+		"message id":      func(b *EmailBuilder) { b.MessageID = "id@example.com\r\nBcc: eve@example.com" },
+		"references":      func(b *EmailBuilder) { b.References = []string{"a@example.com\nBcc: eve@example.com"} },
+		"attachment type": func(b *EmailBuilder) { b.AddAttachment("a.txt", "text/plain\r\nBcc: eve@example.com", []byte("a")) },
+		"attachment name": func(b *EmailBuilder) { b.AddAttachment("a\r\n.txt", "", []byte("a")) },
+	}
+	for name, modify := range cases {
+		b := newBuilder()
+		modify(b)
+		if data, err := b.Build(); err == nil {
+			t.Fatalf("%s: expected error, got %q", name, data)
+		}
+	}
+	b := newBuilder()
+	b.AddHeader("X-Test", "ok")
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package emailparser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AuthMethodResult Authentication-Results 中一个认证方法的结果（RFC 8601 resinfo）
+type AuthMethodResult struct {
+	Method     string            `json:"method"`            // spf、dkim、dmarc、arc、auth 等，小写
+	Version    int               `json:"version,omitempty"` // method/版本号，未指定时为0
+	Result     string            `json:"result"`            // pass、fail、none、softfail 等，小写
+	Reason     string            `json:"reason,omitempty"`  // reason= 的值
+	Properties map[string]string `json:"properties"`        // 以 ptype.property（小写）为键，如 smtp.mailfrom、header.d、header.i
+}
+
+// AuthenticationResults 一个 Authentication-Results 头部
+type AuthenticationResults struct {
+	AuthServID string              `json:"authservId"`
+	Version    int                 `json:"version,omitempty"` // authres-version，未指定时为0
+	Results    []*AuthMethodResult `json:"results"`           // 为空表示 none（无认证结果）
+}
+
+// GetResults 返回指定方法的结果
+func (r *AuthenticationResults) GetResults(method string) []*AuthMethodResult {
+	var results []*AuthMethodResult
+	for _, result := range r.Results {
+		if strings.EqualFold(result.Method, method) {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// authResultsScanner 按 RFC 8601 的语法扫描头部值，跳过注释和空白
+type authResultsScanner struct {
+	data string
+	pos  int
+}
+
+// skipCFWS 跳过空白和注释（注释可嵌套，支持 \ 转义）
+func (s *authResultsScanner) skipCFWS() error {
+	depth := 0
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == '\\' && depth > 0:
+			s.pos++
+		case depth == 0 && c != ' ' && c != '\t' && c != '\r' && c != '\n':
+			return nil
+		}
+		s.pos++
+	}
+	if depth > 0 {
+		return errors.New("unterminated comment")
+	}
+	return nil
+}
+
+// peek 跳过空白和注释后返回下一个字符，结束时返回0
+func (s *authResultsScanner) peek() (byte, error) {
+	if err := s.skipCFWS(); err != nil {
+		return 0, err
+	}
+	if s.pos >= len(s.data) {
+		return 0, nil
+	}
+	return s.data[s.pos], nil
+}
+
+// expect 跳过空白和注释后读取指定字符
+func (s *authResultsScanner) expect(c byte) error {
+	next, err := s.peek()
+	if err != nil {
+		return err
+	}
+	if next != c {
+		return fmt.Errorf("expected %q at offset %d", c, s.pos)
+	}
+	s.pos++
+	return nil
+}
+
+// readToken 跳过空白和注释后读取一个 token，遇到空白、注释、引号、分号或 stops 中的字符结束
+func (s *authResultsScanner) readToken(stops string) (string, error) {
+	if err := s.skipCFWS(); err != nil {
+		return "", err
+	}
+	start := s.pos
+	for s.pos < len(s.data) && !strings.ContainsRune(" \t\r\n();\""+stops, rune(s.data[s.pos])) {
+		s.pos++
+	}
+	if s.pos == start {
+		return "", fmt.Errorf("missing token at offset %d", start)
+	}
+	return s.data[start:s.pos], nil
+}
+
+// readValue 读取 token 或 quoted-string（去除引号和转义）
+func (s *authResultsScanner) readValue() (string, error) {
+	next, err := s.peek()
+	if err != nil {
+		return "", err
+	}
+	if next != '"' {
+		return s.readToken("")
+	}
+	var sb strings.Builder
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		c := s.data[s.pos]
+		if c == '\\' && s.pos+1 < len(s.data) {
+			s.pos++
+			sb.WriteByte(s.data[s.pos])
+			continue
+		}
+		if c == '"' {
+			s.pos++
+			return sb.String(), nil
+		}
+		sb.WriteByte(c)
+	}
+	return "", errors.New("unterminated quoted string")
+}
+
+// readResInfo 读取分号之后的一个 resinfo：method[/version]=result [reason=...] [ptype.property=value ...]
+func (s *authResultsScanner) readResInfo() (*AuthMethodResult, error) {
+	method, err := s.readToken("=/")
+	if err != nil {
+		return nil, err
+	}
+	result := &AuthMethodResult{Method: strings.ToLower(method), Properties: make(map[string]string)}
+	next, err := s.peek()
+	if err != nil {
+		return nil, err
+	}
+	if result.Method == "none" && (next == 0 || next == ';') {
+		// no-result：没有进行任何认证
+		return result, nil
+	}
+	if next == '/' {
+		s.pos++
+		version, err := s.readToken("=")
+		if err != nil {
+			return nil, err
+		}
+		if result.Version, err = strconv.Atoi(version); err != nil {
+			return nil, fmt.Errorf("invalid version of method %s", method)
+		}
+	}
+	if err := s.expect('='); err != nil {
+		return nil, err
+	}
+	value, err := s.readToken("=")
+	if err != nil {
+		return nil, err
+	}
+	result.Result = strings.ToLower(value)
+
+	for {
+		next, err := s.peek()
+		if err != nil {
+			return nil, err
+		}
+		if next == 0 || next == ';' {
+			return result, nil
+		}
+		name, err := s.readToken("=")
+		if err != nil {
+			return nil, err
+		}
+		if err := s.expect('='); err != nil {
+			return nil, err
+		}
+		value, err := s.readValue()
+		if err != nil {
+			return nil, err
+		}
+		name = strings.ToLower(name)
+		if name == "reason" {
+			result.Reason = value
+		} else {
+			result.Properties[name] = value
+		}
+	}
+}
+
+// ParseAuthenticationResults 解析 Authentication-Results 头部的值（RFC 8601），忽略其中的注释
+func ParseAuthenticationResults(line []byte) (*AuthenticationResults, error) {
+	s := &authResultsScanner{data: string(line)}
+	authServID, err := s.readValue()
+	if err != nil {
+		return nil, fmt.Errorf("invalid authserv-id: %w", err)
+	}
+	results := &AuthenticationResults{AuthServID: authServID}
+	next, err := s.peek()
+	if err != nil {
+		return nil, err
+	}
+	if next >= '0' && next <= '9' {
+		version, err := s.readToken("")
+		if err != nil {
+			return nil, err
+		}
+		if results.Version, err = strconv.Atoi(version); err != nil {
+			return nil, fmt.Errorf("invalid authres-version %q", version)
+		}
+	}
+	for {
+		next, err := s.peek()
+		if err != nil {
+			return nil, err
+		}
+		if next == 0 {
+			break
+		}
+		if next != ';' {
+			return nil, fmt.Errorf("expected ';' at offset %d", s.pos)
+		}
+		s.pos++
+		if next, err = s.peek(); err != nil {
+			return nil, err
+		} else if next == 0 {
+			// 容忍结尾多余的分号
+			break
+		}
+		result, err := s.readResInfo()
+		if err != nil {
+			return nil, err
+		}
+		if result.Method == "none" && result.Result == "" {
+			continue
+		}
+		results.Results = append(results.Results, result)
+	}
+	return results, nil
+}
+
+// GetAuthenticationResults 解析顶层的所有 Authentication-Results 头部，按头部顺序返回，无法解析的头部被忽略
+func (p *EmailParser) GetAuthenticationResults() []*AuthenticationResults {
+	if p.authResultsDealed {
+		return p.authResults
+	}
+	p.authResultsDealed = true
+	for _, line := range p.topNode.Header {
+		if line.Name != "AUTHENTICATION-RESULTS" {
+			continue
+		}
+		if results, err := ParseAuthenticationResults(line.Value); err == nil {
+			p.authResults = append(p.authResults, results)
+		}
+	}
+	return p.authResults
+}
@@ -2,33 +2,41 @@ package emailparser
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
+// DebugShow 将邮件信息输出到标准输出
 func (p *EmailParser) DebugShow() {
+	p.DebugShowTo(os.Stdout)
+}
+
+// DebugShowTo 将邮件信息输出到 w
+func (p *EmailParser) DebugShowTo(w io.Writer) {
 	// 激活获取所有字段
 	// 输出邮件头信息
-	fmt.Printf("Message-ID: %s\n", p.MessageID)
-	fmt.Printf("Subject: %s\n", p.Subject)
-	fmt.Printf("Date: %s, unix: %d\n", p.Date, p.DateUnix)
-	fmt.Printf("From: %s <%s>\n", p.From.Name, p.From.Email)
-	fmt.Printf("To:\n")
+	fmt.Fprintf(w, "Message-ID: %s\n", p.MessageID)
+	fmt.Fprintf(w, "Subject: %s\n", p.Subject)
+	fmt.Fprintf(w, "Date: %s, unix: %d\n", p.Date, p.DateUnix)
+	fmt.Fprintf(w, "From: %s <%s>\n", p.From.Name, p.From.Email)
+	fmt.Fprintf(w, "To:\n")
 	for _, to := range p.To {
-		fmt.Printf("  %s <%s>; %s\n", to.Name, to.Email, string(to.NameRaw))
+		fmt.Fprintf(w, "  %s <%s>; %s\n", to.Name, to.Email, string(to.NameRaw))
 	}
-	fmt.Printf("Cc:\n")
+	fmt.Fprintf(w, "Cc:\n")
 	for _, cc := range p.Cc {
-		fmt.Printf("  %s <%s>\n", cc.Name, cc.Email)
+		fmt.Fprintf(w, "  %s <%s>\n", cc.Name, cc.Email)
 	}
-	fmt.Printf("Bcc:\n")
+	fmt.Fprintf(w, "Bcc:\n")
 	for _, bcc := range p.Bcc {
-		fmt.Printf("  %s <%s>\n", bcc.Name, bcc.Email)
+		fmt.Fprintf(w, "  %s <%s>\n", bcc.Name, bcc.Email)
 	}
-	fmt.Printf("Sender: %s <%s>\n", p.Sender.Name, p.Sender.Email)
-	fmt.Printf("Reply-To: %s <%s>\n", p.ReplyTo.Name, p.ReplyTo.Email)
-	fmt.Printf("Disposition-Notification-To: %s <%s>\n", p.DispositionNotificationTo.Name, p.DispositionNotificationTo.Email)
-	fmt.Printf("References:\n")
+	fmt.Fprintf(w, "Sender: %s <%s>\n", p.Sender.Name, p.Sender.Email)
+	fmt.Fprintf(w, "Reply-To: %s <%s>\n", p.ReplyTo.Name, p.ReplyTo.Email)
+	fmt.Fprintf(w, "Disposition-Notification-To: %s <%s>\n", p.DispositionNotificationTo.Name, p.DispositionNotificationTo.Email)
+	fmt.Fprintf(w, "References:\n")
 	for _, ref := range p.GetReferences() {
-		fmt.Printf("  %s\n", ref)
+		fmt.Fprintf(w, "  %s\n", ref)
 	}
 
 	// 正文
@@ -37,30 +45,38 @@ func (p *EmailParser) DebugShow() {
 	for _, n := range tmpAlternativeShowNodes {
 		alternativeShowNodes[n] = true
 	}
-	fmt.Printf("Text Nodes:\n")
+	fmt.Fprintf(w, "Text Nodes:\n")
 	for _, n := range p.GetTextNodes() {
-		fmt.Printf("---Text Node---\n")
-		fmt.Printf("Alternative Show Node: %v\n", alternativeShowNodes[n])
-		fmt.Printf("Content-Type: %s\n", n.ContentType)
-		fmt.Printf("Encoding: %s\n", n.Encoding)
-		fmt.Printf("Charset: %s\n", n.Charset)
+		fmt.Fprintf(w, "---Text Node---\n")
+		fmt.Fprintf(w, "Alternative Show Node: %v\n", alternativeShowNodes[n])
+		fmt.Fprintf(w, "Content-Type: %s\n", n.ContentType)
+		fmt.Fprintf(w, "Encoding: %s\n", n.Encoding)
+		fmt.Fprintf(w, "Charset: %s\n", n.Charset)
 		con := n.GetDecodedTextContent()
-		fmt.Printf("Size: %d\n", len([]byte(con)))
+		fmt.Fprintf(w, "Size: %d\n", len([]byte(con)))
 		if len(con) > 120 {
 			con = con[0:120] + "..."
 		}
-		fmt.Printf("  %s\n", string(con))
+		fmt.Fprintf(w, "  %s\n", string(con))
 	}
 	// 附件
-	fmt.Printf("Attachment Nodes:\n")
+	fmt.Fprintf(w, "Attachment Nodes:\n")
 	for _, n := range p.GetAttachmentNodes() {
-		fmt.Printf("---Attachment Node---\n")
-		fmt.Printf("Content-Type: %s\n", n.ContentType)
-		fmt.Printf("Content-ID: %s\n", n.ContentID)
-		fmt.Printf("FileName: %s\n", n.Filename)
-		fmt.Printf("Name: %s\n", n.Name)
-		fmt.Printf("IsInline: %v\n", n.IsInlineAttachment())
-		fmt.Printf("IsTnef: %v\n", n.IsTnef("CONTENT-TYPE"))
-		fmt.Printf("Size: %d\n", len(n.GetDecodedContent()))
+		fmt.Fprintf(w, "---Attachment Node---\n")
+		fmt.Fprintf(w, "Content-Type: %s\n", n.ContentType)
+		fmt.Fprintf(w, "Content-ID: %s\n", n.ContentID)
+		fmt.Fprintf(w, "FileName: %s\n", n.Filename)
+		fmt.Fprintf(w, "Name: %s\n", n.Name)
+		fmt.Fprintf(w, "IsInline: %v\n", n.IsInlineAttachment())
+		fmt.Fprintf(w, "IsTnef: %v\n", n.IsTnef("CONTENT-TYPE"))
+		fmt.Fprintf(w, "Size: %d\n", len(n.GetDecodedContent()))
+		if embedded := n.GetEmbeddedEmailParser(); embedded != nil {
+			fmt.Fprintf(w, "Embedded Message: %s <%s>, %s\n", embedded.From.Name, embedded.From.Email, embedded.Subject)
+		}
+	}
+	// 缺陷
+	fmt.Fprintf(w, "Defects:\n")
+	for _, d := range p.GetDefects() {
+		fmt.Fprintf(w, "  %d: %s\n", d.Offset, d.String())
 	}
 }
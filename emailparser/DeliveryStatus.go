@@ -0,0 +1,207 @@
+package emailparser
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+)
+
+// DeliveryStatusRecipient 投递状态通知中一个收件人的字段（RFC 3464 2.3）
+type DeliveryStatusRecipient struct {
+	FinalRecipient      string     `json:"finalRecipient"`      // 去掉地址类型（rfc822;）后的地址
+	FinalRecipientType  string     `json:"finalRecipientType"`  // 地址类型，如 rfc822，小写
+	OriginalRecipient   string     `json:"originalRecipient"`   // 去掉地址类型后的地址
+	Action              string     `json:"action"`              // failed、delayed、delivered、relayed、expanded，小写
+	Status              string     `json:"status"`              // 如 5.1.1
+	DiagnosticCode      string     `json:"diagnosticCode"`      // 去掉诊断类型（smtp;）后的内容
+	DiagnosticCodeType  string     `json:"diagnosticCodeType"`  // 诊断类型，如 smtp，小写
+	RemoteMTA           string     `json:"remoteMta"`           // 去掉类型（dns;）后的主机名
+	LastAttemptDate     string     `json:"lastAttemptDate"`     //
+	LastAttemptDateUnix int64      `json:"lastAttemptDateUnix"` // 无法解析时为0
+	WillRetryUntil      string     `json:"willRetryUntil"`      //
+	FinalLogID          string     `json:"finalLogId"`          //
+	Fields              []MimeLine `json:"-"`                   // 所有字段
+}
+
+// IsPermanentFailure 是否为永久失败（Action 为 failed 或状态码为 5.X.X）
+func (r *DeliveryStatusRecipient) IsPermanentFailure() bool {
+	return r.Action == "failed" || strings.HasPrefix(r.Status, "5.")
+}
+
+// DeliveryStatus 投递状态通知（RFC 3464 的 MULTIPART/REPORT; report-type=delivery-status）
+type DeliveryStatus struct {
+	ReportingMTA       string                     `json:"reportingMta"` // 去掉类型（dns;）后的主机名
+	DSNGateway         string                     `json:"dsnGateway"`
+	ReceivedFromMTA    string                     `json:"receivedFromMta"`
+	OriginalEnvelopeID string                     `json:"originalEnvelopeId"`
+	ArrivalDate        string                     `json:"arrivalDate"`
+	ArrivalDateUnix    int64                      `json:"arrivalDateUnix"` // 无法解析时为0
+	Fields             []MimeLine                 `json:"-"`               // 所有的 per-message 字段
+	Recipients         []*DeliveryStatusRecipient `json:"recipients"`
+	Description        string                     `json:"description"` // 第一部分的说明文字
+	// 退回的原始邮件（MESSAGE/RFC822）或原始头部（TEXT/RFC822-HEADERS），都没有时为nil
+	OriginalMessage *EmailParser `json:"-"`
+}
+
+// splitDeliveryStatusTyped 拆分 "type; value" 格式的字段值，返回小写的类型和值；没有分号时类型为空
+func splitDeliveryStatusTyped(value []byte) (string, string) {
+	typ, rest, found := strings.Cut(string(value), ";")
+	if !found {
+		return "", strings.TrimSpace(typ)
+	}
+	return strings.ToLower(strings.TrimSpace(typ)), strings.TrimSpace(rest)
+}
+
+// splitDeliveryStatusGroups 将 delivery-status 正文按空行拆分为若干字段组，每组按头部格式解析
+func splitDeliveryStatusGroups(data []byte) [][]MimeLine {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	var groups [][]MimeLine
+	var lines []MimeLine
+	var logicLine []byte
+	flushLine := func() {
+		if len(logicLine) > 0 {
+			emailParserAppendOneLine(&lines, logicLine, -1)
+			logicLine = nil
+		}
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			flushLine()
+			if len(lines) > 0 {
+				groups = append(groups, lines)
+				lines = nil
+			}
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(logicLine) > 0 {
+			logicLine = append(logicLine, line...)
+			continue
+		}
+		flushLine()
+		logicLine = append([]byte(nil), line...)
+	}
+	flushLine()
+	if len(lines) > 0 {
+		groups = append(groups, lines)
+	}
+	return groups
+}
+
+func getDeliveryStatusField(lines []MimeLine, name string) []byte {
+	for _, line := range lines {
+		if line.Name == name {
+			return line.Value
+		}
+	}
+	return nil
+}
+
+func parseDeliveryStatusDate(value string) int64 {
+	if t, err := mail.ParseDate(value); err == nil {
+		return t.Unix()
+	}
+	return 0
+}
+
+// ParseDeliveryStatusFields 解析 MESSAGE/DELIVERY-STATUS 的正文：第一组为 per-message 字段，其后每组为一个收件人
+func ParseDeliveryStatusFields(data []byte) *DeliveryStatus {
+	ds := &DeliveryStatus{}
+	groups := splitDeliveryStatusGroups(data)
+	if len(groups) == 0 {
+		return ds
+	}
+	message := groups[0]
+	ds.Fields = message
+	_, ds.ReportingMTA = splitDeliveryStatusTyped(getDeliveryStatusField(message, "REPORTING-MTA"))
+	_, ds.DSNGateway = splitDeliveryStatusTyped(getDeliveryStatusField(message, "DSN-GATEWAY"))
+	_, ds.ReceivedFromMTA = splitDeliveryStatusTyped(getDeliveryStatusField(message, "RECEIVED-FROM-MTA"))
+	ds.OriginalEnvelopeID = string(getDeliveryStatusField(message, "ORIGINAL-ENVELOPE-ID"))
+	ds.ArrivalDate = string(getDeliveryStatusField(message, "ARRIVAL-DATE"))
+	ds.ArrivalDateUnix = parseDeliveryStatusDate(ds.ArrivalDate)
+
+	for _, fields := range groups[1:] {
+		r := &DeliveryStatusRecipient{Fields: fields}
+		r.FinalRecipientType, r.FinalRecipient = splitDeliveryStatusTyped(getDeliveryStatusField(fields, "FINAL-RECIPIENT"))
+		_, r.OriginalRecipient = splitDeliveryStatusTyped(getDeliveryStatusField(fields, "ORIGINAL-RECIPIENT"))
+		r.Action = strings.ToLower(strings.TrimSpace(string(getDeliveryStatusField(fields, "ACTION"))))
+		// 状态码后可能带有注释，如 "5.1.1 (bad destination mailbox address)"
+		if status := strings.Fields(string(getDeliveryStatusField(fields, "STATUS"))); len(status) > 0 {
+			r.Status = status[0]
+		}
+		r.DiagnosticCodeType, r.DiagnosticCode = splitDeliveryStatusTyped(getDeliveryStatusField(fields, "DIAGNOSTIC-CODE"))
+		_, r.RemoteMTA = splitDeliveryStatusTyped(getDeliveryStatusField(fields, "REMOTE-MTA"))
+		r.LastAttemptDate = string(getDeliveryStatusField(fields, "LAST-ATTEMPT-DATE"))
+		r.LastAttemptDateUnix = parseDeliveryStatusDate(r.LastAttemptDate)
+		r.WillRetryUntil = string(getDeliveryStatusField(fields, "WILL-RETRY-UNTIL"))
+		r.FinalLogID = string(getDeliveryStatusField(fields, "FINAL-LOG-ID"))
+		ds.Recipients = append(ds.Recipients, r)
+	}
+	return ds
+}
+
+// isDeliveryStatusReport 是否为 MULTIPART/REPORT; report-type=delivery-status
+func (n *MIMENode) isDeliveryStatusReport() bool {
+	if n.ContentType != "MULTIPART/REPORT" {
+		return false
+	}
+	vp := ParseMimeValueParams(n.GetHeaderValueIgnoreNotFound("CONTENT-TYPE"))
+	reportType := strings.ToLower(string(vp.TrimmedParam("REPORT-TYPE")))
+	return reportType == "delivery-status" || reportType == "global-delivery-status"
+}
+
+// findDeliveryStatusReport 查找投递状态报告节点（不进入内嵌邮件）
+func findDeliveryStatusReport(node *MIMENode) *MIMENode {
+	if node.isDeliveryStatusReport() {
+		return node
+	}
+	for _, child := range node.Childs {
+		if found := findDeliveryStatusReport(child); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// GetDeliveryStatus 解析投递状态通知（退信），不是 MULTIPART/REPORT; report-type=delivery-status 时返回nil
+func (p *EmailParser) GetDeliveryStatus() *DeliveryStatus {
+	if p.deliveryStatusDealed {
+		return p.deliveryStatus
+	}
+	p.deliveryStatusDealed = true
+	report := findDeliveryStatusReport(p.topNode)
+	if report == nil {
+		return nil
+	}
+	var statusNode, original, description *MIMENode
+	for _, child := range report.Childs {
+		switch child.ContentType {
+		case "MESSAGE/DELIVERY-STATUS", "MESSAGE/GLOBAL-DELIVERY-STATUS":
+			if statusNode == nil {
+				statusNode = child
+			}
+		case "MESSAGE/RFC822", "MESSAGE/GLOBAL", "TEXT/RFC822-HEADERS", "MESSAGE/GLOBAL-HEADERS":
+			if original == nil {
+				original = child
+			}
+		case "TEXT/PLAIN":
+			if description == nil {
+				description = child
+			}
+		}
+	}
+	if statusNode == nil {
+		return nil
+	}
+	ds := ParseDeliveryStatusFields(statusNode.GetDecodedContent())
+	if description != nil {
+		ds.Description = strings.TrimSpace(description.GetDecodedTextContent())
+	}
+	if original != nil {
+		// 原始头部和未能展开的内嵌邮件按内层邮件解析
+		if ds.OriginalMessage = original.GetEmbeddedEmailParser(); ds.OriginalMessage == nil {
+			ds.OriginalMessage = original.NewInnerEmailParser(original.GetDecodedContent())
+		}
+	}
+	p.deliveryStatus = ds
+	return ds
+}
@@ -0,0 +1,239 @@
+package emailparser
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// EmailParser 的 JSON 表示，字段名和含义保持稳定，可直接作为服务接口的返回值
+// 媒体类型、传输编码、处置类型输出为小写；partId 与 IMAP 部分编号一致（见 ImapSection.go）
+
+// MimeAddressJSON 地址
+type MimeAddressJSON struct {
+	Name  string `json:"name"`  // 解码后的名称
+	Email string `json:"email"` // 邮件地址（小写）
+}
+
+// MimeHeaderJSON 头部行
+type MimeHeaderJSON struct {
+	Name  string `json:"name"`  // 原始头部名（保留大小写）
+	Value string `json:"value"` // 去除折行后的原始值（encoded-word 不解码）
+}
+
+// MIMENodeJSON MIME 节点
+type MIMENodeJSON struct {
+	PartID       string           `json:"partId"`                // IMAP 部分编号，最外层多部分节点为空
+	ContentType  string           `json:"contentType"`           // 如 text/plain、multipart/mixed
+	Charset      string           `json:"charset,omitempty"`     // 字符集
+	Encoding     string           `json:"encoding,omitempty"`    // 传输编码
+	Disposition  string           `json:"disposition,omitempty"` // inline、attachment
+	Filename     string           `json:"filename,omitempty"`    // Content-Disposition 中的文件名
+	Name         string           `json:"name,omitempty"`        // Content-Type 中的名称
+	ContentID    string           `json:"contentId,omitempty"`   // 不含尖括号
+	HeaderOffset int              `json:"headerOffset"`          // 头部在 EmailData 中的偏移
+	BodyOffset   int              `json:"bodyOffset"`            // 正文在 EmailData 中的偏移
+	Size         int              `json:"size"`                  // 正文原始（未解码）长度
+	IsAttachment bool             `json:"isAttachment"`          // 是否为附件
+	IsInline     bool             `json:"isInline"`              // 是否为正文中以 cid: 引用的内嵌附件
+	IsVirtual    bool             `json:"isVirtual,omitempty"`   // 是否为 TNEF 等容器解码生成的节点（partId 为容器的编号）
+	Headers      []MimeHeaderJSON `json:"headers"`               // 头部行
+	Childs       []*MIMENodeJSON  `json:"childs,omitempty"`      // 子节点
+	Message      *EmailJSON       `json:"message,omitempty"`     // 内嵌邮件（MESSAGE/RFC822、MESSAGE/GLOBAL）
+	Inner        *EmailJSON       `json:"inner,omitempty"`       // 解密或解包后的内层邮件（见 NewInnerEmailParser）
+}
+
+// MimeTextJSON 正文
+type MimeTextJSON struct {
+	PartID      string `json:"partId"`
+	ContentType string `json:"contentType"` // text/plain、text/html
+	Content     string `json:"content"`     // 解码并转换为 UTF-8 的内容
+}
+
+// EmailJSON 邮件
+type EmailJSON struct {
+	MessageID                 string            `json:"messageId"` // 不含尖括号
+	Subject                   string            `json:"subject"`
+	Date                      string            `json:"date"`     // Date 头部原始值
+	DateUnix                  int64             `json:"dateUnix"` // 解析失败时为0
+	From                      *MimeAddressJSON  `json:"from"`     // 不存在时为 null，下同
+	Sender                    *MimeAddressJSON  `json:"sender"`
+	ReplyTo                   *MimeAddressJSON  `json:"replyTo"`
+	DispositionNotificationTo *MimeAddressJSON  `json:"dispositionNotificationTo"`
+	To                        []MimeAddressJSON `json:"to"` // 不存在时为空数组，下同
+	Cc                        []MimeAddressJSON `json:"cc"`
+	Bcc                       []MimeAddressJSON `json:"bcc"`
+	References                []string          `json:"references"`
+	Size                      int               `json:"size"`        // 邮件长度
+	Headers                   []MimeHeaderJSON  `json:"headers"`     // 顶层头部行
+	Root                      *MIMENodeJSON     `json:"root"`        // MIME 树
+	Texts                     []MimeTextJSON    `json:"texts"`       // 用于显示的正文（同一 MULTIPART/ALTERNATIVE 中优先取 HTML）
+	Attachments               []string          `json:"attachments"` // 附件节点的 partId
+	Defects                   []Defect          `json:"defects"`     // 解析缺陷
+}
+
+func joinImapPartID(prefix string, n int) string {
+	if prefix == "" {
+		return strconv.Itoa(n)
+	}
+	return prefix + "." + strconv.Itoa(n)
+}
+
+// assignImapPartIDs 按 IMAP 规则为邮件的节点编号，prefix 为邮件所在 MESSAGE/RFC822 节点的编号
+func assignImapPartIDs(top *MIMENode, prefix string, ids map[*MIMENode]string) {
+	var assign func(node *MIMENode, id string)
+	assign = func(node *MIMENode, id string) {
+		ids[node] = id
+		for i, child := range node.Childs {
+			assign(child, joinImapPartID(id, i+1))
+		}
+	}
+	if strings.HasPrefix(top.ContentType, "MULTIPART/") {
+		assign(top, prefix)
+	} else {
+		assign(top, joinImapPartID(prefix, 1))
+	}
+}
+
+// getRawHeaderName 返回头部行原始的名称（保留大小写）
+func (n *MIMENode) getRawHeaderName(line MimeLine) string {
+	if line.edited {
+		return line.rawName
+	}
+	raw := n.getImapRawHeaderLine(line)
+	if idx := strings.IndexByte(string(raw), ':'); idx > 0 {
+		return strings.TrimSpace(string(raw[:idx]))
+	}
+	return line.Name
+}
+
+func (n *MIMENode) getHeadersJSON() []MimeHeaderJSON {
+	headers := make([]MimeHeaderJSON, 0, len(n.Header))
+	for _, line := range n.Header {
+		headers = append(headers, MimeHeaderJSON{
+			Name:  n.getRawHeaderName(line),
+			Value: string(line.Value),
+		})
+	}
+	return headers
+}
+
+func newMimeAddressJSON(address MimeAddress) *MimeAddressJSON {
+	if address.Email == "" && address.Name == "" {
+		return nil
+	}
+	return &MimeAddressJSON{Name: address.Name, Email: address.Email}
+}
+
+func newMimeAddressListJSON(addresses []MimeAddress) []MimeAddressJSON {
+	result := make([]MimeAddressJSON, 0, len(addresses))
+	for _, address := range addresses {
+		result = append(result, MimeAddressJSON{Name: address.Name, Email: address.Email})
+	}
+	return result
+}
+
+// getJSON 生成邮件的 JSON 表示，prefix 为内嵌邮件所在节点的 IMAP 编号
+func (p *EmailParser) getJSON(prefix string) *EmailJSON {
+	ids := make(map[*MIMENode]string)
+	assignImapPartIDs(p.topNode, prefix, ids)
+	partID := func(node *MIMENode) string {
+		if node.isVirtual {
+			return ids[node.Parent]
+		}
+		return ids[node]
+	}
+
+	attachments := make(map[*MIMENode]bool)
+	result := &EmailJSON{
+		MessageID:                 p.MessageID,
+		Subject:                   p.Subject,
+		Date:                      p.Date,
+		DateUnix:                  p.DateUnix,
+		From:                      newMimeAddressJSON(p.From),
+		Sender:                    newMimeAddressJSON(p.Sender),
+		ReplyTo:                   newMimeAddressJSON(p.ReplyTo),
+		DispositionNotificationTo: newMimeAddressJSON(p.DispositionNotificationTo),
+		To:                        newMimeAddressListJSON(p.To),
+		Cc:                        newMimeAddressListJSON(p.Cc),
+		Bcc:                       newMimeAddressListJSON(p.Bcc),
+		References:                p.GetReferences(),
+		Size:                      p.topNode.BodyStart + p.topNode.BodyLen - p.topNode.HeaderStart,
+		Headers:                   p.topNode.getHeadersJSON(),
+		Texts:                     []MimeTextJSON{},
+		Attachments:               []string{},
+		Defects:                   p.GetDefects(),
+	}
+	for _, node := range p.GetAttachmentNodes() {
+		attachments[node] = true
+		if !node.isVirtual {
+			result.Attachments = append(result.Attachments, partID(node))
+		}
+	}
+	for _, node := range p.GetAlternativeShowNodes() {
+		result.Texts = append(result.Texts, MimeTextJSON{
+			PartID:      partID(node),
+			ContentType: strings.ToLower(node.ContentType),
+			Content:     node.GetDecodedTextContent(),
+		})
+	}
+	if result.Defects == nil {
+		result.Defects = []Defect{}
+	}
+
+	nodes := make(map[*MIMENode]*MIMENodeJSON)
+	var build func(node *MIMENode) *MIMENodeJSON
+	build = func(node *MIMENode) *MIMENodeJSON {
+		nj := &MIMENodeJSON{
+			PartID:       partID(node),
+			ContentType:  strings.ToLower(node.ContentType),
+			Charset:      node.Charset,
+			Encoding:     strings.ToLower(node.Encoding),
+			Disposition:  strings.ToLower(node.Disposition),
+			Filename:     node.Filename,
+			Name:         node.Name,
+			ContentID:    node.ContentID,
+			HeaderOffset: node.HeaderStart,
+			BodyOffset:   node.BodyStart,
+			Size:         len(node.GetRawContent()),
+			IsAttachment: attachments[node],
+			IsInline:     attachments[node] && node.IsInlineAttachment(),
+			IsVirtual:    node.isVirtual,
+			Headers:      node.getHeadersJSON(),
+		}
+		if !node.isVirtual {
+			nj.Size = node.BodyLen
+		}
+		nodes[node] = nj
+		for _, child := range node.Childs {
+			nj.Childs = append(nj.Childs, build(child))
+		}
+		if node.isEmbeddedMessageType() {
+			if embedded := node.GetEmbeddedEmailParser(); embedded != nil {
+				nj.Message = embedded.getJSON(nj.PartID)
+			}
+		}
+		if node.innerParser != nil {
+			nj.Inner = node.innerParser.getJSON(nj.PartID)
+		}
+		return nj
+	}
+	result.Root = build(p.topNode)
+	// TNEF 解码出的正文和附件没有对应的 MIME 节点，作为子节点附加在容器节点下
+	for _, node := range append(p.GetTextNodes(), p.GetAttachmentNodes()...) {
+		if container := nodes[node.Parent]; node.isVirtual && container != nil {
+			container.Childs = append(container.Childs, build(node))
+		}
+	}
+	return result
+}
+
+// GetJSON 返回邮件的 JSON 表示
+func (p *EmailParser) GetJSON() *EmailJSON {
+	return p.getJSON("")
+}
+
+// MarshalJSON 实现 json.Marshaler，json.Marshal(parser) 输出 GetJSON 的结果
+func (p *EmailParser) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.GetJSON())
+}
@@ -0,0 +1,291 @@
+package emailparser
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 按 RFC 3501 / RFC 9051 生成 IMAP FETCH 的 BODY、BODYSTRUCTURE、ENVELOPE 响应数据
+// 字符串字段使用邮件中的原始值（encoded-word 不解码），由客户端自行解码
+
+// writeImapNString 输出 nstring：空值为 NIL，可打印 ASCII 用 quoted，否则用 literal
+func writeImapNString(buf *bytes.Buffer, value []byte) {
+	if value == nil {
+		buf.WriteString("NIL")
+		return
+	}
+	writeImapString(buf, value)
+}
+
+func writeImapString(buf *bytes.Buffer, value []byte) {
+	quoted := len(value) < 1024
+	for _, c := range value {
+		if c < 0x20 || c >= 0x7f {
+			quoted = false
+			break
+		}
+	}
+	if !quoted {
+		buf.WriteString("{" + strconv.Itoa(len(value)) + "}\r\n")
+		buf.Write(value)
+		return
+	}
+	buf.WriteByte('"')
+	for _, c := range value {
+		if c == '"' || c == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteByte('"')
+}
+
+// imapHeaderValue 返回头部原始值，不存在时返回nil
+func (n *MIMENode) imapHeaderValue(name string) []byte {
+	value, err := n.GetHeaderValue(name)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// writeImapParams 输出参数列表 ("NAME" "VALUE" ...)，无参数时为 NIL
+func writeImapParams(buf *bytes.Buffer, params map[string][]byte) {
+	if len(params) == 0 {
+		buf.WriteString("NIL")
+		return
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf.WriteByte('(')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		writeImapString(buf, []byte(key))
+		buf.WriteByte(' ')
+		writeImapString(buf, params[key])
+	}
+	buf.WriteByte(')')
+}
+
+// countImapLines 统计正文行数
+func countImapLines(body []byte) int {
+	lines := bytes.Count(body, []byte("\n"))
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// splitImapContentType 拆分媒体类型为 type 和 subtype
+func (n *MIMENode) splitImapContentType() (string, string) {
+	mediaType, subtype, ok := strings.Cut(n.ContentType, "/")
+	if !ok || subtype == "" {
+		// 非法的 Content-Type 按 TEXT/PLAIN 处理
+		return "TEXT", "PLAIN"
+	}
+	return mediaType, subtype
+}
+
+// writeImapExtension 输出 body-ext-1part / body-ext-mpart 中 disposition 及之后的公共部分
+func (n *MIMENode) writeImapExtension(buf *bytes.Buffer) {
+	buf.WriteByte(' ')
+	if value := n.imapHeaderValue("CONTENT-DISPOSITION"); value != nil {
+		vp := ParseMimeValueParams(value)
+		buf.WriteByte('(')
+		writeImapString(buf, bytes.ToUpper(bytes.TrimSpace(vp.Value)))
+		buf.WriteByte(' ')
+		writeImapParams(buf, vp.Params)
+		buf.WriteByte(')')
+	} else {
+		buf.WriteString("NIL")
+	}
+
+	buf.WriteByte(' ')
+	var languages [][]byte
+	for _, lang := range bytes.Split(n.imapHeaderValue("CONTENT-LANGUAGE"), []byte(",")) {
+		if lang = bytes.TrimSpace(lang); len(lang) > 0 {
+			languages = append(languages, lang)
+		}
+	}
+	switch len(languages) {
+	case 0:
+		buf.WriteString("NIL")
+	case 1:
+		writeImapString(buf, languages[0])
+	default:
+		buf.WriteByte('(')
+		for i, lang := range languages {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeImapString(buf, lang)
+		}
+		buf.WriteByte(')')
+	}
+
+	buf.WriteByte(' ')
+	writeImapNString(buf, n.imapHeaderValue("CONTENT-LOCATION"))
+}
+
+// getImapEmbeddedParser 返回 MESSAGE/RFC822 节点的内嵌邮件，超出嵌套层数时单独解析（不再展开更深的内嵌邮件）
+func (n *MIMENode) getImapEmbeddedParser() *EmailParser {
+	if embedded := n.GetEmbeddedEmailParser(); embedded != nil {
+		return embedded
+	}
+	return EmailParserNew(EmailParserOptions{
+		DefaultCharset:  n.EmailParser.DefaultCharset,
+		EmailData:       n.GetDecodedContent(),
+		MaxNestingDepth: -1,
+	})
+}
+
+// writeImapBodyStructure 输出节点的 body，extended 为 true 时包含扩展数据（BODYSTRUCTURE）
+func (n *MIMENode) writeImapBodyStructure(buf *bytes.Buffer, extended bool) {
+	mediaType, subtype := n.splitImapContentType()
+	buf.WriteByte('(')
+
+	if mediaType == "MULTIPART" {
+		if len(n.Childs) == 0 {
+			// 没有子节点的多部分节点按空的 TEXT/PLAIN 输出
+			buf.WriteString(`("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 0 0)`)
+		}
+		for _, child := range n.Childs {
+			child.writeImapBodyStructure(buf, extended)
+		}
+		buf.WriteByte(' ')
+		writeImapString(buf, []byte(subtype))
+		if extended {
+			buf.WriteByte(' ')
+			writeImapParams(buf, ParseMimeValueParams(n.imapHeaderValue("CONTENT-TYPE")).Params)
+			n.writeImapExtension(buf)
+		}
+		buf.WriteByte(')')
+		return
+	}
+
+	writeImapString(buf, []byte(mediaType))
+	buf.WriteByte(' ')
+	writeImapString(buf, []byte(subtype))
+	buf.WriteByte(' ')
+	params := ParseMimeValueParams(n.imapHeaderValue("CONTENT-TYPE")).Params
+	if len(params) == 0 && mediaType == "TEXT" {
+		params = map[string][]byte{"CHARSET": []byte("US-ASCII")}
+	}
+	writeImapParams(buf, params)
+	buf.WriteByte(' ')
+	writeImapNString(buf, n.imapHeaderValue("CONTENT-ID"))
+	buf.WriteByte(' ')
+	writeImapNString(buf, n.imapHeaderValue("CONTENT-DESCRIPTION"))
+	buf.WriteByte(' ')
+	encoding := n.Encoding
+	if encoding == "" {
+		encoding = "7BIT"
+	}
+	writeImapString(buf, []byte(encoding))
+	buf.WriteString(" " + strconv.Itoa(n.BodyLen))
+
+	if n.isEmbeddedMessageType() {
+		embedded := n.getImapEmbeddedParser()
+		buf.WriteByte(' ')
+		embedded.writeImapEnvelope(buf)
+		buf.WriteByte(' ')
+		embedded.topNode.writeImapBodyStructure(buf, extended)
+		buf.WriteString(" " + strconv.Itoa(countImapLines(n.GetRawContent())))
+	} else if mediaType == "TEXT" {
+		buf.WriteString(" " + strconv.Itoa(countImapLines(n.GetRawContent())))
+	}
+
+	if extended {
+		buf.WriteByte(' ')
+		writeImapNString(buf, n.imapHeaderValue("CONTENT-MD5"))
+		n.writeImapExtension(buf)
+	}
+	buf.WriteByte(')')
+}
+
+// writeImapAddressList 输出地址列表 ((name adl mailbox host) ...)，无地址时为 NIL
+func writeImapAddressList(buf *bytes.Buffer, value []byte, defaultCharset string) {
+	var addresses []MimeAddress
+	if value != nil {
+		addresses = ParseMimeAddress(value, defaultCharset)
+	}
+	if len(addresses) == 0 {
+		buf.WriteString("NIL")
+		return
+	}
+	buf.WriteByte('(')
+	for _, address := range addresses {
+		buf.WriteByte('(')
+		name := bytes.TrimSpace(address.NameRaw)
+		if len(name) == 0 {
+			name = nil
+		}
+		writeImapNString(buf, name)
+		buf.WriteString(" NIL ")
+		mailbox, host := address.Email, ""
+		if idx := strings.LastIndexByte(address.Email, '@'); idx >= 0 {
+			mailbox, host = address.Email[:idx], address.Email[idx+1:]
+		}
+		writeImapString(buf, []byte(mailbox))
+		buf.WriteByte(' ')
+		if host == "" {
+			buf.WriteString("NIL")
+		} else {
+			writeImapString(buf, []byte(host))
+		}
+		buf.WriteByte(')')
+	}
+	buf.WriteByte(')')
+}
+
+// writeImapEnvelope 输出 ENVELOPE：(date subject from sender reply-to to cc bcc in-reply-to message-id)
+func (p *EmailParser) writeImapEnvelope(buf *bytes.Buffer) {
+	top := p.topNode
+	buf.WriteByte('(')
+	writeImapNString(buf, top.imapHeaderValue("DATE"))
+	buf.WriteByte(' ')
+	writeImapNString(buf, top.imapHeaderValue("SUBJECT"))
+	from := top.imapHeaderValue("FROM")
+	for _, name := range []string{"FROM", "SENDER", "REPLY-TO", "TO", "CC", "BCC"} {
+		buf.WriteByte(' ')
+		value := top.imapHeaderValue(name)
+		if (name == "SENDER" || name == "REPLY-TO") && len(ParseMimeAddress(value, p.DefaultCharset)) == 0 {
+			// Sender、Reply-To 缺失时取 From
+			value = from
+		}
+		writeImapAddressList(buf, value, p.DefaultCharset)
+	}
+	buf.WriteByte(' ')
+	writeImapNString(buf, top.imapHeaderValue("IN-REPLY-TO"))
+	buf.WriteByte(' ')
+	writeImapNString(buf, top.imapHeaderValue("MESSAGE-ID"))
+	buf.WriteByte(')')
+}
+
+// GetImapEnvelope 返回 FETCH ENVELOPE 的数据
+func (p *EmailParser) GetImapEnvelope() string {
+	var buf bytes.Buffer
+	p.writeImapEnvelope(&buf)
+	return buf.String()
+}
+
+// GetImapBody 返回 FETCH BODY 的数据（不含扩展数据）
+func (p *EmailParser) GetImapBody() string {
+	var buf bytes.Buffer
+	p.topNode.writeImapBodyStructure(&buf, false)
+	return buf.String()
+}
+
+// GetImapBodyStructure 返回 FETCH BODYSTRUCTURE 的数据
+func (p *EmailParser) GetImapBodyStructure() string {
+	var buf bytes.Buffer
+	p.topNode.writeImapBodyStructure(&buf, true)
+	return buf.String()
+}
@@ -0,0 +1,283 @@
+package emailparser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 按 RFC 3501 / RFC 9051 的 section 规则定位节点，生成 BODY[section]、BINARY[section]（RFC 3516）的数据
+// 编号规则：多部分节点的第 N 个子节点为 N；非多部分邮件的正文为 1；
+// MESSAGE/RFC822 节点的下一级编号作用于内嵌邮件（如 "2.1"、"2.HEADER"）
+
+var (
+	ErrImapInvalidSection = errors.New("invalid imap section")
+	ErrImapPartNotFound   = errors.New("imap section part not found")
+	ErrImapUnknownCTE     = errors.New("unknown content-transfer-encoding")
+	ErrImapCorruptContent = errors.New("corrupt content-transfer-encoding data")
+)
+
+// ImapSection 解析后的 section
+type ImapSection struct {
+	Parts     []int    // 部分编号，如 "1.2" 为 [1 2]
+	Specifier string   // 空、HEADER、HEADER.FIELDS、HEADER.FIELDS.NOT、TEXT、MIME
+	Fields    []string // HEADER.FIELDS 的头部名（大写）
+}
+
+// ParseImapSection 解析 section（BODY[...] 中括号内的部分），如 "1.2"、"2.HEADER"、"HEADER.FIELDS (FROM TO)"
+func ParseImapSection(section string) (*ImapSection, error) {
+	result := &ImapSection{}
+	rest := strings.TrimSpace(section)
+	for rest != "" {
+		token, after, found := strings.Cut(rest, ".")
+		n, err := strconv.Atoi(token)
+		if err != nil {
+			break
+		}
+		if n <= 0 || (found && after == "") {
+			return nil, ErrImapInvalidSection
+		}
+		result.Parts = append(result.Parts, n)
+		rest = after
+	}
+
+	specifier, fieldList, _ := strings.Cut(rest, " ")
+	specifier = strings.ToUpper(specifier)
+	switch specifier {
+	case "", "HEADER", "TEXT":
+	case "MIME":
+		if len(result.Parts) == 0 {
+			return nil, ErrImapInvalidSection
+		}
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		fieldList = strings.TrimSpace(fieldList)
+		if !strings.HasPrefix(fieldList, "(") || !strings.HasSuffix(fieldList, ")") {
+			return nil, ErrImapInvalidSection
+		}
+		for _, field := range strings.Fields(fieldList[1 : len(fieldList)-1]) {
+			result.Fields = append(result.Fields, strings.ToUpper(strings.Trim(field, "\"")))
+		}
+		if len(result.Fields) == 0 {
+			return nil, ErrImapInvalidSection
+		}
+		fieldList = ""
+	default:
+		return nil, ErrImapInvalidSection
+	}
+	if strings.TrimSpace(fieldList) != "" {
+		return nil, ErrImapInvalidSection
+	}
+	result.Specifier = specifier
+	return result, nil
+}
+
+// getImapMessageTop 返回节点作为邮件时的顶层节点：MESSAGE/RFC822 节点返回内嵌邮件的顶层节点
+func (n *MIMENode) getImapMessageTop() *MIMENode {
+	if n.isEmbeddedMessageType() {
+		return n.getImapEmbeddedParser().topNode
+	}
+	return nil
+}
+
+// GetNodeByImapParts 按部分编号查找节点，parts 为空时返回顶层节点
+func (p *EmailParser) GetNodeByImapParts(parts []int) (*MIMENode, error) {
+	node := p.topNode
+	isMessage := true
+	for _, n := range parts {
+		if !isMessage {
+			if top := node.getImapMessageTop(); top != nil {
+				node = top
+				isMessage = true
+			}
+		}
+		if strings.HasPrefix(node.ContentType, "MULTIPART/") {
+			if n > len(node.Childs) {
+				return nil, ErrImapPartNotFound
+			}
+			node = node.Childs[n-1]
+		} else if !isMessage || n != 1 {
+			return nil, ErrImapPartNotFound
+		}
+		isMessage = false
+	}
+	return node, nil
+}
+
+// GetNodeByImapPart 按部分编号字符串（如 "1.2"）查找节点
+func (p *EmailParser) GetNodeByImapPart(part string) (*MIMENode, error) {
+	section, err := ParseImapSection(part)
+	if err != nil {
+		return nil, err
+	}
+	if section.Specifier != "" {
+		return nil, ErrImapInvalidSection
+	}
+	return p.GetNodeByImapParts(section.Parts)
+}
+
+// getImapRawHeader 返回头部原始数据（含结尾空行）
+func (n *MIMENode) getImapRawHeader() []byte {
+	data := n.EmailParser.EmailData
+	if n.BodyStart > len(data) {
+		return []byte{}
+	}
+	return data[n.HeaderStart:n.BodyStart]
+}
+
+// getImapRawHeaderLine 返回一个头部行（含折行及换行符）的原始数据
+func (n *MIMENode) getImapRawHeaderLine(line MimeLine) []byte {
+	data := n.EmailParser.EmailData
+	headerEnd := n.HeaderStart + n.HeaderLen
+	if line.Offset < 0 || headerEnd > len(data) {
+		return nil
+	}
+	end := line.Offset
+	for end < headerEnd {
+		idx := bytes.IndexByte(data[end:headerEnd], '\n')
+		if idx == -1 {
+			end = headerEnd
+			break
+		}
+		end += idx + 1
+		if end >= headerEnd || (data[end] != ' ' && data[end] != '\t') {
+			break
+		}
+	}
+	return data[line.Offset:end]
+}
+
+// getImapHeaderFields 返回 HEADER.FIELDS / HEADER.FIELDS.NOT 的数据
+func (n *MIMENode) getImapHeaderFields(fields []string, not bool) []byte {
+	wanted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		wanted[field] = true
+	}
+	var buf bytes.Buffer
+	for _, line := range n.Header {
+		if wanted[line.Name] == not {
+			continue
+		}
+		raw := n.getImapRawHeaderLine(line)
+		buf.Write(raw)
+		if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+			buf.WriteString("\r\n")
+		}
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// GetImapSection 返回 BODY[section] 的数据
+func (p *EmailParser) GetImapSection(section string) ([]byte, error) {
+	s, err := ParseImapSection(section)
+	if err != nil {
+		return nil, err
+	}
+	node, err := p.GetNodeByImapParts(s.Parts)
+	if err != nil {
+		return nil, err
+	}
+	if s.Specifier == "" {
+		if len(s.Parts) == 0 {
+			return p.EmailData, nil
+		}
+		return node.GetRawContent(), nil
+	}
+	if s.Specifier == "MIME" {
+		return node.getImapRawHeader(), nil
+	}
+
+	// HEADER*、TEXT 作用于邮件：顶层或 MESSAGE/RFC822 节点
+	message := node
+	if len(s.Parts) > 0 {
+		if message = node.getImapMessageTop(); message == nil {
+			return nil, ErrImapInvalidSection
+		}
+	}
+	switch s.Specifier {
+	case "HEADER":
+		return message.getImapRawHeader(), nil
+	case "HEADER.FIELDS":
+		return message.getImapHeaderFields(s.Fields, false), nil
+	case "HEADER.FIELDS.NOT":
+		return message.getImapHeaderFields(s.Fields, true), nil
+	default:
+		return message.GetRawContent(), nil
+	}
+}
+
+// GetImapBinary 返回 BINARY[section] 的数据（RFC 3516），即解码传输编码后的正文
+// 无法识别的传输编码返回 ErrImapUnknownCTE，BASE64/QUOTED-PRINTABLE 数据损坏时返回包装了解码错误的 ErrImapCorruptContent
+func (p *EmailParser) GetImapBinary(section string) ([]byte, error) {
+	s, err := ParseImapSection(section)
+	if err != nil {
+		return nil, err
+	}
+	if s.Specifier != "" {
+		return nil, ErrImapInvalidSection
+	}
+	if len(s.Parts) == 0 {
+		return p.EmailData, nil
+	}
+	node, err := p.GetNodeByImapParts(s.Parts)
+	if err != nil {
+		return nil, err
+	}
+	switch node.Encoding {
+	case "", "7BIT", "8BIT", "BINARY":
+		return node.GetRawContent(), nil
+	case "BASE64":
+		data, err := base64.StdEncoding.DecodeString(string(node.GetRawContent()))
+		if err != nil {
+			node.checkBase64Defect()
+			return nil, fmt.Errorf("%w: %v", ErrImapCorruptContent, err)
+		}
+		return data, nil
+	case "QUOTED-PRINTABLE":
+		if err := checkQuotedPrintable(node.GetRawContent()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrImapCorruptContent, err)
+		}
+		return node.GetDecodedContent(), nil
+	}
+	return nil, ErrImapUnknownCTE
+}
+
+// checkQuotedPrintable 检查 QUOTED-PRINTABLE 数据：每个 "=" 后必须是两位十六进制数，或者（可带空白的）软换行
+func checkQuotedPrintable(data []byte) error {
+	isHex := func(c byte) bool {
+		return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F') || (c >= 'a' && c <= 'f')
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] != '=' {
+			continue
+		}
+		if i+2 < len(data) && isHex(data[i+1]) && isHex(data[i+2]) {
+			i += 2
+			continue
+		}
+		rest := bytes.TrimLeft(data[i+1:], " \t")
+		if len(rest) == 0 || rest[0] == '\r' || rest[0] == '\n' {
+			continue
+		}
+		return fmt.Errorf("invalid quoted-printable escape at offset %d", i)
+	}
+	return nil
+}
+
+// ImapPartial 截取 <offset.length> 部分，length 小于0表示到末尾，offset 小于0按0处理
+func ImapPartial(data []byte, offset int, length int) []byte {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(data) {
+		return []byte{}
+	}
+	data = data[offset:]
+	if length >= 0 && length < len(data) {
+		data = data[:length]
+	}
+	return data
+}
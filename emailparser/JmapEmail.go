@@ -0,0 +1,359 @@
+package emailparser
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 按 RFC 8621 生成 JMAP Email 对象的属性
+// id、blobId、threadId、mailboxIds、keywords、receivedAt 由服务端分配，生成后由调用方填写
+
+// JmapEmailAddress EmailAddress 对象
+type JmapEmailAddress struct {
+	Name  *string `json:"name"`
+	Email string  `json:"email"`
+}
+
+// JmapEmailHeader EmailHeader 对象
+type JmapEmailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"` // Raw 形式：冒号之后、结尾 CRLF 之前的原始数据
+}
+
+// JmapEmailBodyPart EmailBodyPart 对象
+type JmapEmailBodyPart struct {
+	PartID      *string              `json:"partId"` // 多部分节点为 null
+	BlobID      *string              `json:"blobId"` // 由调用方填写
+	Size        int                  `json:"size"`   // 解码后的大小
+	Headers     []JmapEmailHeader    `json:"headers"`
+	Name        *string              `json:"name"`
+	Type        string               `json:"type"`
+	Charset     *string              `json:"charset"`
+	Disposition *string              `json:"disposition"`
+	Cid         *string              `json:"cid"`
+	Language    []string             `json:"language"`
+	Location    *string              `json:"location"`
+	SubParts    []*JmapEmailBodyPart `json:"subParts,omitempty"`
+
+	node *MIMENode
+}
+
+// JmapEmailBodyValue EmailBodyValue 对象
+type JmapEmailBodyValue struct {
+	Value             string `json:"value"`
+	IsEncodingProblem bool   `json:"isEncodingProblem"`
+	IsTruncated       bool   `json:"isTruncated"`
+}
+
+// JmapEmail Email 对象
+type JmapEmail struct {
+	ID         string          `json:"id,omitempty"`
+	BlobID     string          `json:"blobId,omitempty"`
+	ThreadID   string          `json:"threadId,omitempty"`
+	MailboxIDs map[string]bool `json:"mailboxIds,omitempty"`
+	Keywords   map[string]bool `json:"keywords"` // 初始为空，由调用方填写（如 "$seen"）
+	Size       int             `json:"size"`
+	ReceivedAt string          `json:"receivedAt,omitempty"`
+
+	MessageID  []string            `json:"messageId"`
+	InReplyTo  []string            `json:"inReplyTo"`
+	References []string            `json:"references"`
+	Sender     []*JmapEmailAddress `json:"sender"`
+	From       []*JmapEmailAddress `json:"from"`
+	To         []*JmapEmailAddress `json:"to"`
+	Cc         []*JmapEmailAddress `json:"cc"`
+	Bcc        []*JmapEmailAddress `json:"bcc"`
+	ReplyTo    []*JmapEmailAddress `json:"replyTo"`
+	Subject    *string             `json:"subject"`
+	SentAt     *string             `json:"sentAt"`
+
+	BodyStructure *JmapEmailBodyPart             `json:"bodyStructure"`
+	BodyValues    map[string]*JmapEmailBodyValue `json:"bodyValues"`
+	TextBody      []*JmapEmailBodyPart           `json:"textBody"`
+	HTMLBody      []*JmapEmailBodyPart           `json:"htmlBody"`
+	Attachments   []*JmapEmailBodyPart           `json:"attachments"`
+	HasAttachment bool                           `json:"hasAttachment"`
+	Preview       string                         `json:"preview"`
+}
+
+// JmapEmailOptions 对应 Email/get 的参数
+type JmapEmailOptions struct {
+	FetchTextBodyValues bool // 输出 textBody 中各部分的 bodyValues
+	FetchHTMLBodyValues bool // 输出 htmlBody 中各部分的 bodyValues
+	FetchAllBodyValues  bool // 输出所有 text/* 部分的 bodyValues
+	MaxBodyValueBytes   int  // bodyValues 的最大字节数，0 表示不限制
+}
+
+// jmapPreviewMaxLen preview 的最大字符数
+const jmapPreviewMaxLen = 256
+
+var jmapHTMLTagRegexp = regexp.MustCompile(`(?s)<(script|style)[^>]*>.*?</(script|style)>|<[^>]*>`)
+
+func jmapStringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// parseJmapMessageIDs 解析 Message-ID、In-Reply-To、References 中的 msg-id 列表（不含尖括号），不存在时返回nil
+func parseJmapMessageIDs(value []byte) []string {
+	ids := strings.FieldsFunc(string(value), func(r rune) bool {
+		return r == '<' || r == '>' || r == ',' || r == ' ' || r == '\t'
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
+
+func (p *EmailParser) getJmapAddresses(name string) []*JmapEmailAddress {
+	value, err := p.topNode.GetHeaderValue(name)
+	if err != nil {
+		return nil
+	}
+	result := []*JmapEmailAddress{}
+	for _, address := range ParseMimeAddress(value, p.DefaultCharset) {
+		result = append(result, &JmapEmailAddress{Name: jmapStringPtr(address.Name), Email: address.Email})
+	}
+	return result
+}
+
+// getJmapRawHeaders 返回头部的 Raw 形式
+func (n *MIMENode) getJmapRawHeaders() []JmapEmailHeader {
+	headers := []JmapEmailHeader{}
+	for _, line := range n.Header {
+		header := JmapEmailHeader{Name: n.getRawHeaderName(line)}
+		if line.edited {
+			header.Value = " " + string(line.Value)
+		} else {
+			raw := string(n.getImapRawHeaderLine(line))
+			if idx := strings.IndexByte(raw, ':'); idx >= 0 {
+				header.Value = strings.TrimRight(raw[idx+1:], "\r\n")
+			}
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// newJmapBodyPart 生成 EmailBodyPart，partId 与 IMAP 部分编号一致
+func newJmapBodyPart(node *MIMENode, ids map[*MIMENode]string) *JmapEmailBodyPart {
+	part := &JmapEmailBodyPart{
+		Headers:     node.getJmapRawHeaders(),
+		Type:        strings.ToLower(node.ContentType),
+		Disposition: jmapStringPtr(strings.ToLower(node.Disposition)),
+		Cid:         jmapStringPtr(node.ContentID),
+		Location:    jmapStringPtr(strings.TrimSpace(string(node.GetHeaderValueIgnoreNotFound("CONTENT-LOCATION")))),
+		node:        node,
+	}
+	for _, lang := range strings.Split(string(node.GetHeaderValueIgnoreNotFound("CONTENT-LANGUAGE")), ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			part.Language = append(part.Language, lang)
+		}
+	}
+	if strings.HasPrefix(node.ContentType, "MULTIPART/") {
+		part.SubParts = []*JmapEmailBodyPart{}
+		for _, child := range node.Childs {
+			part.SubParts = append(part.SubParts, newJmapBodyPart(child, ids))
+		}
+		return part
+	}
+
+	part.PartID = jmapStringPtr(ids[node])
+	part.Size = len(node.GetDecodedContent())
+	if node.Filename != "" {
+		part.Name = jmapStringPtr(node.Filename)
+	} else {
+		part.Name = jmapStringPtr(node.Name)
+	}
+	if strings.HasPrefix(node.ContentType, "TEXT/") {
+		charset := node.Charset
+		if charset == "" {
+			charset = "US-ASCII"
+		}
+		part.Charset = jmapStringPtr(strings.ToLower(charset))
+	}
+	return part
+}
+
+func isJmapInlineMediaType(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "audio/") ||
+		strings.HasPrefix(contentType, "video/")
+}
+
+// parseJmapStructure RFC 8621 4.1.4 中计算 textBody、htmlBody、attachments 的算法
+func parseJmapStructure(parts []*JmapEmailBodyPart, multipartType string, inAlternative bool,
+	htmlBody *[]*JmapEmailBodyPart, textBody *[]*JmapEmailBodyPart, attachments *[]*JmapEmailBodyPart) {
+	textLength, htmlLength := -1, -1
+	if textBody != nil {
+		textLength = len(*textBody)
+	}
+	if htmlBody != nil {
+		htmlLength = len(*htmlBody)
+	}
+
+	for i, part := range parts {
+		isMultipart := strings.HasPrefix(part.Type, "multipart/")
+		isInline := (part.Disposition == nil || *part.Disposition != "attachment") &&
+			(part.Type == "text/plain" || part.Type == "text/html" || isJmapInlineMediaType(part.Type)) &&
+			(i == 0 || (multipartType != "related" && (isJmapInlineMediaType(part.Type) || part.Name == nil)))
+
+		if isMultipart {
+			subMultiType := strings.TrimPrefix(part.Type, "multipart/")
+			parseJmapStructure(part.SubParts, subMultiType, inAlternative || subMultiType == "alternative",
+				htmlBody, textBody, attachments)
+		} else if isInline {
+			if multipartType == "alternative" {
+				switch {
+				case part.Type == "text/plain" && textBody != nil:
+					*textBody = append(*textBody, part)
+				case part.Type == "text/html" && htmlBody != nil:
+					*htmlBody = append(*htmlBody, part)
+				case part.Type != "text/plain" && part.Type != "text/html":
+					*attachments = append(*attachments, part)
+				}
+				continue
+			} else if inAlternative {
+				if part.Type == "text/plain" {
+					htmlBody = nil
+				}
+				if part.Type == "text/html" {
+					textBody = nil
+				}
+			}
+			if textBody != nil {
+				*textBody = append(*textBody, part)
+			}
+			if htmlBody != nil {
+				*htmlBody = append(*htmlBody, part)
+			}
+			if (textBody == nil || htmlBody == nil) && isJmapInlineMediaType(part.Type) {
+				*attachments = append(*attachments, part)
+			}
+		} else {
+			*attachments = append(*attachments, part)
+		}
+	}
+
+	if multipartType == "alternative" && textBody != nil && htmlBody != nil {
+		// 只有一种格式时，另一种使用同一内容
+		if textLength == len(*textBody) && htmlLength != len(*htmlBody) {
+			*textBody = append(*textBody, (*htmlBody)[htmlLength:]...)
+		}
+		if htmlLength == len(*htmlBody) && textLength != len(*textBody) {
+			*htmlBody = append(*htmlBody, (*textBody)[textLength:]...)
+		}
+	}
+}
+
+// getJmapBodyValue 生成 EmailBodyValue
+func getJmapBodyValue(part *JmapEmailBodyPart, maxBytes int) *JmapEmailBodyValue {
+	node := part.node
+	value := &JmapEmailBodyValue{Value: node.GetDecodedTextContent()}
+	if (node.Charset != "" && !isKnownCharset(node.Charset)) || node.hasDefect(DefectInvalidBase64) {
+		value.IsEncodingProblem = true
+	}
+	if maxBytes > 0 && len(value.Value) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(value.Value[cut]) {
+			cut--
+		}
+		value.Value = value.Value[:cut]
+		value.IsTruncated = true
+	}
+	return value
+}
+
+// getJmapPreview 取第一个正文的纯文本，合并空白后截取 256 个字符
+func getJmapPreview(textBody []*JmapEmailBodyPart) string {
+	for _, part := range textBody {
+		if !strings.HasPrefix(part.Type, "text/") {
+			continue
+		}
+		text := part.node.GetDecodedTextContent()
+		if part.Type == "text/html" {
+			text = jmapHTMLTagRegexp.ReplaceAllString(text, " ")
+			text = strings.NewReplacer("&nbsp;", " ", "&lt;", "<", "&gt;", ">", "&quot;", "\"", "&amp;", "&").Replace(text)
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if utf8.RuneCountInString(text) > jmapPreviewMaxLen {
+			text = string([]rune(text)[:jmapPreviewMaxLen])
+		}
+		return text
+	}
+	return ""
+}
+
+// GetJmapEmail 返回 JMAP Email 对象
+func (p *EmailParser) GetJmapEmail(options JmapEmailOptions) *JmapEmail {
+	top := p.topNode
+	email := &JmapEmail{
+		Keywords:    map[string]bool{},
+		Size:        top.BodyStart + top.BodyLen - top.HeaderStart,
+		MessageID:   parseJmapMessageIDs(top.GetHeaderValueIgnoreNotFound("MESSAGE-ID")),
+		InReplyTo:   parseJmapMessageIDs(top.GetHeaderValueIgnoreNotFound("IN-REPLY-TO")),
+		References:  parseJmapMessageIDs(top.GetHeaderValueIgnoreNotFound("REFERENCES")),
+		Sender:      p.getJmapAddresses("SENDER"),
+		From:        p.getJmapAddresses("FROM"),
+		To:          p.getJmapAddresses("TO"),
+		Cc:          p.getJmapAddresses("CC"),
+		Bcc:         p.getJmapAddresses("BCC"),
+		ReplyTo:     p.getJmapAddresses("REPLY-TO"),
+		BodyValues:  map[string]*JmapEmailBodyValue{},
+		TextBody:    []*JmapEmailBodyPart{},
+		HTMLBody:    []*JmapEmailBodyPart{},
+		Attachments: []*JmapEmailBodyPart{},
+	}
+	if _, err := top.GetHeaderValue("SUBJECT"); err == nil {
+		subject := p.Subject
+		email.Subject = &subject
+	}
+	if t, err := mail.ParseDate(strings.TrimSpace(string(top.GetHeaderValueIgnoreNotFound("DATE")))); err == nil {
+		sentAt := t.Format(time.RFC3339)
+		email.SentAt = &sentAt
+	}
+
+	ids := make(map[*MIMENode]string)
+	assignImapPartIDs(top, "", ids)
+	email.BodyStructure = newJmapBodyPart(top, ids)
+	parseJmapStructure([]*JmapEmailBodyPart{email.BodyStructure}, "mixed", false,
+		&email.HTMLBody, &email.TextBody, &email.Attachments)
+	for _, part := range email.Attachments {
+		if part.Disposition == nil || *part.Disposition != "inline" || part.Cid == nil {
+			email.HasAttachment = true
+			break
+		}
+	}
+	email.Preview = getJmapPreview(email.TextBody)
+
+	addBodyValue := func(part *JmapEmailBodyPart) {
+		if part.PartID != nil && strings.HasPrefix(part.Type, "text/") {
+			email.BodyValues[*part.PartID] = getJmapBodyValue(part, options.MaxBodyValueBytes)
+		}
+	}
+	if options.FetchTextBodyValues {
+		for _, part := range email.TextBody {
+			addBodyValue(part)
+		}
+	}
+	if options.FetchHTMLBodyValues {
+		for _, part := range email.HTMLBody {
+			addBodyValue(part)
+		}
+	}
+	if options.FetchAllBodyValues {
+		var walk func(part *JmapEmailBodyPart)
+		walk = func(part *JmapEmailBodyPart) {
+			addBodyValue(part)
+			for _, sub := range part.SubParts {
+				walk(sub)
+			}
+		}
+		walk(email.BodyStructure)
+	}
+	return email
+}
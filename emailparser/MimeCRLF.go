@@ -0,0 +1,20 @@
+package emailparser
+
+import "bytes"
+
+// CanonicalizeCRLF 将单独的 LF 转换为 CRLF，已经全部是 CRLF 时原样返回
+// 签名（S/MIME、PGP/MIME、DKIM）按 CRLF 计算，以 LF 存储的邮件需先转换
+func CanonicalizeCRLF(data []byte) []byte {
+	if bytes.Count(data, []byte("\r\n")) == bytes.Count(data, []byte("\n")) {
+		return data
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(data) + bytes.Count(data, []byte("\n")))
+	for i, c := range data {
+		if c == '\n' && (i == 0 || data[i-1] != '\r') {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte(c)
+	}
+	return buf.Bytes()
+}
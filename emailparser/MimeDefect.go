@@ -0,0 +1,157 @@
+package emailparser
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+
+	mailhonorcharsetutils "github.com/mailhonor/go-utils/charset"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// DefectType 解析缺陷类型
+type DefectType string
+
+const (
+	DefectMissingClosingBoundary   DefectType = "MissingClosingBoundary"   // 多部分缺少结束边界符
+	DefectStartBoundaryNotFound    DefectType = "StartBoundaryNotFound"    // 多部分中找不到任何边界符
+	DefectMultipartWithoutBoundary DefectType = "MultipartWithoutBoundary" // 多部分类型未指定 boundary 参数
+	DefectInvalidBase64            DefectType = "InvalidBase64"            // BASE64 正文无法解码
+	DefectUnterminatedQuotedString DefectType = "UnterminatedQuotedString" // 引号未闭合
+	DefectHeaderWithoutColon       DefectType = "HeaderWithoutColon"       // 头部行缺少冒号
+	DefectBareLF                   DefectType = "BareLF"                   // CRLF 邮件中出现单独的 LF
+	DefectUnknownCharset           DefectType = "UnknownCharset"           // 无法识别的字符集
+)
+
+// Defect 解析过程中发现的缺陷
+type Defect struct {
+	Type   DefectType `json:"type"`
+	Offset int        `json:"offset"` // 在 EmailData 中的偏移
+	Detail string     `json:"detail"` // 补充信息（如边界符、字符集名称、头部名称）
+}
+
+func (d Defect) String() string {
+	if d.Detail == "" {
+		return string(d.Type)
+	}
+	return string(d.Type) + "(" + d.Detail + ")"
+}
+
+// addDefect 为节点记录一个缺陷
+func (n *MIMENode) addDefect(defectType DefectType, offset int, detail string) {
+	n.Defects = append(n.Defects, Defect{
+		Type:   defectType,
+		Offset: offset,
+		Detail: detail,
+	})
+}
+
+// hasDefect 节点是否已记录指定类型的缺陷
+func (n *MIMENode) hasDefect(defectType DefectType) bool {
+	for _, d := range n.Defects {
+		if d.Type == defectType {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownCharset 字符集是否可以被识别
+func isKnownCharset(charset string) bool {
+	charset = mailhonorcharsetutils.NormalizeCharset(charset)
+	switch strings.ToUpper(charset) {
+	case "", "UTF-16BE", "UTF-16LE", "US-ASCII":
+		return true
+	}
+	_, err := htmlindex.Get(charset)
+	return err == nil
+}
+
+// hasUnterminatedQuote 检查值中是否有未闭合的引号（跳过转义字符）
+func hasUnterminatedQuote(value []byte) bool {
+	inQuote := false
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		}
+	}
+	return inQuote
+}
+
+// checkHeaderDefects 检查节点头部中的引号与字符集问题
+func (p *EmailParser) checkHeaderDefects(node *MIMENode) {
+	for _, line := range node.Header {
+		switch line.Name {
+		case "CONTENT-TYPE", "CONTENT-DISPOSITION":
+			if len(ParseMimeValueParams(line.Value).Defects) > 0 {
+				node.addDefect(DefectUnterminatedQuotedString, line.Offset, line.Name)
+			}
+		case "FROM", "TO", "CC", "BCC", "SENDER", "REPLY-TO":
+			if hasUnterminatedQuote(line.Value) {
+				node.addDefect(DefectUnterminatedQuotedString, line.Offset, line.Name)
+			}
+		case "SUBJECT":
+			for _, token := range ParseMimeValueTokenNodes(line.Value) {
+				if !isKnownCharset(token.Charset) {
+					node.addDefect(DefectUnknownCharset, line.Offset, token.Charset)
+				}
+			}
+		}
+	}
+	if node.Charset != "" && !isKnownCharset(node.Charset) {
+		line := node.HeaderStart
+		for _, l := range node.Header {
+			if l.Name == "CONTENT-TYPE" {
+				line = l.Offset
+				break
+			}
+		}
+		node.addDefect(DefectUnknownCharset, line, node.Charset)
+	}
+}
+
+// checkBase64Defect 检查 BASE64 正文，记录解码失败的位置
+func (n *MIMENode) checkBase64Defect() {
+	if n.Encoding != "BASE64" || n.base64Checked {
+		return
+	}
+	n.base64Checked = true
+	_, err := base64.StdEncoding.DecodeString(string(n.GetRawContent()))
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		n.addDefect(DefectInvalidBase64, n.BodyStart+int(corrupt), "")
+	}
+}
+
+// GetDefects 返回整封邮件（含内嵌邮件）的全部缺陷，按偏移排序，偏移均相对于本解析器的 EmailData
+// 首次调用时会检查所有 BASE64 正文；BASE64/QUOTED-PRINTABLE 编码的内嵌邮件偏移相对于解码后的数据，
+// 其缺陷不包含在内，需对 GetEmbeddedEmailParser 的结果单独调用 GetDefects
+func (p *EmailParser) GetDefects() []Defect {
+	var defects []Defect
+	var walk func(node *MIMENode)
+	walk = func(node *MIMENode) {
+		if node.Encoding == "BASE64" && len(node.Childs) == 0 {
+			node.checkBase64Defect()
+		}
+		defects = append(defects, node.Defects...)
+		for _, child := range node.Childs {
+			walk(child)
+		}
+		if embedded := node.embeddedParser; embedded != nil && !embedded.offsetsInDecodedData && embedded.topNode != nil {
+			walk(embedded.topNode)
+		}
+	}
+	if p.topNode != nil {
+		walk(p.topNode)
+	}
+	sort.SliceStable(defects, func(i, j int) bool {
+		return defects[i].Offset < defects[j].Offset
+	})
+	return defects
+}
@@ -0,0 +1,92 @@
+package emailparser
+
+import "bytes"
+
+// DefaultMaxNestingDepth 内嵌邮件默认最大嵌套层数
+const DefaultMaxNestingDepth = 8
+
+// isEmbeddedMessageType 是否为内嵌邮件类型（MESSAGE/RFC822、MESSAGE/GLOBAL）
+func (n *MIMENode) isEmbeddedMessageType() bool {
+	return n.ContentType == "MESSAGE/RFC822" || n.ContentType == "MESSAGE/GLOBAL"
+}
+
+// canEmbed 是否允许继续解析下一层内嵌邮件
+func (p *EmailParser) canEmbed() bool {
+	limit := p.maxNestingDepth
+	if limit == 0 {
+		limit = DefaultMaxNestingDepth
+	}
+	return p.nestingDepth < limit
+}
+
+// newEmbeddedEmailParser 为内嵌邮件节点创建子解析器，与外层共享 EmailData
+func (p *EmailParser) newEmbeddedEmailParser(node *MIMENode) *EmailParser {
+	embedded := &EmailParser{
+		DefaultCharset:  p.DefaultCharset,
+		EmailData:       p.EmailData,
+		parentNode:      node,
+		nestingDepth:    p.nestingDepth + 1,
+		maxNestingDepth: p.maxNestingDepth,
+	}
+	if node.ContentType == "MESSAGE/GLOBAL" {
+		// RFC 6532: MESSAGE/GLOBAL 的头部允许直接使用 UTF-8
+		embedded.DefaultCharset = "UTF-8"
+	}
+	return embedded
+}
+
+// GetEmbeddedEmailParser 返回内嵌邮件（MESSAGE/RFC822、MESSAGE/GLOBAL）的解析器，其他节点返回nil
+// 7BIT/8BIT/BINARY 编码的内嵌邮件在解析时直接展开，节点偏移相对于最外层 EmailData
+// BASE64/QUOTED-PRINTABLE 编码的内嵌邮件在首次调用时解码后解析，节点偏移相对于解码后的数据（见 OffsetsInDecodedData），
+// 修改其节点后，外层 Serialize 重新生成内嵌邮件并按原传输编码写回
+func (n *MIMENode) GetEmbeddedEmailParser() *EmailParser {
+	if n.embeddedParser != nil || n.embeddedDealed {
+		return n.embeddedParser
+	}
+	n.embeddedDealed = true
+	p := n.EmailParser
+	if !n.isEmbeddedMessageType() || !p.canEmbed() || n.BodyStart+n.BodyLen > len(p.EmailData) {
+		return nil
+	}
+	if n.Encoding != "BASE64" && n.Encoding != "QUOTED-PRINTABLE" {
+		return nil
+	}
+	embedded := p.newEmbeddedEmailParser(n)
+	embedded.EmailData = n.GetDecodedContent()
+	embedded.offsetsInDecodedData = true
+	_ = embedded.parseStream(bytes.NewReader(embedded.EmailData), nil)
+	n.embeddedParser = embedded
+	return embedded
+}
+
+// NewInnerEmailParser 将节点解密或解包得到的 MIME 实体（如 S/MIME、PGP/MIME 的内容）解析为内层邮件
+// 内层邮件的 EmailData 为 data，GetParentMIMENode 返回该节点
+func (n *MIMENode) NewInnerEmailParser(data []byte) *EmailParser {
+	inner := n.EmailParser.newEmbeddedEmailParser(n)
+	inner.EmailData = data
+	inner.offsetsInDecodedData = true
+	_ = inner.parseStream(bytes.NewReader(data), nil)
+	n.innerParser = inner
+	return inner
+}
+
+// GetInnerEmailParser 返回 NewInnerEmailParser 生成的内层邮件，没有时返回nil
+func (n *MIMENode) GetInnerEmailParser() *EmailParser {
+	return n.innerParser
+}
+
+// OffsetsInDecodedData 节点偏移是否相对于解码或解包后的数据（本解析器的 EmailData），
+// 为 false 时内嵌邮件与外层共享 EmailData，节点偏移同时也是最外层 EmailData 中的偏移
+func (p *EmailParser) OffsetsInDecodedData() bool {
+	return p.offsetsInDecodedData
+}
+
+// GetParentMIMENode 返回内嵌邮件所在的外层节点，最外层邮件返回nil
+func (p *EmailParser) GetParentMIMENode() *MIMENode {
+	return p.parentNode
+}
+
+// GetNestingDepth 返回内嵌层数，最外层邮件为0
+func (p *EmailParser) GetNestingDepth() int {
+	return p.nestingDepth
+}
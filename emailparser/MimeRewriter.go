@@ -0,0 +1,437 @@
+package emailparser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// 修改节点后调用 EmailParser.Serialize 生成新邮件：
+// 未修改的区域（头部行、分隔符、正文、前导区/结尾区）从 EmailData 原样复制，
+// 因此未改动头部上的 DKIM 签名仍然有效。
+// 注意：修改不会更新节点的解析字段（ContentType、GetTextNodes 等），需要时请重新解析生成的邮件。
+
+var (
+	ErrRewriteMultipartBody = errors.New("cannot replace body of multipart node")
+	ErrRewriteNotMultipart  = errors.New("node is not a multipart node")
+	ErrRewriteTopNode       = errors.New("cannot delete top node")
+	ErrRewriteVirtualNode   = errors.New("cannot modify virtual node")
+	ErrRewriteNoEmailData   = errors.New("original email data not available, parse the message with EmailParserNew to serialize it")
+	ErrRewriteInvalidHeader = errors.New("invalid header name or value")
+)
+
+// lineEnding 返回邮件使用的换行符
+func (p *EmailParser) lineEnding() string {
+	idx := bytes.IndexByte(p.EmailData, '\n')
+	if idx > 0 && p.EmailData[idx-1] == '\r' {
+		return "\r\n"
+	}
+	if idx == -1 {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// prepareHeaderEdit 首次修改头部时，记录每个原始头部行的结束位置
+func (n *MIMENode) prepareHeaderEdit() {
+	if n.headerModified {
+		return
+	}
+	n.headerModified = true
+	headerEnd := n.HeaderStart + n.HeaderLen
+	for i := range n.Header {
+		if i+1 < len(n.Header) {
+			n.Header[i].rawEnd = n.Header[i+1].Offset
+		} else {
+			n.Header[i].rawEnd = headerEnd
+		}
+	}
+}
+
+// checkEditedMimeLine 检查新增的头部行：名称为不含冒号的可见 ASCII 字符，
+// 值中的 CR、LF 只能以 CRLF 加空白的折行形式出现，避免写出额外的头部行
+func checkEditedMimeLine(name string, value string) error {
+	if name == "" {
+		return ErrRewriteInvalidHeader
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] >= 0x7f || name[i] == ':' {
+			return ErrRewriteInvalidHeader
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\r':
+			if i+2 >= len(value) || value[i+1] != '\n' || (value[i+2] != ' ' && value[i+2] != '\t') {
+				return ErrRewriteInvalidHeader
+			}
+			i++
+		case '\n':
+			return ErrRewriteInvalidHeader
+		}
+	}
+	return nil
+}
+
+func newEditedMimeLine(name string, value string) MimeLine {
+	return MimeLine{
+		Name:    strings.ToUpper(strings.TrimSpace(name)),
+		Value:   []byte(value),
+		Offset:  -1,
+		edited:  true,
+		rawName: name,
+	}
+}
+
+// AddHeader 在头部末尾追加一行，value 需已按 RFC 2047 编码（可使用 EncodeMimeValueString），
+// 可以包含 CRLF 加空白的折行；名称或值无效时返回 ErrRewriteInvalidHeader
+func (n *MIMENode) AddHeader(name string, value string) error {
+	if n.isVirtual {
+		return ErrRewriteVirtualNode
+	}
+	if err := checkEditedMimeLine(name, value); err != nil {
+		return err
+	}
+	n.prepareHeaderEdit()
+	n.Header = append(n.Header, newEditedMimeLine(name, value))
+	return nil
+}
+
+// PrependHeader 在头部最前面插入一行（如 Received、DKIM-Signature 等跟踪头部）
+func (n *MIMENode) PrependHeader(name string, value string) error {
+	if n.isVirtual {
+		return ErrRewriteVirtualNode
+	}
+	if err := checkEditedMimeLine(name, value); err != nil {
+		return err
+	}
+	n.prepareHeaderEdit()
+	n.Header = append([]MimeLine{newEditedMimeLine(name, value)}, n.Header...)
+	return nil
+}
+
+// RemoveHeader 删除所有指定名称的头部行，返回删除的行数
+func (n *MIMENode) RemoveHeader(name string) int {
+	if n.isVirtual {
+		return 0
+	}
+	name = strings.ToUpper(name)
+	count := 0
+	for _, line := range n.Header {
+		if line.Name == name {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	n.prepareHeaderEdit()
+	lines := n.Header[:0]
+	for _, line := range n.Header {
+		if line.Name != name {
+			lines = append(lines, line)
+		}
+	}
+	n.Header = lines
+	return count
+}
+
+// ReplaceHeader 用新值替换指定名称的头部：替换第一处并删除其余各处，不存在时追加
+func (n *MIMENode) ReplaceHeader(name string, value string) error {
+	if n.isVirtual {
+		return ErrRewriteVirtualNode
+	}
+	if err := checkEditedMimeLine(name, value); err != nil {
+		return err
+	}
+	n.prepareHeaderEdit()
+	upperName := strings.ToUpper(name)
+	replaced := false
+	lines := n.Header[:0]
+	for _, line := range n.Header {
+		if line.Name != upperName {
+			lines = append(lines, line)
+			continue
+		}
+		if !replaced {
+			replaced = true
+			lines = append(lines, newEditedMimeLine(name, value))
+		}
+	}
+	n.Header = lines
+	if !replaced {
+		n.Header = append(n.Header, newEditedMimeLine(name, value))
+	}
+	return nil
+}
+
+// ReplaceBody 替换叶子节点的原始正文（需已按节点的传输编码编码）
+func (n *MIMENode) ReplaceBody(rawBody []byte) error {
+	if n.isVirtual {
+		return ErrRewriteVirtualNode
+	}
+	if len(n.Childs) > 0 || strings.HasPrefix(n.ContentType, "MULTIPART/") {
+		return ErrRewriteMultipartBody
+	}
+	n.bodyReplaced = true
+	n.replacedBody = rawBody
+	return nil
+}
+
+// ReplaceDecodedBody 按节点的传输编码（BASE64/QUOTED-PRINTABLE）编码数据后替换正文
+func (n *MIMENode) ReplaceDecodedBody(data []byte) error {
+	return n.ReplaceBody(n.encodeBody(data))
+}
+
+// encodeBody 按节点的传输编码编码正文，换行符与原邮件一致
+func (n *MIMENode) encodeBody(data []byte) []byte {
+	eol := n.EmailParser.lineEnding()
+	var buf bytes.Buffer
+	switch n.Encoding {
+	case "BASE64":
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			buf.WriteString(encoded[:76])
+			buf.WriteString(eol)
+			encoded = encoded[76:]
+		}
+		buf.WriteString(encoded)
+	case "QUOTED-PRINTABLE":
+		qw := quotedprintable.NewWriter(&buf)
+		qw.Write(data)
+		qw.Close()
+		if eol == "\n" {
+			return bytes.ReplaceAll(buf.Bytes(), []byte("\r\n"), []byte("\n"))
+		}
+	default:
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+// prepareChildEdit 首次增删子节点时，记录原始子节点列表
+func (n *MIMENode) prepareChildEdit() {
+	if n.childsModified {
+		return
+	}
+	n.childsModified = true
+	n.originalChilds = append([]*MIMENode(nil), n.Childs...)
+}
+
+// Delete 从父节点中删除该节点（连同其前面的边界符）
+func (n *MIMENode) Delete() error {
+	if n.isVirtual {
+		return ErrRewriteVirtualNode
+	}
+	parent := n.Parent
+	if parent == nil {
+		return ErrRewriteTopNode
+	}
+	parent.prepareChildEdit()
+	for i, child := range parent.Childs {
+		if child == n {
+			parent.Childs = append(parent.Childs[:i], parent.Childs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// InsertChild 在多部分节点的第 index 个位置插入新部分（index 小于0或超出范围时追加到末尾）
+// partData 为完整的 MIME 实体（头部 + 空行 + 正文），换行符应与原邮件一致
+func (n *MIMENode) InsertChild(index int, partData []byte) (*MIMENode, error) {
+	if n.isVirtual {
+		return nil, ErrRewriteVirtualNode
+	}
+	if !strings.HasPrefix(n.ContentType, "MULTIPART/") || n.Boundary == "" {
+		return nil, ErrRewriteNotMultipart
+	}
+	partParser := EmailParserNew(EmailParserOptions{
+		DefaultCharset: n.EmailParser.DefaultCharset,
+		EmailData:      partData,
+	})
+	child := partParser.topNode
+	child.Parent = n
+
+	n.prepareChildEdit()
+	if index < 0 || index >= len(n.Childs) {
+		n.Childs = append(n.Childs, child)
+	} else {
+		n.Childs = append(n.Childs[:index], append([]*MIMENode{child}, n.Childs[index:]...)...)
+	}
+	return child, nil
+}
+
+// isModified 节点或其子孙是否被修改
+func (n *MIMENode) isModified() bool {
+	if n.headerModified || n.bodyReplaced || n.childsModified {
+		return true
+	}
+	for _, child := range n.Childs {
+		if child.isModified() {
+			return true
+		}
+	}
+	if n.embeddedParser != nil && n.embeddedParser.topNode != nil && n.embeddedParser.parentNode == n {
+		return n.embeddedParser.topNode.isModified()
+	}
+	return false
+}
+
+// embeddedIsDecoded 内嵌邮件是否从解码后的数据解析（BASE64/QUOTED-PRINTABLE 编码的内嵌邮件）
+func (n *MIMENode) embeddedIsDecoded() bool {
+	return n.embeddedParser != nil && n.embeddedParser.offsetsInDecodedData
+}
+
+// writeHeader 输出头部，未修改的行原样复制
+func (n *MIMENode) writeHeader(buf *bytes.Buffer) {
+	raw := n.EmailParser.EmailData
+	if !n.headerModified {
+		buf.Write(raw[n.HeaderStart : n.HeaderStart+n.HeaderLen])
+		return
+	}
+	eol := n.EmailParser.lineEnding()
+	for _, line := range n.Header {
+		if line.edited {
+			folded := FoldMimeHeaderLine(line.rawName, string(line.Value))
+			if eol != "\r\n" {
+				folded = strings.ReplaceAll(folded, "\r\n", eol)
+			}
+			buf.WriteString(folded)
+			buf.WriteString(eol)
+			continue
+		}
+		data := raw[line.Offset:line.rawEnd]
+		buf.Write(data)
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			buf.WriteString(eol)
+		}
+	}
+}
+
+// splitMimeDelimiter 将子节点前的原始数据拆分为前导内容和边界符行（含其前面的换行）
+func splitMimeDelimiter(gap []byte, boundary string) ([]byte, []byte) {
+	idx := bytes.LastIndex(gap, []byte("--"+boundary))
+	for idx > 0 && gap[idx-1] != '\n' {
+		idx = bytes.LastIndex(gap[:idx], []byte("--"+boundary))
+	}
+	if idx < 0 {
+		return nil, gap
+	}
+	start := idx
+	if start > 0 && gap[start-1] == '\n' {
+		start--
+		if start > 0 && gap[start-1] == '\r' {
+			start--
+		}
+	}
+	return gap[:start], gap[start:]
+}
+
+// writeTo 输出节点（头部 + 分隔空行 + 正文）
+func (n *MIMENode) writeTo(buf *bytes.Buffer) {
+	raw := n.EmailParser.EmailData
+	if !n.isModified() {
+		buf.Write(raw[n.HeaderStart : n.BodyStart+n.BodyLen])
+		return
+	}
+	n.writeHeader(buf)
+	buf.Write(raw[n.HeaderStart+n.HeaderLen : n.BodyStart])
+
+	if n.bodyReplaced {
+		buf.Write(n.replacedBody)
+		return
+	}
+	if n.embeddedParser != nil && n.embeddedParser.parentNode == n && n.embeddedParser.topNode != nil {
+		if !n.embeddedIsDecoded() {
+			n.embeddedParser.topNode.writeTo(buf)
+			return
+		}
+		if n.embeddedParser.topNode.isModified() {
+			// BASE64/QUOTED-PRINTABLE 编码的内嵌邮件：重新生成解码后的内嵌邮件，再按原传输编码写回
+			var inner bytes.Buffer
+			n.embeddedParser.topNode.writeTo(&inner)
+			buf.Write(n.encodeBody(inner.Bytes()))
+			return
+		}
+	}
+	if !n.childsModified {
+		if len(n.Childs) == 0 {
+			buf.Write(raw[n.BodyStart : n.BodyStart+n.BodyLen])
+			return
+		}
+		prevEnd := n.BodyStart
+		for _, child := range n.Childs {
+			buf.Write(raw[prevEnd:child.HeaderStart])
+			child.writeTo(buf)
+			prevEnd = child.BodyStart + child.BodyLen
+		}
+		buf.Write(raw[prevEnd : n.BodyStart+n.BodyLen])
+		return
+	}
+
+	// 子节点有增删：按原始子节点切分边界符，重新组装
+	eol := n.EmailParser.lineEnding()
+	type delimiter struct {
+		pre   []byte
+		delim []byte
+	}
+	delimiters := make(map[*MIMENode]delimiter)
+	prevEnd := n.BodyStart
+	var preamble []byte
+	for i, child := range n.originalChilds {
+		pre, delim := splitMimeDelimiter(raw[prevEnd:child.HeaderStart], n.Boundary)
+		if i == 0 {
+			preamble = pre
+			pre = nil
+		}
+		delimiters[child] = delimiter{pre: pre, delim: delim}
+		prevEnd = child.BodyStart + child.BodyLen
+	}
+	tail := raw[prevEnd : n.BodyStart+n.BodyLen]
+	if len(n.originalChilds) == 0 {
+		preamble = tail
+		tail = []byte(eol + "--" + n.Boundary + "--" + eol)
+	}
+
+	buf.Write(preamble)
+	for _, child := range n.Childs {
+		if d, ok := delimiters[child]; ok {
+			buf.Write(d.pre)
+			buf.Write(d.delim)
+		} else {
+			buf.WriteString(eol + "--" + n.Boundary + eol)
+		}
+		child.writeTo(buf)
+	}
+	buf.Write(tail)
+}
+
+// Serialize 生成修改后的邮件数据，未修改的区域与 EmailData 字节一致
+// 需要完整的原始数据：流式解析（EmailParserNewFromReader）的邮件没有保存 EmailData，返回 ErrRewriteNoEmailData
+func (p *EmailParser) Serialize() ([]byte, error) {
+	top := p.topNode
+	if top == nil {
+		return nil, nil
+	}
+	if top.HeaderStart < 0 || top.BodyStart+top.BodyLen > len(p.EmailData) {
+		return nil, ErrRewriteNoEmailData
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(p.EmailData))
+	top.writeTo(&buf)
+	return buf.Bytes(), nil
+}
+
+// WriteTo 将修改后的邮件写入 w
+func (p *EmailParser) WriteTo(w io.Writer) (int64, error) {
+	data, err := p.Serialize()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
@@ -0,0 +1,330 @@
+package emailparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// EmailParserStreamOptions 流式解析选项
+type EmailParserStreamOptions struct {
+	DefaultCharset  string    // 默认字符集（如UTF-8、GBK）
+	Reader          io.Reader // 原始邮件数据流
+	MaxNestingDepth int       // 内嵌邮件最大嵌套层数，0 表示使用默认值，小于0 表示不解析内嵌邮件
+	// LeafBodyHandler 每个叶子节点的正文到达时回调（可为nil）
+	// body 为原始（未解码）正文，仅在回调期间有效；未读完的部分由解析器丢弃
+	// 回调时节点的头部已解析完毕，但 BodyLen 尚未确定
+	// 返回错误将终止解析
+	LeafBodyHandler func(node *MIMENode, body io.Reader) error
+}
+
+// mimeStreamBufferSize 行缓冲区大小，超长行会被分段读取
+const mimeStreamBufferSize = 64 * 1024
+
+// mimeStreamTerminator 记录一个部分的结束原因
+type mimeStreamTerminator struct {
+	depth   int  // 命中的边界符在栈中的层级，-1 表示到达数据末尾
+	closing bool // 是否为结束边界符（--boundary--）
+	end     int  // 部分结束偏移（不含边界符前的换行）
+}
+
+// mimeStreamParser 逐行读取邮件数据，边读边构建MIME树
+type mimeStreamParser struct {
+	br          *bufio.Reader
+	handler     func(node *MIMENode, body io.Reader) error
+	offset      int      // 已消费的字节数
+	atLineStart bool     // 下一次读取是否位于行首
+	eolLen      int      // 上一次读取结尾的换行长度（0、1 或 2）
+	boundaries  []string // 当前有效的边界符栈
+	current     *MIMENode
+	crlfKnown   bool // 是否已根据第一行确定换行风格
+	crlf        bool // 邮件是否使用 CRLF 换行
+}
+
+// readChunk 读取一行（超长行可能被截断为多段），返回的数据在下一次读取前有效
+func (s *mimeStreamParser) readChunk() ([]byte, error) {
+	chunk, err := s.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		err = nil
+	}
+	if err == io.EOF && len(chunk) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.offset += len(chunk)
+	s.eolLen = 0
+	s.atLineStart = false
+	if chunk[len(chunk)-1] == '\n' {
+		s.atLineStart = true
+		s.eolLen = 1
+		if len(chunk) > 1 && chunk[len(chunk)-2] == '\r' {
+			s.eolLen = 2
+		}
+		if !s.crlfKnown {
+			s.crlfKnown = true
+			s.crlf = s.eolLen == 2
+		} else if s.crlf && s.eolLen == 1 && s.current != nil && !s.current.hasDefect(DefectBareLF) {
+			s.current.addDefect(DefectBareLF, s.offset-1, "")
+		}
+	}
+	return chunk, nil
+}
+
+// matchBoundary 判断一行是否为边界栈中的某个边界符（从内向外匹配）
+func (s *mimeStreamParser) matchBoundary(line []byte) (depth int, closing bool, ok bool) {
+	if len(s.boundaries) == 0 || !bytes.HasPrefix(line, []byte("--")) {
+		return 0, false, false
+	}
+	rest := bytes.TrimSpace(line[2:])
+	for i := len(s.boundaries) - 1; i >= 0; i-- {
+		b := s.boundaries[i]
+		if string(rest) == b {
+			return i, false, true
+		}
+		if len(rest) == len(b)+2 && bytes.HasSuffix(rest, []byte("--")) && string(rest[:len(b)]) == b {
+			return i, true, true
+		}
+	}
+	return 0, false, false
+}
+
+// nextLine 读取下一段数据；遇到边界符或数据末尾时返回终止信息
+func (s *mimeStreamParser) nextLine() ([]byte, *mimeStreamTerminator, error) {
+	lineStart := s.atLineStart
+	start := s.offset
+	prevEOLLen := s.eolLen
+	chunk, err := s.readChunk()
+	if err == io.EOF {
+		return nil, &mimeStreamTerminator{depth: -1, end: s.offset}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if lineStart {
+		if depth, closing, ok := s.matchBoundary(chunk); ok {
+			return nil, &mimeStreamTerminator{depth: depth, closing: closing, end: start - prevEOLLen}, nil
+		}
+	}
+	return chunk, nil, nil
+}
+
+// skipLines 跳过数据（前导区、结尾区等），直到遇到边界符或数据末尾
+func (s *mimeStreamParser) skipLines() (*mimeStreamTerminator, error) {
+	for {
+		_, term, err := s.nextLine()
+		if err != nil || term != nil {
+			return term, err
+		}
+	}
+}
+
+// mimeStreamBodyReader 叶子节点正文读取器，边界符前的换行不属于正文
+type mimeStreamBodyReader struct {
+	s          *mimeStreamParser
+	pending    []byte
+	pendingEOL []byte
+	term       *mimeStreamTerminator
+	err        error
+}
+
+func (r *mimeStreamBodyReader) fill() {
+	chunk, term, err := r.s.nextLine()
+	if err != nil {
+		r.err = err
+		return
+	}
+	if term != nil {
+		r.term = term
+		if term.depth == -1 {
+			// 数据末尾，换行属于正文
+			r.pending = append(r.pending[:0], r.pendingEOL...)
+		}
+		r.pendingEOL = r.pendingEOL[:0]
+		return
+	}
+	eolLen := r.s.eolLen
+	r.pending = append(r.pending[:0], r.pendingEOL...)
+	r.pending = append(r.pending, chunk[:len(chunk)-eolLen]...)
+	r.pendingEOL = append(r.pendingEOL[:0], chunk[len(chunk)-eolLen:]...)
+}
+
+func (r *mimeStreamBodyReader) Read(buf []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.term != nil {
+			return 0, io.EOF
+		}
+		r.fill()
+	}
+	n := copy(buf, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// parsePart 解析一个MIME部分（头部 + 正文/子节点），返回节点及其结束原因
+func (s *mimeStreamParser) parsePart(p *EmailParser, parent *MIMENode) (*MIMENode, *mimeStreamTerminator, error) {
+	node := &MIMENode{
+		EmailParser: p,
+		Parent:      parent,
+		HeaderStart: s.offset,
+	}
+	s.current = node
+
+	// 读取头部，直到空行
+	var headerData []byte
+	var term *mimeStreamTerminator
+	for {
+		lineStart := s.atLineStart
+		chunk, t, err := s.nextLine()
+		if err != nil {
+			return node, nil, err
+		}
+		if t != nil {
+			term = t
+			break
+		}
+		headerData = append(headerData, chunk...)
+		if lineStart && (string(chunk) == "\n" || string(chunk) == "\r\n") {
+			break
+		}
+	}
+	p.parseMimeHeader(node, headerData)
+	node.BodyStart = node.HeaderStart + len(headerData)
+	if parent == nil {
+		p.topNode = node
+		p.parseTopHeaders()
+	}
+	if term != nil {
+		node.BodyLen = max(term.end-node.BodyStart, 0)
+		return node, term, nil
+	}
+
+	if strings.HasPrefix(node.ContentType, "MULTIPART/") && node.Boundary != "" {
+		// 多部分节点：压入边界符，依次解析子节点
+		depth := len(s.boundaries)
+		s.boundaries = append(s.boundaries, node.Boundary)
+		term, err := s.skipLines()
+		for err == nil && term.depth == depth && !term.closing {
+			var child *MIMENode
+			child, term, err = s.parsePart(p, node)
+			node.Childs = append(node.Childs, child)
+			s.current = node
+		}
+		s.boundaries = s.boundaries[:depth]
+		if err != nil {
+			return node, nil, err
+		}
+		if term.depth == depth && term.closing {
+			// 结尾区（epilogue）
+			term, err = s.skipLines()
+			if err != nil {
+				return node, nil, err
+			}
+		} else if len(node.Childs) == 0 {
+			node.addDefect(DefectStartBoundaryNotFound, node.BodyStart, node.Boundary)
+		} else {
+			node.addDefect(DefectMissingClosingBoundary, term.end, node.Boundary)
+		}
+		node.BodyLen = max(term.end-node.BodyStart, 0)
+		return node, term, nil
+	}
+
+	if strings.HasPrefix(node.ContentType, "MULTIPART/") {
+		node.addDefect(DefectMultipartWithoutBoundary, node.HeaderStart, "")
+	}
+
+	if node.isEmbeddedMessageType() && node.Encoding != "BASE64" && node.Encoding != "QUOTED-PRINTABLE" && p.canEmbed() {
+		// 内嵌邮件：在同一数据流上继续解析，偏移相对于最外层邮件
+		embedded := p.newEmbeddedEmailParser(node)
+		_, term, err := s.parsePart(embedded, nil)
+		s.current = node
+		if err != nil {
+			return node, nil, err
+		}
+		node.embeddedParser = embedded
+		node.BodyLen = max(term.end-node.BodyStart, 0)
+		return node, term, nil
+	}
+
+	// 叶子节点
+	body := &mimeStreamBodyReader{s: s}
+	if s.handler != nil {
+		if err := s.handler(node, body); err != nil {
+			return node, nil, err
+		}
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return node, nil, err
+	}
+	node.BodyLen = max(body.term.end-node.BodyStart, 0)
+	return node, body.term, nil
+}
+
+// parseStream 从数据流解析整个MIME树
+func (p *EmailParser) parseStream(reader io.Reader, handler func(node *MIMENode, body io.Reader) error) error {
+	s := &mimeStreamParser{
+		br:          bufio.NewReaderSize(reader, mimeStreamBufferSize),
+		handler:     handler,
+		atLineStart: true,
+	}
+	_, _, err := s.parsePart(p, nil)
+	return err
+}
+
+// EmailParserNewFromReader 流式解析邮件，不缓存整封邮件
+// 解析结果中 EmailData 为空，节点正文需在 LeafBodyHandler 中获取
+func EmailParserNewFromReader(options EmailParserStreamOptions) (*EmailParser, error) {
+	parser := &EmailParser{
+		DefaultCharset:  options.DefaultCharset,
+		maxNestingDepth: options.MaxNestingDepth,
+	}
+	if parser.DefaultCharset == "" {
+		parser.DefaultCharset = "UTF-8"
+	}
+	if err := parser.parseStream(options.Reader, options.LeafBodyHandler); err != nil {
+		return parser, err
+	}
+	return parser, nil
+}
+
+// NewDecodedReader 按节点的传输编码（BASE64/QUOTED-PRINTABLE）包装原始正文流
+func (n *MIMENode) NewDecodedReader(body io.Reader) io.Reader {
+	switch n.Encoding {
+	case "BASE64":
+		return base64.NewDecoder(base64.StdEncoding, &base64WhitespaceFilter{r: body})
+	case "QUOTED-PRINTABLE":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// base64WhitespaceFilter 去除BASE64数据中的空白字符
+type base64WhitespaceFilter struct {
+	r io.Reader
+}
+
+func (f *base64WhitespaceFilter) Read(buf []byte) (int, error) {
+	for {
+		n, err := f.r.Read(buf)
+		j := 0
+		for i := 0; i < n; i++ {
+			switch buf[i] {
+			case ' ', '\t', '\r', '\n':
+				continue
+			}
+			buf[j] = buf[i]
+			j++
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
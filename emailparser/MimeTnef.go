@@ -0,0 +1,79 @@
+package emailparser
+
+import (
+	"strings"
+
+	"github.com/mailhonor/go-email/tnef"
+)
+
+// isTnefNode 是否为 TNEF（winmail.dat）节点
+func (n *MIMENode) isTnefNode() bool {
+	if strings.Contains(n.ContentType, "TNEF") {
+		return true
+	}
+	return strings.EqualFold(n.Filename, "winmail.dat") || strings.EqualFold(n.Name, "winmail.dat")
+}
+
+// newVirtualNode 创建虚拟节点，数据不在 EmailData 中，偏移沿用所属的容器节点
+func (p *EmailParser) newVirtualNode(container *MIMENode, contentType string, data []byte) *MIMENode {
+	return &MIMENode{
+		HeaderStart: container.HeaderStart,
+		BodyStart:   container.BodyStart,
+		ContentType: contentType,
+		EmailParser: p,
+		Parent:      container,
+		isVirtual:   true,
+		virtualData: data,
+	}
+}
+
+// expandTnefNode 解码 TNEF 节点，生成虚拟的正文节点和附件节点
+func (p *EmailParser) expandTnefNode(node *MIMENode) (texts []*MIMENode, attachments []*MIMENode, ok bool) {
+	msg, err := tnef.Decode(node.GetDecodedContent())
+	if err != nil {
+		return nil, nil, false
+	}
+	node.tnefMessage = msg
+
+	if len(msg.BodyHTML) > 0 {
+		n := p.newVirtualNode(node, "TEXT/HTML", msg.BodyHTML)
+		n.Charset = strings.ToUpper(msg.Charset)
+		texts = append(texts, n)
+	} else {
+		if msg.Body != "" {
+			n := p.newVirtualNode(node, "TEXT/PLAIN", []byte(msg.Body))
+			n.Charset = "UTF-8"
+			texts = append(texts, n)
+		}
+		if len(msg.BodyRTF) > 0 {
+			n := p.newVirtualNode(node, "APPLICATION/RTF", msg.BodyRTF)
+			n.Filename = "body.rtf"
+			n.Name = n.Filename
+			n.Disposition = "ATTACHMENT"
+			attachments = append(attachments, n)
+		}
+	}
+	for _, a := range msg.Attachments {
+		n := p.newVirtualNode(node, strings.ToUpper(a.MimeType), a.Data)
+		n.Filename = a.Filename
+		n.Name = a.Filename
+		n.ContentID = a.ContentID
+		n.Disposition = "ATTACHMENT"
+		if n.ContentID != "" {
+			n.Disposition = "INLINE"
+		}
+		attachments = append(attachments, n)
+	}
+	return texts, attachments, true
+}
+
+// GetTnefMessage 返回 TNEF 节点的解码结果（含 MAPI 属性），非 TNEF 或解码失败时返回nil
+func (n *MIMENode) GetTnefMessage() *tnef.Message {
+	n.EmailParser.classifyNodes()
+	return n.tnefMessage
+}
+
+// IsVirtual 是否为虚拟节点（由 TNEF 等容器解码生成，数据不在 EmailData 中）
+func (n *MIMENode) IsVirtual() bool {
+	return n.isVirtual
+}
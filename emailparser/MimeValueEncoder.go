@@ -0,0 +1,318 @@
+package emailparser
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	mailhonorcharsetutils "github.com/mailhonor/go-utils/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// mimeEncodedWordMaxLen RFC 2047 规定 encoded-word 最长 75 个字符
+const mimeEncodedWordMaxLen = 75
+
+// mimeHeaderLineMaxLen 折行时每行的建议长度
+const mimeHeaderLineMaxLen = 78
+
+// mimeParam2231SegmentMaxLen RFC 2231 每个续行参数值的最大长度
+const mimeParam2231SegmentMaxLen = 60
+
+// getCharsetEncoder 返回目标字符集的编码器，UTF-8 返回nil
+func getCharsetEncoder(charset string) (*encoding.Encoder, error) {
+	normalized := strings.ToUpper(mailhonorcharsetutils.NormalizeCharset(charset))
+	if normalized == "" || normalized == "UTF-8" || normalized == "UTF8" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset(%s)", charset)
+	}
+	return enc.NewEncoder(), nil
+}
+
+// convertFromUTF8 将 UTF-8 文本转换为目标字符集，无法表示的字符返回错误
+func convertFromUTF8(value string, encoder *encoding.Encoder) ([]byte, error) {
+	if encoder == nil {
+		return []byte(value), nil
+	}
+	encoder.Reset()
+	data, err := encoder.Bytes([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("convert %q failed: %v", value, err)
+	}
+	return data, nil
+}
+
+func isMimeASCIIText(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x80 || (c < 0x20 && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// isMimeQSafe Q 编码中可直接输出的字符（RFC 2047 5(3)，适用于 phrase）
+func isMimeQSafe(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '!' || c == '*' || c == '+' || c == '-' || c == '/'
+}
+
+func encodeMimeQ(data []byte) string {
+	var sb strings.Builder
+	for _, c := range data {
+		if c == ' ' {
+			sb.WriteByte('_')
+		} else if isMimeQSafe(c) {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "=%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func encodeMimeQLen(data []byte) int {
+	n := 0
+	for _, c := range data {
+		if c == ' ' || isMimeQSafe(c) {
+			n++
+		} else {
+			n += 3
+		}
+	}
+	return n
+}
+
+// chooseMimeEncoding 可直接输出的字符较多时用 Q，否则用 B
+func chooseMimeEncoding(data []byte) string {
+	if encodeMimeQLen(data) <= base64.StdEncoding.EncodedLen(len(data)) {
+		return "Q"
+	}
+	return "B"
+}
+
+// EncodeMimeValueWords 将 UTF-8 文本编码为若干个 RFC 2047 encoded-word
+// 每个 encoded-word 不超过 75 个字符，且不会拆开多字节字符（ISO-2022-JP 等有状态字符集的每个 word 也可独立解码）
+// charset 为目标字符集（UTF-8、GBK、GB18030、ISO-2022-JP、BIG5 等），encoding 为 "B"、"Q"，为空时自动选择
+func EncodeMimeValueWords(value string, charset string, encoding string) ([]string, error) {
+	if charset == "" {
+		charset = "UTF-8"
+	}
+	charset = strings.ToUpper(charset)
+	encoding = strings.ToUpper(encoding)
+	encoder, err := getCharsetEncoder(charset)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == "" {
+		data, err := convertFromUTF8(value, encoder)
+		if err != nil {
+			return nil, err
+		}
+		encoding = chooseMimeEncoding(data)
+	}
+	if encoding != "B" && encoding != "Q" {
+		return nil, fmt.Errorf("unknown encoding(%s)", encoding)
+	}
+
+	prefix := "=?" + charset + "?" + encoding + "?"
+	maxDataLen := mimeEncodedWordMaxLen - len(prefix) - 2
+	encodedLen := func(data []byte) int {
+		if encoding == "B" {
+			return base64.StdEncoding.EncodedLen(len(data))
+		}
+		return encodeMimeQLen(data)
+	}
+	encode := func(data []byte) string {
+		if encoding == "B" {
+			return prefix + base64.StdEncoding.EncodeToString(data) + "?="
+		}
+		return prefix + encodeMimeQ(data) + "?="
+	}
+
+	var words []string
+	var chunk []byte
+	rest := value
+	start := 0
+	for len(rest) > 0 {
+		_, size := utf8.DecodeRuneInString(rest)
+		candidate, err := convertFromUTF8(value[start:len(value)-len(rest)+size], encoder)
+		if err != nil {
+			return nil, err
+		}
+		if encodedLen(candidate) > maxDataLen && len(chunk) > 0 {
+			words = append(words, encode(chunk))
+			start = len(value) - len(rest)
+			chunk = nil
+			continue
+		}
+		chunk = candidate
+		rest = rest[size:]
+	}
+	if len(chunk) > 0 {
+		words = append(words, encode(chunk))
+	}
+	return words, nil
+}
+
+// EncodeMimeValueString 按 RFC 2047 编码头部文本，与 ParseMimeValueString 互逆
+// 纯 ASCII 的单词原样保留，含非 ASCII 字符的连续单词编码为 encoded-word，多个 word 之间以空格分隔
+func EncodeMimeValueString(value string, charset string, encoding string) (string, error) {
+	if isMimeASCIIText(value) && !strings.Contains(value, "=?") {
+		return value, nil
+	}
+	// 按空白切分，连续的非 ASCII 单词（含其间空白）合并编码
+	type token struct {
+		text  string
+		ascii bool
+	}
+	var tokens []token
+	for _, field := range strings.SplitAfter(value, " ") {
+		word := strings.TrimRight(field, " ")
+		ascii := isMimeASCIIText(word) && !strings.Contains(word, "=?")
+		if n := len(tokens); n > 0 && !ascii && !tokens[n-1].ascii {
+			tokens[n-1].text += field
+			continue
+		}
+		tokens = append(tokens, token{text: field, ascii: ascii})
+	}
+
+	var sb strings.Builder
+	for i, t := range tokens {
+		if t.ascii {
+			sb.WriteString(t.text)
+			continue
+		}
+		// 末尾空格留在 encoded-word 之外（最后一个单词除外，须保留原样）
+		text := t.text
+		trailing := ""
+		if i < len(tokens)-1 {
+			trimmed := strings.TrimRight(text, " ")
+			trailing = text[len(trimmed):]
+			text = trimmed
+		}
+		words, err := EncodeMimeValueWords(text, charset, encoding)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(strings.Join(words, " "))
+		sb.WriteString(trailing)
+	}
+	return sb.String(), nil
+}
+
+// FoldMimeHeaderLine 生成折行后的头部行（不含结尾换行），在空白处插入 CRLF 折行；
+// 值中已有的折行（CRLF 加空白，如预先折行的 DKIM-Signature）被保留，超长的物理行才会再折行
+func FoldMimeHeaderLine(name string, value string) string {
+	line := name + ": " + value
+	if len(line) <= mimeHeaderLineMaxLen {
+		return line
+	}
+	var sb strings.Builder
+	written := 0   // 已输出到的位置
+	lineStart := 0 // 当前物理行的起始位置
+	lastFold := -1
+	offset := len(name) + 2
+	for i := offset; i < len(line); i++ {
+		if line[i] == '\n' {
+			// 值中已有的折行保持不变
+			lineStart = i + 1
+			lastFold = -1
+			continue
+		}
+		if line[i] != ' ' && line[i] != '\t' {
+			continue
+		}
+		if i-lineStart > mimeHeaderLineMaxLen && lastFold > lineStart {
+			sb.WriteString(line[written:lastFold])
+			sb.WriteString("\r\n")
+			written = lastFold
+			lineStart = lastFold
+		}
+		lastFold = i
+	}
+	if len(line)-lineStart > mimeHeaderLineMaxLen && lastFold > lineStart {
+		sb.WriteString(line[written:lastFold])
+		sb.WriteString("\r\n")
+		written = lastFold
+	}
+	sb.WriteString(line[written:])
+	return sb.String()
+}
+
+// isMime2231AttrChar RFC 2231 中可直接输出的字符
+func isMime2231AttrChar(c byte) bool {
+	if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+func escapeMimeQuoted(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(s)
+}
+
+// EncodeMimeParam2231 按 RFC 2231 编码参数（如附件文件名），与 ParseParamStringValue 互逆
+// 纯 ASCII 的短值输出 name="value"；非 ASCII 值输出 name*=charset”%XX...；
+// 超长时拆成 name*0*=...; name*1*=... 续行参数，各段以 "; " 分隔
+func EncodeMimeParam2231(name string, value string, charset string) (string, error) {
+	if isMimeASCIIText(value) {
+		if len(value) <= mimeParam2231SegmentMaxLen {
+			return name + "=\"" + escapeMimeQuoted(value) + "\"", nil
+		}
+		var segments []string
+		for i := 0; len(value) > 0; i++ {
+			n := min(len(value), mimeParam2231SegmentMaxLen)
+			segments = append(segments, fmt.Sprintf("%s*%d=\"%s\"", name, i, escapeMimeQuoted(value[:n])))
+			value = value[n:]
+		}
+		return strings.Join(segments, "; "), nil
+	}
+
+	if charset == "" {
+		charset = "UTF-8"
+	}
+	charset = strings.ToUpper(charset)
+	encoder, err := getCharsetEncoder(charset)
+	if err != nil {
+		return "", err
+	}
+	data, err := convertFromUTF8(value, encoder)
+	if err != nil {
+		return "", err
+	}
+	var pieces []string
+	for _, c := range data {
+		if isMime2231AttrChar(c) {
+			pieces = append(pieces, string(c))
+		} else {
+			pieces = append(pieces, fmt.Sprintf("%%%02X", c))
+		}
+	}
+	head := charset + "''"
+	if len(head)+len(strings.Join(pieces, "")) <= mimeParam2231SegmentMaxLen {
+		return name + "*=" + head + strings.Join(pieces, ""), nil
+	}
+	// 续行参数在解码前先拼接字节，因此可以在任意字节处拆分（%XX 不拆开）
+	var segments []string
+	current := head
+	for _, piece := range pieces {
+		if len(current)+len(piece) > mimeParam2231SegmentMaxLen && current != "" {
+			segments = append(segments, current)
+			current = ""
+		}
+		current += piece
+	}
+	if current != "" {
+		segments = append(segments, current)
+	}
+	for i := range segments {
+		segments[i] = fmt.Sprintf("%s*%d*=%s", name, i, segments[i])
+	}
+	return strings.Join(segments, "; "), nil
+}
@@ -26,6 +26,9 @@ func ParseMimeValueParams(data []byte) MimeValueParams {
 
 	// 1. 解析主值（最大努力：即使有异常也保留可解析部分）
 	valueEnd := ParseMimeValueParams_parseValue(content, result)
+	for i := range result.Defects {
+		result.Defects[i].Offset += len(data) - len(content)
+	}
 
 	// 2. 解析参数（最大努力：跳过异常参数，保留合法部分）
 	if valueEnd < len(content) {
@@ -33,7 +36,12 @@ func ParseMimeValueParams(data []byte) MimeValueParams {
 		paramsContent := bytes.TrimLeftFunc(content[valueEnd:], func(r rune) bool {
 			return r == ';' || unicode.IsSpace(r)
 		})
+		paramsOffset := len(data) - len(paramsContent)
+		defectsCount := len(result.Defects)
 		ParseMimeValueParams_parseParams(paramsContent, result)
+		for i := defectsCount; i < len(result.Defects); i++ {
+			result.Defects[i].Offset += paramsOffset
+		}
 	}
 
 	return *result
@@ -62,6 +70,7 @@ func ParseMimeValueParams_parseValue(content []byte, result *MimeValueParams) in
 			// 异常：未闭合引号，取引号后所有内容（去除末尾可能的残缺引号）
 			valueRaw := bytes.TrimSuffix(content[1:], []byte{'"'})
 			result.Value = ParseMimeValueParams_unescapeQuotedBytes(valueRaw)
+			result.Defects = append(result.Defects, Defect{Type: DefectUnterminatedQuotedString})
 			return len(content) // 已处理完所有内容
 		}
 	}
@@ -119,6 +128,13 @@ func ParseMimeValueParams_parseParams(content []byte, result *MimeValueParams) {
 		if len(current) > 0 && current[0] == '"' {
 			// 带引号值（处理未闭合、转义异常）
 			value, valueLen = ParseMimeValueParams_parseQuotedParamValue(current)
+			if parseMimeValueParams_quotedUnterminated(current, valueLen) {
+				result.Defects = append(result.Defects, Defect{
+					Type:   DefectUnterminatedQuotedString,
+					Offset: len(content) - len(current),
+					Detail: string(bytes.ToUpper(name)),
+				})
+			}
 		} else {
 			// 不带引号值（到分号/空白结束）
 			value, valueLen = ParseMimeValueParams_parseUnquotedParamValue(current)
@@ -164,6 +180,15 @@ func ParseMimeValueParams_parseQuotedParamValue(content []byte) ([]byte, int) {
 	}
 }
 
+// parseMimeValueParams_quotedUnterminated 判断带引号参数值是否未闭合（consumed 为已处理长度）
+func parseMimeValueParams_quotedUnterminated(content []byte, consumed int) bool {
+	if consumed < len(content) {
+		return false
+	}
+	n := len(content)
+	return !(n >= 2 && content[n-1] == '"' && content[n-2] != '\\')
+}
+
 // parseUnquotedParamValue 解析不带引号参数值（无异常，返回值+已处理长度）
 func ParseMimeValueParams_parseUnquotedParamValue(content []byte) ([]byte, int) {
 	for i := 0; i < len(content); i++ {
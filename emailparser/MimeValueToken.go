@@ -31,6 +31,11 @@ func ParseMimeValueTokenNodes(line []byte) []MimeValueTokenNode {
 			return
 		}
 
+		// RFC 2047 6.2: 相邻 encoded-word 之间的空白（包括折行展开后的续行空白）不属于内容，忽略
+		if n := len(rs); n >= 2 && rs[n-1].Charset == "" && rs[n-2].Charset != "" && len(bytes.TrimSpace(rs[n-1].Data)) == 0 {
+			rs = rs[:n-1]
+		}
+
 		last := &rs[len(rs)-1]
 		if last.Charset == item.Charset && last.Encoding == item.Encoding {
 			// 合并数据（避免重复创建节点）
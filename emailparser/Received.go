@@ -0,0 +1,173 @@
+package emailparser
+
+import (
+	"net"
+	"net/mail"
+	"strings"
+)
+
+// ReceivedHop 一个 Received 头部（RFC 5321 4.4）
+type ReceivedHop struct {
+	FromHost string `json:"fromHost"` // from 后的主机名（HELO/EHLO）
+	FromRDNS string `json:"fromRdns"` // from 注释中的反向解析主机名
+	FromIP   string `json:"fromIp"`   // from 注释中的 IP 地址
+	ByHost   string `json:"byHost"`
+	Via      string `json:"via"`
+	With     string `json:"with"` // 协议，如 ESMTP、ESMTPS、LMTP
+	ID       string `json:"id"`
+	For      string `json:"for"`      // 收件地址（去除尖括号）
+	Date     string `json:"date"`     // 分号后的时间
+	DateUnix int64  `json:"dateUnix"` // 时间无法解析时为0
+	Delay    int64  `json:"delay"`    // 与上一跳之间的间隔（秒），第一跳或任一时间未知时为0
+	Raw      string `json:"raw"`
+}
+
+// receivedToken Received 头部中的一个单词或注释
+type receivedToken struct {
+	text    string
+	comment bool
+}
+
+// splitReceived 将 Received 头部切分为单词和注释，并取出（注释之外的）分号后的时间
+func splitReceived(s string) ([]receivedToken, string) {
+	var tokens []receivedToken
+	depth := 0
+	start := -1
+	flush := func(end int) {
+		if start >= 0 && end > start {
+			tokens = append(tokens, receivedToken{text: s[start:end]})
+		}
+		start = -1
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if depth > 0 {
+			switch c {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					tokens = append(tokens, receivedToken{text: s[start+1 : i], comment: true})
+					start = -1
+				}
+			}
+			continue
+		}
+		switch c {
+		case '(':
+			flush(i)
+			depth = 1
+			start = i
+		case ';':
+			flush(i)
+			return tokens, strings.TrimSpace(s[i+1:])
+		case ' ', '\t', '\r', '\n':
+			flush(i)
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if depth == 0 {
+		flush(len(s))
+	}
+	return tokens, ""
+}
+
+// parseReceivedFromComment 从 from 子句的注释中取出反向解析主机名和 IP，如 "mail.example.com [192.0.2.1]"、"[192.0.2.1] helo=x"、"192.0.2.1"
+func parseReceivedFromComment(hop *ReceivedHop, comment string) {
+	for i, field := range strings.FieldsFunc(comment, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' }) {
+		candidate := strings.Trim(field, "[]")
+		if len(candidate) > 5 && strings.EqualFold(candidate[:5], "IPv6:") {
+			candidate = candidate[5:]
+		}
+		if net.ParseIP(candidate) != nil {
+			if hop.FromIP == "" {
+				hop.FromIP = candidate
+			}
+			continue
+		}
+		if i == 0 && hop.FromRDNS == "" && !strings.Contains(field, "=") && strings.Contains(field, ".") {
+			hop.FromRDNS = field
+		}
+	}
+}
+
+// ParseReceived 解析一个 Received 头部的值，尽量容忍各种 MTA 的格式
+func ParseReceived(line []byte) *ReceivedHop {
+	hop := &ReceivedHop{Raw: string(line)}
+	tokens, date := splitReceived(hop.Raw)
+	hop.Date = date
+	if date != "" {
+		if t, err := mail.ParseDate(date); err == nil {
+			hop.DateUnix = t.Unix()
+		}
+	}
+
+	clause := ""
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.comment {
+			if clause == "from" {
+				parseReceivedFromComment(hop, token.text)
+			}
+			continue
+		}
+		keyword := strings.ToLower(token.text)
+		switch keyword {
+		case "from", "by", "via", "with", "id", "for":
+		default:
+			continue
+		}
+		if i+1 >= len(tokens) || tokens[i+1].comment {
+			continue
+		}
+		clause = keyword
+		i++
+		value := tokens[i].text
+		switch keyword {
+		case "from":
+			hop.FromHost = value
+			// 没有 HELO 时 from 后直接是 [IP]
+			if ip := strings.Trim(value, "[]"); value != ip && net.ParseIP(ip) != nil {
+				hop.FromIP = ip
+			}
+		case "by":
+			hop.ByHost = value
+		case "via":
+			hop.Via = value
+		case "with":
+			hop.With = value
+		case "id":
+			hop.ID = strings.Trim(value, "<>")
+		case "for":
+			hop.For = strings.Trim(value, "<>")
+		}
+	}
+	return hop
+}
+
+// GetReceivedHops 解析顶层的所有 Received 头部，按投递顺序（从最早的一跳即最下面的头部开始）返回，并计算相邻两跳的间隔
+func (p *EmailParser) GetReceivedHops() []*ReceivedHop {
+	if p.receivedHopsDealed {
+		return p.receivedHops
+	}
+	p.receivedHopsDealed = true
+	for i := len(p.topNode.Header) - 1; i >= 0; i-- {
+		if p.topNode.Header[i].Name != "RECEIVED" {
+			continue
+		}
+		hop := ParseReceived(p.topNode.Header[i].Value)
+		if n := len(p.receivedHops); n > 0 {
+			if prev := p.receivedHops[n-1]; prev.DateUnix != 0 && hop.DateUnix != 0 {
+				hop.Delay = hop.DateUnix - prev.DateUnix
+			}
+		}
+		p.receivedHops = append(p.receivedHops, hop)
+	}
+	return p.receivedHops
+}
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/mailhonor/go-email/tnef"
 	mailhonorcharsetutils "github.com/mailhonor/go-utils/charset"
 	mailhonorquotedprintableutils "github.com/mailhonor/go-utils/quotedprintable"
 	mailhonorstringutils "github.com/mailhonor/go-utils/strings"
@@ -19,13 +20,19 @@ type MimeValueTokenNode struct {
 }
 
 type MimeValueParams struct {
-	Value  []byte
-	Params map[string][]byte
+	Value   []byte
+	Params  map[string][]byte
+	Defects []Defect // 解析缺陷，Offset 相对于输入数据
 }
 
 type MimeLine struct {
-	Name  string
-	Value []byte
+	Name   string
+	Value  []byte
+	Offset int // 头部行在原始数据中的起始偏移，新增或替换的行为-1
+
+	rawEnd  int    // 原始行（含折行和换行符）的结束偏移，修改头部时计算
+	edited  bool   // 是否为新增或替换的行
+	rawName string // 新增行输出时使用的名称（保留大小写）
 }
 
 type MimeAddress struct {
@@ -41,7 +48,8 @@ type MIMENode struct {
 	BodyStart   int // 正文在原始数据中的起始偏移
 	BodyLen     int // 正文长度
 
-	Header []MimeLine // 解析后的头部键值对
+	Header  []MimeLine // 解析后的头部键值对
+	Defects []Defect   // 解析缺陷
 
 	ContentType string // 媒体类型（如text/plain、multipart/mixed）
 	Encoding    string // 传输编码（BASE64/QUOTED-PRINTABLE/空）
@@ -55,14 +63,27 @@ type MIMENode struct {
 	isInline    bool   // 是否为内嵌附件
 
 	//
-	EmailParser *EmailParser
-	Parent      *MIMENode   // 父节点
-	Childs      []*MIMENode // 子节点
+	EmailParser    *EmailParser
+	Parent         *MIMENode   // 父节点
+	Childs         []*MIMENode // 子节点
+	embeddedParser *EmailParser
+	embeddedDealed bool
+	innerParser    *EmailParser // 解密或解包后的内层 MIME 实体（S/MIME、PGP/MIME）
+	isVirtual      bool
+	virtualData    []byte
+	tnefMessage    *tnef.Message
+	base64Checked  bool
+	headerModified bool        // 头部是否被修改
+	bodyReplaced   bool        // 正文是否被替换
+	replacedBody   []byte      // 替换后的原始正文
+	childsModified bool        // 子节点是否有增删
+	originalChilds []*MIMENode // 增删前的子节点
 }
 
 type EmailParserOptions struct {
-	DefaultCharset string // 默认字符集（如UTF-8、GBK）
-	EmailData      []byte // 原始邮件数据
+	DefaultCharset  string // 默认字符集（如UTF-8、GBK）
+	EmailData       []byte // 原始邮件数据
+	MaxNestingDepth int    // 内嵌邮件最大嵌套层数，0 表示使用默认值，小于0 表示不解析内嵌邮件
 }
 
 type EmailParser struct {
@@ -82,77 +103,42 @@ type EmailParser struct {
 	DispositionNotificationTo   MimeAddress
 	references                  []string
 	referencesDealed            bool
+	authResults                 []*AuthenticationResults
+	authResultsDealed           bool
+	receivedHops                []*ReceivedHop
+	receivedHopsDealed          bool
+	deliveryStatus              *DeliveryStatus
+	deliveryStatusDealed        bool
 	textNodes                   []*MIMENode
 	attachmentNodes             []*MIMENode
 	nodeClassified              bool
 	alternativeShowNodes        []*MIMENode
 	alternativeShowNodesDealed  bool
 	inlineAttachmentNodesDealed bool
+	parentNode                  *MIMENode // 内嵌邮件所在的外层节点
+	offsetsInDecodedData        bool      // 节点偏移相对于解码后的数据，而不是外层 EmailData
+	nestingDepth                int       // 内嵌层数，最外层为0
+	maxNestingDepth             int
 }
 
-// boundaryPos 记录一个边界符的位置信息
-type boundaryPos struct {
-	Boundary string // 边界符内容
-	Start    int    // 边界符在原始数据中的起始偏移
-	End      int    // 边界符在原始数据中的结束偏移
-}
-
-// scanAllBoundaries 全局扫描原始邮件数据，提取所有可能的MIME边界符
-func scanAllBoundaries(raw []byte) []boundaryPos {
-	var boundaries []boundaryPos
-	offset := 0
-	rawLen := len(raw)
-
-	for offset < rawLen {
-		// 查找边界符起始标记："\n--"（或行首 "--"）
-		var start int
-		if bytes.HasPrefix(raw[offset:], []byte("--")) {
-			start = offset // 行首直接以 "--" 开头
-		} else {
-			// 查找 "\n--"（换行后的边界符）
-			nlPos := bytes.Index(raw[offset:], []byte("\n--"))
-			if nlPos == -1 {
-				break // 没有更多边界符
-			}
-			start = offset + nlPos + 1 // 跳过 "\n"，指向 "--" 起始位置
-		}
-
-		// 提取边界符内容（从 "--" 后到下一个换行符）
-		boundaryStart := start + 2 // 跳过 "--"
-		nlPos := bytes.Index(raw[boundaryStart:], []byte("\n"))
-		if nlPos == -1 || (boundaryStart+nlPos) > rawLen {
-			break // 边界符不完整，终止扫描
-		}
-		boundaryEnd := boundaryStart + nlPos
-		boundaryStr := strings.TrimSpace(string(raw[boundaryStart:boundaryEnd]))
-
-		// 记录边界符（去掉结束标记 "--"）
-		boundaries = append(boundaries, boundaryPos{
-			Boundary: boundaryStr,
-			Start:    start,
-			End:      boundaryEnd + 1, // 包含换行符
-		})
-
-		// 推进偏移量，继续扫描下一个边界符
-		offset = boundaryEnd + 1
-	}
-	return boundaries
-}
-
-func emailParserAppendOneLine(lines *[]MimeLine, lineData []byte) {
+// emailParserAppendOneLine 追加一个逻辑头部行，缺少冒号时返回false
+func emailParserAppendOneLine(lines *[]MimeLine, lineData []byte, offset int) bool {
 	pos := bytes.Index(lineData, []byte(":"))
 	if pos == -1 {
 		*lines = append(*lines, MimeLine{
-			Name: strings.ToUpper(strings.TrimSpace(string(lineData))),
+			Name:   strings.ToUpper(strings.TrimSpace(string(lineData))),
+			Offset: offset,
 		})
-		return
+		return false
 	}
 	name := strings.ToUpper(strings.TrimSpace(string(lineData[:pos])))
 	value := bytes.TrimSpace(lineData[pos+1:])
 	*lines = append(*lines, MimeLine{
-		Name:  name,
-		Value: value,
+		Name:   name,
+		Value:  value,
+		Offset: offset,
 	})
+	return true
 }
 
 func (n *MIMENode) GetHeaderValue(headerName string) ([]byte, error) {
@@ -175,6 +161,15 @@ func (n *MIMENode) GetHeaderValueIgnoreNotFound(headerName string) []byte {
 	return []byte{}
 }
 
+// GetRawHeaderLine 返回头部行的原始数据（含折行及换行符，保留名称大小写），
+// 新增或替换的行返回折行后的内容（CRLF 换行）；DKIM 等签名需要原始头部
+func (n *MIMENode) GetRawHeaderLine(line MimeLine) []byte {
+	if line.edited {
+		return []byte(FoldMimeHeaderLine(line.rawName, string(line.Value)) + "\r\n")
+	}
+	return n.getImapRawHeaderLine(line)
+}
+
 func (n *MIMENode) IsTnef(headerName string) bool {
 	n.EmailParser.classifyNodes()
 	return n.isTnef
@@ -185,18 +180,32 @@ func (n *MIMENode) IsInlineAttachment() bool {
 	return n.isInline
 }
 
+// GetRawContent 返回正文原始（未解码）数据；流式解析时 EmailData 为空，返回空切片
+func (n *MIMENode) GetRawContent() []byte {
+	if n.isVirtual {
+		return n.virtualData
+	}
+	data := n.EmailParser.EmailData
+	if n.BodyStart+n.BodyLen > len(data) {
+		return []byte{}
+	}
+	return data[n.BodyStart : n.BodyStart+n.BodyLen]
+}
+
 func (n *MIMENode) GetDecodedContent() []byte {
-	parser := n.EmailParser
+	raw := n.GetRawContent()
 	if n.Encoding == "BASE64" {
-		decodedData, err := base64.StdEncoding.DecodeString(string(parser.EmailData[n.BodyStart : n.BodyStart+n.BodyLen]))
+		decodedData, err := base64.StdEncoding.DecodeString(string(raw))
 		if err != nil {
-			return []byte{}
+			// 返回出错位置之前已解码的数据，并记录缺陷
+			n.checkBase64Defect()
+			return decodedData
 		}
 		return decodedData
 	} else if n.Encoding == "QUOTED-PRINTABLE" {
-		return mailhonorquotedprintableutils.DecodeMimeBody(parser.EmailData[n.BodyStart : n.BodyStart+n.BodyLen])
+		return mailhonorquotedprintableutils.DecodeMimeBody(raw)
 	} else {
-		return parser.EmailData[n.BodyStart : n.BodyStart+n.BodyLen]
+		return raw
 	}
 }
 
@@ -206,15 +215,44 @@ func (n *MIMENode) GetDecodedTextContent() string {
 	return mailhonorcharsetutils.ConvertToUTF8(data, n.Charset, n.EmailParser.DefaultCharset)
 }
 
-func (p *EmailParser) parseMimeSelf(emailPartData []byte) *MIMENode {
-	node := &MIMENode{
-		EmailParser: p,
+// mimeHeaderInEncodedWord 判断行尾是否处于未结束的 encoded-word（=?charset?X?...）之中
+func mimeHeaderInEncodedWord(line []byte) bool {
+	start := bytes.LastIndex(line, []byte("=?"))
+	if start < 0 {
+		return false
 	}
+	word := line[start+2:]
+	// 跳过 charset?X?
+	pos := bytes.IndexByte(word, '?')
+	if pos < 1 || len(word) < pos+3 || word[pos+2] != '?' {
+		return false
+	}
+	return !bytes.Contains(word[pos+3:], []byte("?="))
+}
+
+// appendMimeHeaderContinuation 展开折行，把续行追加到逻辑行
+// 按 RFC 5322 2.2.3 只去掉换行，保留续行开头的空白（"hello\r\n world" 解析为 "hello world"）；
+// 一个 encoded-word 被拆到两行时去掉该空白，使其还原为完整的 encoded-word
+func appendMimeHeaderContinuation(logicLine []byte, line []byte) []byte {
+	if mimeHeaderInEncodedWord(logicLine) {
+		return append(logicLine, line[1:]...)
+	}
+	return append(logicLine, line...)
+}
 
+// parseMimeHeader 解析头部数据（含结尾空行），填充节点的头部字段
+func (p *EmailParser) parseMimeHeader(node *MIMENode, headerData []byte) {
 	// 解析邮件头行
-	data := emailPartData
+	data := headerData
 	var logicLine []byte
+	logicLineOffset := node.HeaderStart
+	appendOneLine := func() {
+		if !emailParserAppendOneLine(&node.Header, logicLine, logicLineOffset) {
+			node.addDefect(DefectHeaderWithoutColon, logicLineOffset, "")
+		}
+	}
 	for len(data) > 0 {
+		lineOffset := node.HeaderStart + len(headerData) - len(data)
 		idx := bytes.Index(data, []byte("\n"))
 		var line []byte
 		if idx == -1 {
@@ -225,12 +263,13 @@ func (p *EmailParser) parseMimeSelf(emailPartData []byte) *MIMENode {
 			data = data[idx+1:]
 		}
 		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
-			logicLine = append(logicLine, line[1:]...)
+			logicLine = appendMimeHeaderContinuation(logicLine, line)
 		} else {
 			if len(logicLine) > 0 {
-				emailParserAppendOneLine(&node.Header, logicLine)
+				appendOneLine()
 			}
 			logicLine = line
+			logicLineOffset = lineOffset
 		}
 		logicLine = mailhonorstringutils.TrimRightBytes(logicLine, []byte("\r\n"))
 		if idx != -1 {
@@ -243,17 +282,15 @@ func (p *EmailParser) parseMimeSelf(emailPartData []byte) *MIMENode {
 		}
 	}
 	if len(logicLine) > 0 {
-		emailParserAppendOneLine(&node.Header, logicLine)
+		appendOneLine()
 	}
-	node.HeaderLen = len(emailPartData) - len(data)
-	if node.HeaderLen > 0 && emailPartData[node.HeaderLen-1] == '\n' {
+	node.HeaderLen = len(headerData) - len(data)
+	if node.HeaderLen > 0 && headerData[node.HeaderLen-1] == '\n' {
 		node.HeaderLen--
 	}
-	if node.HeaderLen > 0 && emailPartData[node.HeaderLen-1] == '\r' {
+	if node.HeaderLen > 0 && headerData[node.HeaderLen-1] == '\r' {
 		node.HeaderLen--
 	}
-	node.BodyStart = len(emailPartData) - len(data)
-	node.BodyLen = len(data)
 
 	// 解析 CONTENT-TRANSFER-ENCODING
 	value, err := node.GetHeaderValue("CONTENT-TRANSFER-ENCODING")
@@ -285,60 +322,7 @@ func (p *EmailParser) parseMimeSelf(emailPartData []byte) *MIMENode {
 	if err == nil {
 		node.ContentID = string(mailhonorstringutils.TrimBytes(value, []byte("\"<>\r\n\t ")))
 	}
-
-	return node
-}
-
-func (p *EmailParser) parseMime(offset int, emailPartData []byte, boundaries []boundaryPos) *MIMENode {
-	node := p.parseMimeSelf(emailPartData)
-	node.HeaderStart += offset
-	node.BodyStart += offset
-
-	// 不是MULTIPART类型，直接返回
-	if !strings.HasPrefix(node.ContentType, "MULTIPART/") {
-		return node
-	}
-
-	// 是MULTIPART类型，继续解析子节点
-	if node.Boundary == "" {
-		return node
-	}
-
-	//
-	lastId := -1
-	for i := 0; i < len(boundaries); i++ {
-		bo := boundaries[i]
-		if bo.Boundary != node.Boundary && bo.Boundary != node.Boundary+"--" {
-			continue
-		}
-		if lastId == -1 {
-			lastId = i
-			continue
-		}
-		so := boundaries[lastId]
-		eo := boundaries[i]
-		var newBoundaries []boundaryPos
-		if lastId+1 < i-1 {
-			newBoundaries = boundaries[lastId+1 : i-1]
-		}
-		newNode := p.parseMime(so.End, p.EmailData[so.End:eo.Start-1], newBoundaries)
-		newNode.Parent = node
-		node.Childs = append(node.Childs, newNode)
-		lastId = i
-	}
-	if lastId > -1 {
-		so := boundaries[lastId]
-		tmpdata := p.EmailData[so.End:]
-		if len(tmpdata) > 0 {
-			tmpdata = mailhonorstringutils.TrimBytes(tmpdata, []byte("\r\n\t "))
-			if len(tmpdata) > 10 && bytes.Contains(tmpdata, []byte("\n")) {
-				newNode := p.parseMime(so.End, tmpdata, []boundaryPos{})
-				newNode.Parent = node
-				node.Childs = append(node.Childs, newNode)
-			}
-		}
-	}
-	return node
+	p.checkHeaderDefects(node)
 }
 
 func (p *EmailParser) parseDate() {
@@ -363,31 +347,34 @@ func (p *EmailParser) parseDate() {
 	}
 }
 
+// parseTopHeaders 解析顶层节点中的邮件头字段（主题、发件人等）
+func (p *EmailParser) parseTopHeaders() {
+	topNode := p.topNode
+	defaultCharset := p.DefaultCharset
+	//
+	p.MessageID = string(mailhonorstringutils.TrimBytes(topNode.GetHeaderValueIgnoreNotFound("MESSAGE-ID"), []byte("\"<>\r\n\t ")))
+	p.parseDate()
+	p.Subject = ParseMimeValueString(topNode.GetHeaderValueIgnoreNotFound("SUBJECT"), defaultCharset)
+	p.From = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("FROM"), defaultCharset)
+	p.To = ParseMimeAddress(topNode.GetHeaderValueIgnoreNotFound("TO"), defaultCharset)
+	p.Cc = ParseMimeAddress(topNode.GetHeaderValueIgnoreNotFound("CC"), defaultCharset)
+	p.Bcc = ParseMimeAddress(topNode.GetHeaderValueIgnoreNotFound("BCC"), defaultCharset)
+	p.Sender = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("SENDER"), defaultCharset)
+	p.ReplyTo = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("REPLY-TO"), defaultCharset)
+	p.DispositionNotificationTo = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("DISPOSITION-NOTIFICATION-TO"), defaultCharset)
+}
+
 func EmailParserNew(options EmailParserOptions) *EmailParser {
 	parser := &EmailParser{
-		DefaultCharset: options.DefaultCharset,
-		EmailData:      options.EmailData,
+		DefaultCharset:  options.DefaultCharset,
+		EmailData:       options.EmailData,
+		maxNestingDepth: options.MaxNestingDepth,
 	}
 	if parser.DefaultCharset == "" {
 		parser.DefaultCharset = "UTF-8"
 	}
-	//
-	boundaries := scanAllBoundaries(parser.EmailData)
-	parser.topNode = parser.parseMime(0, parser.EmailData, boundaries)
-	topNode := parser.topNode
-	defaultCharset := parser.DefaultCharset
-	//
-	parser.MessageID = string(mailhonorstringutils.TrimBytes(topNode.GetHeaderValueIgnoreNotFound("MESSAGE-ID"), []byte("\"<>\r\n\t ")))
-	parser.parseDate()
-	parser.Subject = ParseMimeValueString(topNode.GetHeaderValueIgnoreNotFound("SUBJECT"), defaultCharset)
-	parser.From = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("FROM"), defaultCharset)
-	parser.To = ParseMimeAddress(topNode.GetHeaderValueIgnoreNotFound("TO"), defaultCharset)
-	parser.Cc = ParseMimeAddress(topNode.GetHeaderValueIgnoreNotFound("CC"), defaultCharset)
-	parser.Bcc = ParseMimeAddress(topNode.GetHeaderValueIgnoreNotFound("BCC"), defaultCharset)
-	parser.Sender = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("SENDER"), defaultCharset)
-	parser.ReplyTo = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("REPLY-TO"), defaultCharset)
-	parser.DispositionNotificationTo = ParseMimeAddressFirstOne(topNode.GetHeaderValueIgnoreNotFound("DISPOSITION-NOTIFICATION-TO"), defaultCharset)
-
+	// 内存数据同样走流式解析，bytes.Reader 不会返回错误
+	_ = parser.parseStream(bytes.NewReader(parser.EmailData), nil)
 	return parser
 }
 
@@ -438,10 +425,16 @@ func (p *EmailParser) classifyNodes() {
 			}
 			return
 		case "APPLICATION":
-			p.attachmentNodes = append(p.attachmentNodes, node)
-			if strings.Contains(typeStr, "TNEF") {
+			if node.isTnefNode() {
 				node.isTnef = true
+				// TNEF 解码成功时，用其中的正文和附件替代 winmail.dat 本身
+				if texts, attachments, ok := p.expandTnefNode(node); ok {
+					p.textNodes = append(p.textNodes, texts...)
+					p.attachmentNodes = append(p.attachmentNodes, attachments...)
+					return
+				}
 			}
+			p.attachmentNodes = append(p.attachmentNodes, node)
 			return
 		case "MESSAGE":
 			if strings.Contains(typeStr, "DELIVERY") || strings.Contains(typeStr, "NOTIFICATION") {
@@ -1,8 +1,16 @@
 package emailparser
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime/quotedprintable"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +49,837 @@ func TestEmailParser(t *testing.T) {
 		testParserEmailFile(t, emailFilename)
 	}
 }
+
+const testNestedEmail = "From: \"Alice\" <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: =?UTF-8?B?5rWL6K+V?=\r\n" +
+	"Date: Mon, 2 Jan 2006 15:04:05 +0800\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"preamble\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"hello plain\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<b>hello</b>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/octet-stream; name=\"a.bin\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Disposition: attachment; filename=\"a.bin\"\r\n" +
+	"\r\n" +
+	"aGVsbG8gd29y\r\n" +
+	"bGQ=\r\n" +
+	"--outer--\r\n"
+
+func TestEmailParserNewFromReader(t *testing.T) {
+	memParser := EmailParserNew(EmailParserOptions{EmailData: []byte(testNestedEmail)})
+	bodies := map[int]string{}
+	streamParser, err := EmailParserNewFromReader(EmailParserStreamOptions{
+		Reader: strings.NewReader(testNestedEmail),
+		LeafBodyHandler: func(node *MIMENode, body io.Reader) error {
+			data, err := io.ReadAll(node.NewDecodedReader(body))
+			bodies[node.HeaderStart] = string(data)
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatalf("stream parse failed: %v", err)
+	}
+	if streamParser.Subject != "测试" || streamParser.Subject != memParser.Subject {
+		t.Fatalf("subject mismatch: %q, %q", streamParser.Subject, memParser.Subject)
+	}
+
+	// 偏移量：正文不含分隔行前的 CRLF（RFC 2046 5.1.1，CRLF 属于分隔行）
+	type nodeOffsets struct {
+		contentType                                string
+		headerStart, headerLen, bodyStart, bodyLen int
+	}
+	expected := []nodeOffsets{
+		{"MULTIPART/MIXED", 0, 174, 176, 399},
+		{"MULTIPART/ALTERNATIVE", 195, 55, 252, 139},
+		{"TEXT/PLAIN", 261, 41, 304, 11},
+		{"TEXT/HTML", 326, 40, 368, 12},
+		{"APPLICATION/OCTET-STREAM", 402, 140, 544, 18},
+	}
+	for _, parser := range []*EmailParser{memParser, streamParser} {
+		var nodes []nodeOffsets
+		var walk func(node *MIMENode)
+		walk = func(node *MIMENode) {
+			nodes = append(nodes, nodeOffsets{node.ContentType, node.HeaderStart, node.HeaderLen, node.BodyStart, node.BodyLen})
+			for _, child := range node.Childs {
+				walk(child)
+			}
+		}
+		walk(parser.GetTopMIMENode())
+		if fmt.Sprint(nodes) != fmt.Sprint(expected) {
+			t.Fatalf("unexpected node offsets: %v", nodes)
+		}
+	}
+
+	texts := memParser.GetTextNodes()
+	if len(texts) != 2 || string(texts[1].GetDecodedContent()) != "<b>hello</b>" {
+		t.Fatalf("unexpected text nodes: %d", len(texts))
+	}
+	attachments := memParser.GetAttachmentNodes()
+	if len(attachments) != 1 || string(attachments[0].GetDecodedContent()) != "hello world" {
+		t.Fatalf("unexpected attachment nodes: %d", len(attachments))
+	}
+	if bodies[attachments[0].HeaderStart] != "hello world" || bodies[texts[0].HeaderStart] != "hello plain" {
+		t.Fatalf("unexpected streamed bodies: %q", bodies)
+	}
+}
+
+func TestEmbeddedMessage(t *testing.T) {
+	emailData := "From: outer@example.com\r\n" +
+		"Subject: Fwd: inner\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"see attached\r\n" +
+		"--b1\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"From: inner@example.com\r\n" +
+		"Subject: inner\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b2\"\r\n" +
+		"\r\n" +
+		"--b2\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"inner body\r\n" +
+		"--b2\r\n" +
+		"Content-Type: application/pdf; name=\"x.pdf\"\r\n" +
+		"\r\n" +
+		"PDF\r\n" +
+		"--b2--\r\n" +
+		"--b1--\r\n"
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	attachments := parser.GetAttachmentNodes()
+	if len(attachments) != 1 || attachments[0].ContentType != "MESSAGE/RFC822" {
+		t.Fatalf("unexpected attachment nodes: %d", len(attachments))
+	}
+	embedded := attachments[0].GetEmbeddedEmailParser()
+	if embedded == nil || embedded.Subject != "inner" || embedded.From.Email != "inner@example.com" {
+		t.Fatalf("embedded message not parsed")
+	}
+	if embedded.GetParentMIMENode() != attachments[0] || embedded.GetNestingDepth() != 1 {
+		t.Fatalf("unexpected embedded parent")
+	}
+	texts := embedded.GetTextNodes()
+	if len(texts) != 1 || string(texts[0].GetDecodedContent()) != "inner body" {
+		t.Fatalf("unexpected embedded text nodes: %d", len(texts))
+	}
+	if names := embedded.GetAttachmentNodes(); len(names) != 1 || names[0].Name != "x.pdf" {
+		t.Fatalf("unexpected embedded attachment nodes")
+	}
+	if embedded.OffsetsInDecodedData() || embedded.GetTopMIMENode().HeaderStart != attachments[0].BodyStart {
+		t.Fatalf("embedded offsets not relative to outer data")
+	}
+	innerText := texts[0]
+	if got := string(parser.EmailData[innerText.BodyStart : innerText.BodyStart+innerText.BodyLen]); got != "inner body" {
+		t.Fatalf("unexpected inner body in outer data: %q", got)
+	}
+
+	// BASE64 编码的内嵌邮件从解码后的数据解析，节点偏移相对于解码后的数据
+	innerData := "From: inner@example.com\r\nSubject: inner\r\n\r\ninner body\r\n"
+	encodedData := "From: outer@example.com\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(innerData)) + "\r\n"
+	encoded := EmailParserNew(EmailParserOptions{EmailData: []byte(encodedData)}).GetTopMIMENode().GetEmbeddedEmailParser()
+	if encoded == nil || encoded.Subject != "inner" || !encoded.OffsetsInDecodedData() {
+		t.Fatalf("encoded embedded message not parsed")
+	}
+	top := encoded.GetTopMIMENode()
+	if got := string(encoded.EmailData[top.BodyStart : top.BodyStart+top.BodyLen]); top.HeaderStart != 0 || got != "inner body\r\n" {
+		t.Fatalf("unexpected decoded offsets: %d, %q", top.HeaderStart, got)
+	}
+
+	parser = EmailParserNew(EmailParserOptions{EmailData: []byte(emailData), MaxNestingDepth: -1})
+	if parser.GetAttachmentNodes()[0].GetEmbeddedEmailParser() != nil {
+		t.Fatalf("embedded message parsed beyond depth limit")
+	}
+}
+
+func TestTnefExpand(t *testing.T) {
+	attribute := func(level byte, id uint32, data string) string {
+		var b bytes.Buffer
+		b.WriteByte(level)
+		binary.Write(&b, binary.LittleEndian, id)
+		binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+		b.WriteString(data)
+		binary.Write(&b, binary.LittleEndian, uint16(0))
+		return b.String()
+	}
+	tnefData := "\x78\x9f\x3e\x22\x01\x00" +
+		attribute(1, 0x00018004, "meeting\x00") +
+		attribute(1, 0x0002800C, "plain body\x00") +
+		attribute(2, 0x00069002, strings.Repeat("\x00", 14)) +
+		attribute(2, 0x00018010, "notes.txt\x00") +
+		attribute(2, 0x0006800F, "attached notes")
+	emailData := "From: a@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/ms-tnef; name=\"winmail.dat\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(tnefData)) + "\r\n" +
+		"--b--\r\n"
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	texts := parser.GetTextNodes()
+	if len(texts) != 1 || texts[0].GetDecodedTextContent() != "plain body" || !texts[0].IsVirtual() {
+		t.Fatalf("unexpected tnef text nodes: %d", len(texts))
+	}
+	attachments := parser.GetAttachmentNodes()
+	if len(attachments) != 1 || attachments[0].Filename != "notes.txt" || string(attachments[0].GetDecodedContent()) != "attached notes" {
+		t.Fatalf("unexpected tnef attachment nodes: %d", len(attachments))
+	}
+	if msg := attachments[0].Parent.GetTnefMessage(); msg == nil || msg.Subject != "meeting" {
+		t.Fatalf("tnef message not decoded")
+	}
+}
+
+func TestDefects(t *testing.T) {
+	emailData := "From: \"Alice <alice@example.com>\r\n" +
+		"Subject: =?X-UNKNOWN-CS?B?aGVsbG8=?=\r\n" +
+		"Bad header line\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=\"utf-8\r\n" +
+		"\r\n" +
+		"line one\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"aGVsbG8g!!!!\r\n"
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	found := map[DefectType]int{}
+	for _, d := range parser.GetDefects() {
+		found[d.Type] = d.Offset
+	}
+	for _, dt := range []DefectType{DefectUnterminatedQuotedString, DefectUnknownCharset, DefectHeaderWithoutColon,
+		DefectBareLF, DefectMissingClosingBoundary, DefectInvalidBase64} {
+		if _, ok := found[dt]; !ok {
+			t.Fatalf("defect %s not reported: %v", dt, parser.GetDefects())
+		}
+	}
+	if found[DefectHeaderWithoutColon] != strings.Index(emailData, "Bad header") {
+		t.Fatalf("unexpected HeaderWithoutColon offset: %d", found[DefectHeaderWithoutColon])
+	}
+	if found[DefectInvalidBase64] != strings.Index(emailData, "!!!!") {
+		t.Fatalf("unexpected InvalidBase64 offset: %d", found[DefectInvalidBase64])
+	}
+	if data := parser.GetAttachmentNodes()[0].GetDecodedContent(); string(data) != "hello " {
+		t.Fatalf("unexpected partially decoded data: %q", data)
+	}
+
+	// BASE64 编码的内嵌邮件：缺陷的偏移相对于解码后的数据，不计入外层结果，与是否已访问内嵌邮件无关
+	inner := "Subject: inner\r\nBad inner line\r\n\r\nbody\r\n"
+	emailData = "Subject: outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(inner)) + "\r\n"
+	parser = EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	before := parser.GetDefects()
+	embedded := parser.GetTopMIMENode().GetEmbeddedEmailParser()
+	if embedded == nil || !embedded.OffsetsInDecodedData() {
+		t.Fatal("embedded message not decoded")
+	}
+	after := parser.GetDefects()
+	if len(before) != 0 || len(after) != 0 {
+		t.Fatalf("decoded embedded defects merged into outer result: %v %v", before, after)
+	}
+	defects := embedded.GetDefects()
+	if len(defects) != 1 || defects[0].Type != DefectHeaderWithoutColon || defects[0].Offset != strings.Index(inner, "Bad inner") {
+		t.Fatalf("unexpected embedded defects: %v", defects)
+	}
+}
+
+func TestMimeHeaderUnfolding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"hello\r\n world", "hello world"},
+		{"hello\r\n  world", "hello  world"},
+		{"=?UTF-8?B?5rWL?= =?UTF-8?B?6K+V?=", "测试"},
+		{"=?UTF-8?B?5rWL?=\r\n =?UTF-8?B?6K+V?=", "测试"},
+		{"=?UTF-8?B?5rWL?=\r\n world", "测 world"},
+		{"=?UTF-8?B?5rWL\r\n 6K+V?=", "测试"},
+		{"a =?UTF-8?B?5rWL?= b", "a 测 b"},
+	}
+	for _, test := range tests {
+		parser := EmailParserNew(EmailParserOptions{EmailData: []byte("Subject: " + test.header + "\r\n\r\nbody\r\n")})
+		if parser.Subject != test.want {
+			t.Fatalf("unfold %q: got %q, want %q", test.header, parser.Subject, test.want)
+		}
+	}
+}
+
+func TestMimeValueEncoder(t *testing.T) {
+	values := []string{
+		"hello world",
+		"a very long plain ASCII subject line that certainly exceeds the seventy eight character limit",
+		"Re: 关于下周的会议安排 and some English words mixed in 以及更多的中文内容用来测试折行",
+		"日本語のテキスト、長い件名のテストです。日本語のテキスト、長い件名のテストです。",
+		"繁體中文測試",
+	}
+	for _, charset := range []string{"UTF-8", "GBK", "GB18030", "ISO-2022-JP", "BIG5"} {
+		for _, value := range values {
+			for _, encoding := range []string{"", "B", "Q"} {
+				encoded, err := EncodeMimeValueString(value, charset, encoding)
+				if err != nil {
+					// 字符集无法表示该文本
+					continue
+				}
+				line := FoldMimeHeaderLine("Subject", encoded)
+				for _, l := range strings.Split(line, "\r\n") {
+					if len(l) > 78 && len(strings.Fields(strings.TrimPrefix(l, "Subject:"))) > 1 {
+						t.Fatalf("header line not folded: %q", l)
+					}
+					for _, word := range strings.Fields(l) {
+						if strings.HasPrefix(word, "=?") && len(word) > 75 {
+							t.Fatalf("encoded word too long: %s", word)
+						}
+					}
+				}
+				parser := EmailParserNew(EmailParserOptions{EmailData: []byte(line + "\r\n\r\nbody")})
+				if parser.Subject != value {
+					t.Fatalf("round trip failed(%s, %s): %q => %q", charset, encoding, value, parser.Subject)
+				}
+			}
+		}
+	}
+
+	filename := "一个非常非常长的附件文件名称用来测试RFC2231续行参数的生成.pdf"
+	for _, charset := range []string{"UTF-8", "GBK"} {
+		param, err := EncodeMimeParam2231("filename", filename, charset)
+		if err != nil {
+			t.Fatalf("encode param failed: %v", err)
+		}
+		if !strings.Contains(param, "filename*0*="+charset+"''") {
+			t.Fatalf("expected continuation parameters: %s", param)
+		}
+		vp := ParseMimeValueParams([]byte("attachment; " + param))
+		if got := vp.ParseParamStringValue("FILENAME", "UTF-8"); got != filename {
+			t.Fatalf("param round trip failed: %q", got)
+		}
+	}
+	param, _ := EncodeMimeParam2231("name", "a \"quoted\" name.txt", "UTF-8")
+	vp := ParseMimeValueParams([]byte("text/plain; " + param))
+	if got := vp.ParseParamStringValue("NAME", "UTF-8"); got != "a \"quoted\" name.txt" {
+		t.Fatalf("param round trip failed: %q", got)
+	}
+}
+
+func TestFoldMimeHeaderLine(t *testing.T) {
+	if line := FoldMimeHeaderLine("Subject", "hello world"); line != "Subject: hello world" {
+		t.Fatalf("short line changed: %q", line)
+	}
+
+	long := strings.Repeat("word ", 30) + "end"
+	line := FoldMimeHeaderLine("X-Long", long)
+	for _, l := range strings.Split(line, "\r\n") {
+		if len(l) > 78 {
+			t.Fatalf("line not folded: %q", l)
+		}
+	}
+	if strings.ReplaceAll(line, "\r\n", "") != "X-Long: "+long {
+		t.Fatalf("folding changed content: %q", line)
+	}
+
+	// 已有的折行保留不变，各物理行按自身长度决定是否再折行
+	prefolded := "v=1; a=rsa-sha256; d=example.com;\r\n\ts=sel; h=from:to;\r\n\tb=" + strings.Repeat("A", 40)
+	if line := FoldMimeHeaderLine("DKIM-Signature", prefolded); line != "DKIM-Signature: "+prefolded {
+		t.Fatalf("pre-folded value changed: %q", line)
+	}
+	line = FoldMimeHeaderLine("X-Mixed", "short;\r\n\t"+long)
+	lines := strings.Split(line, "\r\n")
+	if lines[0] != "X-Mixed: short;" || len(lines) < 3 {
+		t.Fatalf("unexpected folding: %q", line)
+	}
+	for _, l := range lines {
+		if len(l) > 78 {
+			t.Fatalf("line not folded: %q", l)
+		}
+	}
+}
+
+func TestCanonicalizeCRLF(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"", ""},
+		{"a\r\nb\r\n", "a\r\nb\r\n"},
+		{"a\nb\n", "a\r\nb\r\n"},
+		{"\na\r\nb\n", "\r\na\r\nb\r\n"},
+		{"a\rb", "a\rb"},
+	} {
+		if got := string(CanonicalizeCRLF([]byte(c.in))); got != c.want {
+			t.Fatalf("CanonicalizeCRLF(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(testNestedEmail)})
+	if data, err := parser.Serialize(); err != nil || string(data) != testNestedEmail {
+		t.Fatalf("unmodified serialization differs: %v", err)
+	}
+
+	top := parser.GetTopMIMENode()
+	top.PrependHeader("X-Scanned", "yes")
+	top.RemoveHeader("Date")
+	top.ReplaceHeader("To", "carol@example.com")
+	texts := parser.GetTextNodes()
+	if err := texts[0].ReplaceDecodedBody([]byte("hello plain\r\n--\r\ndisclaimer")); err != nil {
+		t.Fatalf("replace body failed: %v", err)
+	}
+	attachments := parser.GetAttachmentNodes()
+	if err := attachments[0].Delete(); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := top.InsertChild(-1, []byte("Content-Type: application/octet-stream; name=\"note.txt\"\r\n"+
+		"Content-Disposition: attachment; filename=\"note.txt\"\r\n\r\nremoved a.bin")); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if err := top.ReplaceBody([]byte("x")); err != ErrRewriteMultipartBody {
+		t.Fatalf("expected ErrRewriteMultipartBody, got %v", err)
+	}
+
+	data, err := parser.Serialize()
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	expected := "X-Scanned: yes\r\n" +
+		"From: \"Alice\" <alice@example.com>\r\n" +
+		"To: carol@example.com\r\n" +
+		"Subject: =?UTF-8?B?5rWL6K+V?=\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+		"\r\n" +
+		"preamble\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"hello plain\r\n--\r\ndisclaimer\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"\r\n" +
+		"<b>hello</b>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/octet-stream; name=\"note.txt\"\r\n" +
+		"Content-Disposition: attachment; filename=\"note.txt\"\r\n\r\nremoved a.bin\r\n" +
+		"--outer--\r\n"
+	if string(data) != expected {
+		t.Fatalf("unexpected serialization:\n%s", data)
+	}
+
+	reparsed := EmailParserNew(EmailParserOptions{EmailData: data})
+	if defects := reparsed.GetDefects(); len(defects) > 0 {
+		t.Fatalf("unexpected defects: %v", defects)
+	}
+	if attachments := reparsed.GetAttachmentNodes(); len(attachments) != 1 || attachments[0].Filename != "note.txt" {
+		t.Fatalf("unexpected attachments after rewrite")
+	}
+	// 流式解析的邮件没有保存原始数据，无法重新生成
+	streamParser, err := EmailParserNewFromReader(EmailParserStreamOptions{Reader: strings.NewReader(testNestedEmail)})
+	if err != nil {
+		t.Fatalf("stream parse failed: %v", err)
+	}
+	streamParser.GetTopMIMENode().PrependHeader("X-Scanned", "yes")
+	if _, err := streamParser.Serialize(); err != ErrRewriteNoEmailData {
+		t.Fatalf("expected ErrRewriteNoEmailData, got %v", err)
+	}
+	if _, err := streamParser.WriteTo(io.Discard); err != ErrRewriteNoEmailData {
+		t.Fatalf("expected ErrRewriteNoEmailData, got %v", err)
+	}
+
+	// BASE64/QUOTED-PRINTABLE 编码的内嵌邮件：修改解码后的内嵌邮件，写回时按原传输编码重新编码
+	inner := "Subject: inner\r\nContent-Type: text/plain\r\n\r\ninner body =\r\n"
+	for _, cte := range []string{"base64", "quoted-printable"} {
+		encoded := base64.StdEncoding.EncodeToString([]byte(inner))
+		if cte == "quoted-printable" {
+			var qp bytes.Buffer
+			qw := quotedprintable.NewWriter(&qp)
+			qw.Write([]byte(inner))
+			qw.Close()
+			encoded = strings.TrimSuffix(qp.String(), "\r\n")
+		}
+		outer := "Subject: outer\r\n" +
+			"Content-Type: message/rfc822\r\n" +
+			"Content-Transfer-Encoding: " + cte + "\r\n" +
+			"\r\n" + encoded + "\r\n"
+		parser = EmailParserNew(EmailParserOptions{EmailData: []byte(outer)})
+		embedded := parser.GetTopMIMENode().GetEmbeddedEmailParser()
+		if embedded == nil {
+			t.Fatalf("%s: embedded message not parsed", cte)
+		}
+		if err := embedded.GetTopMIMENode().ReplaceHeader("Subject", "edited"); err != nil {
+			t.Fatalf("%s: replace header failed: %v", cte, err)
+		}
+		data, err = parser.Serialize()
+		if err != nil {
+			t.Fatalf("%s: serialize failed: %v", cte, err)
+		}
+		reparsed := EmailParserNew(EmailParserOptions{EmailData: data})
+		top := reparsed.GetTopMIMENode()
+		if reparsed.Subject != "outer" || top.Encoding != strings.ToUpper(cte) {
+			t.Fatalf("%s: outer message changed: %q", cte, data)
+		}
+		edited := top.GetEmbeddedEmailParser()
+		if edited == nil || edited.Subject != "edited" {
+			t.Fatalf("%s: embedded edit lost: %q", cte, data)
+		}
+		if body := edited.GetTextNodes()[0].GetDecodedTextContent(); body != "inner body =\r\n" {
+			t.Fatalf("%s: embedded body changed: %q", cte, body)
+		}
+	}
+
+	// 新增的头部只接受合法的名称和折行
+	parser = EmailParserNew(EmailParserOptions{EmailData: []byte(testNestedEmail)})
+	top = parser.GetTopMIMENode()
+	for _, c := range []struct{ name, value string }{
+		{"X-Test", "a\r\nBcc: eve@example.com"},
+		{"X-Test", "a\nBcc: eve@example.com"},
+		{"X-Test", "a\rb"},
+		{"X-Test", "a\r\n"},
+		{"X-Test:", "a"},
+		{"X Test", "a"},
+		{"", "a"},
+	} {
+		if err := top.AddHeader(c.name, c.value); err != ErrRewriteInvalidHeader {
+			t.Fatalf("AddHeader(%q, %q): expected ErrRewriteInvalidHeader, got %v", c.name, c.value, err)
+		}
+		if err := top.PrependHeader(c.name, c.value); err != ErrRewriteInvalidHeader {
+			t.Fatalf("PrependHeader(%q, %q): expected ErrRewriteInvalidHeader, got %v", c.name, c.value, err)
+		}
+		if err := top.ReplaceHeader(c.name, c.value); err != ErrRewriteInvalidHeader {
+			t.Fatalf("ReplaceHeader(%q, %q): expected ErrRewriteInvalidHeader, got %v", c.name, c.value, err)
+		}
+	}
+	if err := top.PrependHeader("X-Folded", "a;\r\n\tb"); err != nil {
+		t.Fatalf("valid fold rejected: %v", err)
+	}
+	data, err = parser.Serialize()
+	if err != nil || !strings.HasPrefix(string(data), "X-Folded: a;\r\n\tb\r\n") {
+		t.Fatalf("unexpected serialization: %v %q", err, data)
+	}
+	if reparsed := EmailParserNew(EmailParserOptions{EmailData: data}); len(reparsed.GetTopMIMENode().Header) != len(top.Header) {
+		t.Fatalf("header count changed after reparse")
+	}
+}
+
+func TestImapBodyStructure(t *testing.T) {
+	emailData := "From: \"Alice\" <alice@example.com>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: =?UTF-8?B?5rWL6K+V?=\r\n" +
+		"Message-ID: <1@example.com>\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"hello\r\n" +
+		"world\r\n" +
+		"--b1\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"Content-Disposition: attachment\r\n" +
+		"\r\n" +
+		"From: c@example.com\r\n" +
+		"Subject: in\r\n" +
+		"\r\n" +
+		"inner\r\n" +
+		"--b1--\r\n"
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+
+	alice := `(("Alice" NIL "alice" "example.com"))`
+	envelope := `(NIL "=?UTF-8?B?5rWL6K+V?=" ` + alice + " " + alice + " " + alice +
+		` ((NIL NIL "bob" "example.com")) NIL NIL NIL "<1@example.com>")`
+	if got := parser.GetImapEnvelope(); got != envelope {
+		t.Fatalf("unexpected envelope:\n%s", got)
+	}
+
+	c := `((NIL NIL "c" "example.com"))`
+	innerEnvelope := `(NIL "in" ` + c + " " + c + " " + c + ` NIL NIL NIL NIL NIL)`
+	body := `(("TEXT" "PLAIN" ("CHARSET" "utf-8") NIL NIL "7BIT" 12 2)` +
+		`("MESSAGE" "RFC822" NIL NIL NIL "7BIT" 41 ` + innerEnvelope +
+		` ("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 5 1) 4) "MIXED")`
+	if got := parser.GetImapBody(); got != body {
+		t.Fatalf("unexpected body:\n%s", got)
+	}
+
+	bodyStructure := `(("TEXT" "PLAIN" ("CHARSET" "utf-8") NIL NIL "7BIT" 12 2 NIL NIL NIL NIL)` +
+		`("MESSAGE" "RFC822" NIL NIL NIL "7BIT" 41 ` + innerEnvelope +
+		` ("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 5 1 NIL NIL NIL NIL) 4 NIL ("ATTACHMENT" NIL) NIL NIL)` +
+		` "MIXED" ("BOUNDARY" "b1") NIL NIL NIL)`
+	if got := parser.GetImapBodyStructure(); got != bodyStructure {
+		t.Fatalf("unexpected bodystructure:\n%s", got)
+	}
+}
+
+func TestImapSection(t *testing.T) {
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(testNestedEmail)})
+	cases := map[string]string{
+		"1.1":                        "hello plain",
+		"1.2.MIME":                   "Content-Type: text/html; charset=utf-8\r\n\r\n",
+		"2":                          "aGVsbG8gd29y\r\nbGQ=",
+		"HEADER.FIELDS (TO subject)": "To: bob@example.com\r\nSubject: =?UTF-8?B?5rWL6K+V?=\r\n\r\n",
+		"HEADER.FIELDS.NOT (FROM TO SUBJECT CONTENT-TYPE)": "Date: Mon, 2 Jan 2006 15:04:05 +0800\r\n\r\n",
+		"": testNestedEmail,
+	}
+	for section, expected := range cases {
+		data, err := parser.GetImapSection(section)
+		if err != nil || string(data) != expected {
+			t.Fatalf("section %q: got %q, %v", section, data, err)
+		}
+	}
+	if data, err := parser.GetImapBinary("2"); err != nil || string(data) != "hello world" {
+		t.Fatalf("unexpected binary: %q, %v", data, err)
+	}
+	qp := EmailParserNew(EmailParserOptions{EmailData: []byte("Content-Type: text/plain\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\ncaf=C3=A9 soft=\r\nbreak=3d\r\n")})
+	if data, err := qp.GetImapBinary("1"); err != nil || string(data) != "café softbreak=\r\n" {
+		t.Fatalf("unexpected quoted-printable binary: %q, %v", data, err)
+	}
+	for cte, body := range map[string]string{"base64": "aGVsbG8g!!!!", "quoted-printable": "caf=C3=A9 =ZZ"} {
+		corrupt := EmailParserNew(EmailParserOptions{EmailData: []byte("Content-Type: text/plain\r\n" +
+			"Content-Transfer-Encoding: " + cte + "\r\n\r\n" + body + "\r\n")})
+		if data, err := corrupt.GetImapBinary("1"); !errors.Is(err, ErrImapCorruptContent) {
+			t.Fatalf("%s: expected ErrImapCorruptContent, got %q, %v", cte, data, err)
+		}
+	}
+	if data := ImapPartial([]byte("hello world"), 6, 3); string(data) != "wor" {
+		t.Fatalf("unexpected partial: %q", data)
+	}
+	if data := ImapPartial([]byte("hello world"), -3, 5); string(data) != "hello" {
+		t.Fatalf("unexpected partial for negative offset: %q", data)
+	}
+	if data := ImapPartial([]byte("hello world"), 20, 5); len(data) != 0 {
+		t.Fatalf("unexpected partial past end: %q", data)
+	}
+	for _, section := range []string{"3", "1.1.1", "MIME", "1.", "2.HEADER", "HEADER.FIELDS ()"} {
+		if _, err := parser.GetImapSection(section); err == nil {
+			t.Fatalf("section %q: expected error", section)
+		}
+	}
+
+	emailData := "Subject: outer\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"Subject: inner\r\n" +
+		"\r\n" +
+		"inner body\r\n" +
+		"--b1--\r\n"
+	parser = EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	cases = map[string]string{
+		"1":        "Subject: inner\r\n\r\ninner body",
+		"1.HEADER": "Subject: inner\r\n\r\n",
+		"1.TEXT":   "inner body",
+		"1.1":      "inner body",
+		"TEXT":     strings.SplitN(emailData, "\r\n\r\n", 2)[1],
+	}
+	for section, expected := range cases {
+		data, err := parser.GetImapSection(section)
+		if err != nil || string(data) != expected {
+			t.Fatalf("section %q: got %q, %v", section, data, err)
+		}
+	}
+}
+
+func TestEmailJSON(t *testing.T) {
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(testNestedEmail)})
+	data, err := json.Marshal(parser)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var result EmailJSON
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if result.Subject != "测试" || result.From == nil || result.From.Email != "alice@example.com" || len(result.To) != 1 {
+		t.Fatalf("unexpected headers: %s", data)
+	}
+	if len(result.Headers) != 5 || result.Headers[4].Name != "Content-Type" {
+		t.Fatalf("unexpected header list: %+v", result.Headers)
+	}
+	root := result.Root
+	if root.PartID != "" || root.ContentType != "multipart/mixed" || len(root.Childs) != 2 ||
+		root.Childs[0].Childs[1].PartID != "1.2" || !root.Childs[1].IsAttachment || root.Childs[1].Filename != "a.bin" {
+		t.Fatalf("unexpected tree: %s", data)
+	}
+	if len(result.Texts) != 1 || result.Texts[0].PartID != "1.2" || result.Texts[0].Content != "<b>hello</b>" {
+		t.Fatalf("unexpected texts: %+v", result.Texts)
+	}
+	if len(result.Attachments) != 1 || result.Attachments[0] != "2" {
+		t.Fatalf("unexpected attachments: %+v", result.Attachments)
+	}
+}
+
+func TestJmapEmail(t *testing.T) {
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(testNestedEmail)})
+	email := parser.GetJmapEmail(JmapEmailOptions{FetchTextBodyValues: true, MaxBodyValueBytes: 5})
+	if email.Subject == nil || *email.Subject != "测试" || email.SentAt == nil || *email.SentAt != "2006-01-02T15:04:05+08:00" {
+		t.Fatalf("unexpected subject or sentAt")
+	}
+	if len(email.From) != 1 || *email.From[0].Name != "Alice" || email.Cc != nil {
+		t.Fatalf("unexpected addresses")
+	}
+	if len(email.TextBody) != 1 || *email.TextBody[0].PartID != "1.1" ||
+		len(email.HTMLBody) != 1 || *email.HTMLBody[0].PartID != "1.2" {
+		t.Fatalf("unexpected text/html body")
+	}
+	if len(email.Attachments) != 1 || *email.Attachments[0].PartID != "2" || email.Attachments[0].Size != 11 || !email.HasAttachment {
+		t.Fatalf("unexpected attachments")
+	}
+	if value := email.BodyValues["1.1"]; value == nil || value.Value != "hello" || !value.IsTruncated {
+		t.Fatalf("unexpected body values: %+v", email.BodyValues)
+	}
+	if email.Preview != "hello plain" || email.BodyStructure.PartID != nil || email.BodyStructure.Headers[2].Value != " =?UTF-8?B?5rWL6K+V?=" {
+		t.Fatalf("unexpected preview or structure: %q", email.Preview)
+	}
+}
+
+func TestAuthenticationResults(t *testing.T) {
+	emailData := "Authentication-Results: mx.example.net 1;\r\n" +
+		" spf=pass (sender IP is 192.0.2.1; \"good\") smtp.mailfrom=alice@example.com;\r\n" +
+		" dkim=fail reason=\"signature verification failed; bad\" header.d=example.com header.i=@example.com;\r\n" +
+		" dmarc=PASS (p=none dis=none) header.from=example.com; auth/1=pass smtp.auth=alice\r\n" +
+		"Authentication-Results: \"mx (2)\"; none\r\n" +
+		"Authentication-Results: broken; spf\r\n" +
+		"Subject: test\r\n" +
+		"\r\n" +
+		"body\r\n"
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	all := parser.GetAuthenticationResults()
+	if len(all) != 2 || all[0].AuthServID != "mx.example.net" || all[0].Version != 1 || len(all[0].Results) != 4 {
+		t.Fatalf("unexpected results: %+v", all)
+	}
+	spf, dkim, dmarc, auth := all[0].Results[0], all[0].Results[1], all[0].Results[2], all[0].Results[3]
+	if spf.Method != "spf" || spf.Result != "pass" || spf.Properties["smtp.mailfrom"] != "alice@example.com" {
+		t.Fatalf("unexpected spf result: %+v", spf)
+	}
+	if dkim.Result != "fail" || dkim.Reason != "signature verification failed; bad" ||
+		dkim.Properties["header.d"] != "example.com" || dkim.Properties["header.i"] != "@example.com" {
+		t.Fatalf("unexpected dkim result: %+v", dkim)
+	}
+	if dmarc.Result != "pass" || dmarc.Properties["header.from"] != "example.com" || len(dmarc.Properties) != 1 {
+		t.Fatalf("unexpected dmarc result: %+v", dmarc)
+	}
+	if auth.Method != "auth" || auth.Version != 1 || auth.Properties["smtp.auth"] != "alice" {
+		t.Fatalf("unexpected auth result: %+v", auth)
+	}
+	if len(all[0].GetResults("DKIM")) != 1 || all[1].AuthServID != "mx (2)" || len(all[1].Results) != 0 {
+		t.Fatalf("unexpected results: %+v", all[1])
+	}
+}
+
+func TestReceivedHops(t *testing.T) {
+	emailData := "Received: from mx.example.net (mx.example.net [IPv6:2001:db8::1])\r\n" +
+		"\tby mail.example.org (Postfix) with ESMTPS id 4ABC123\r\n" +
+		"\tfor <bob@example.org>; Mon, 02 Jan 2006 15:05:35 +0800 (CST)\r\n" +
+		"Received: from [192.0.2.10] (helo=laptop)\r\n" +
+		"\tby mx.example.net with esmtpa (Exim 4.96)\r\n" +
+		"\tid 1abc-000 (envelope-from <alice@example.net>); Mon, 02 Jan 2006 15:04:05 +0800\r\n" +
+		"Received: by localhost via HTTP; garbage\r\n" +
+		"Subject: test\r\n" +
+		"\r\n" +
+		"body\r\n"
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	hops := parser.GetReceivedHops()
+	if len(hops) != 3 || hops[0].ByHost != "localhost" || hops[0].Via != "HTTP" || hops[0].DateUnix != 0 {
+		t.Fatalf("unexpected hops: %+v", hops)
+	}
+	if hop := hops[1]; hop.FromHost != "[192.0.2.10]" || hop.FromIP != "192.0.2.10" || hop.ByHost != "mx.example.net" ||
+		hop.With != "esmtpa" || hop.ID != "1abc-000" || hop.Date != "Mon, 02 Jan 2006 15:04:05 +0800" || hop.Delay != 0 {
+		t.Fatalf("unexpected hop: %+v", hop)
+	}
+	if hop := hops[2]; hop.FromHost != "mx.example.net" || hop.FromRDNS != "mx.example.net" || hop.FromIP != "2001:db8::1" ||
+		hop.ByHost != "mail.example.org" || hop.With != "ESMTPS" || hop.ID != "4ABC123" || hop.For != "bob@example.org" ||
+		hop.DateUnix != hops[1].DateUnix+90 || hop.Delay != 90 {
+		t.Fatalf("unexpected hop: %+v", hop)
+	}
+}
+
+func TestDeliveryStatus(t *testing.T) {
+	emailData := "From: MAILER-DAEMON@mx.example.org\r\n" +
+		"To: alice@example.net\r\n" +
+		"Subject: Undelivered Mail Returned to Sender\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=\"BB\"\r\n" +
+		"\r\n" +
+		"--BB\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"I'm sorry to have to inform you that your message could not be delivered.\r\n" +
+		"--BB\r\n" +
+		"Content-Type: message/delivery-status\r\n" +
+		"\r\n" +
+		"Reporting-MTA: dns; mx.example.org\r\n" +
+		"Arrival-Date: Mon, 02 Jan 2006 15:04:05 +0800\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; bob@example.org\r\n" +
+		"Original-Recipient: rfc822;Bob@example.org\r\n" +
+		"Action: Failed\r\n" +
+		"Status: 5.1.1 (bad destination mailbox address)\r\n" +
+		"Remote-MTA: dns; mail.example.org\r\n" +
+		"Diagnostic-Code: smtp; 550 5.1.1 <bob@example.org>:\r\n" +
+		"    Recipient address rejected: User unknown\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; carol@example.org\r\n" +
+		"Action: delayed\r\n" +
+		"Status: 4.4.1\r\n" +
+		"\r\n" +
+		"--BB\r\n" +
+		"Content-Type: text/rfc822-headers\r\n" +
+		"\r\n" +
+		"From: alice@example.net\r\n" +
+		"Message-ID: <orig@example.net>\r\n" +
+		"Subject: hello\r\n" +
+		"\r\n" +
+		"--BB--\r\n"
+	parser := EmailParserNew(EmailParserOptions{EmailData: []byte(emailData)})
+	ds := parser.GetDeliveryStatus()
+	if ds == nil {
+		t.Fatal("delivery status not found")
+	}
+	if ds.ReportingMTA != "mx.example.org" || ds.ArrivalDateUnix == 0 || len(ds.Recipients) != 2 ||
+		!strings.HasPrefix(ds.Description, "I'm sorry") {
+		t.Fatalf("unexpected delivery status: %+v", ds)
+	}
+	if r := ds.Recipients[0]; r.FinalRecipient != "bob@example.org" || r.FinalRecipientType != "rfc822" ||
+		r.OriginalRecipient != "Bob@example.org" || r.Action != "failed" || r.Status != "5.1.1" ||
+		r.RemoteMTA != "mail.example.org" || r.DiagnosticCodeType != "smtp" ||
+		r.DiagnosticCode != "550 5.1.1 <bob@example.org>:    Recipient address rejected: User unknown" || !r.IsPermanentFailure() {
+		t.Fatalf("unexpected recipient: %+v", r)
+	}
+	if r := ds.Recipients[1]; r.FinalRecipient != "carol@example.org" || r.Action != "delayed" || r.IsPermanentFailure() {
+		t.Fatalf("unexpected recipient: %+v", r)
+	}
+	if ds.OriginalMessage == nil || ds.OriginalMessage.MessageID != "orig@example.net" || ds.OriginalMessage.Subject != "hello" {
+		t.Fatalf("unexpected original message: %+v", ds.OriginalMessage)
+	}
+
+	plain := EmailParserNew(EmailParserOptions{EmailData: []byte("Subject: hi\r\n\r\nbody\r\n")})
+	if plain.GetDeliveryStatus() != nil {
+		t.Fatal("unexpected delivery status")
+	}
+}
@@ -0,0 +1,314 @@
+// Package maildir 读写 Maildir 邮箱（cur/new/tmp），解析并修改文件名中的标记
+package maildir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+const (
+	SubdirCur = "cur"
+	SubdirNew = "new"
+	SubdirTmp = "tmp"
+)
+
+var ErrInvalidSubdir = errors.New("invalid maildir subdir")
+
+// MaildirFlags 标记集合，支持 A-Z 和 a-z（小写字母通常用作关键字）
+type MaildirFlags uint64
+
+// 标准标记，见 https://cr.yp.to/proto/maildir.html
+const (
+	FlagDraft   = MaildirFlags(1) << ('D' - 'A') // 草稿
+	FlagFlagged = MaildirFlags(1) << ('F' - 'A') // 星标
+	FlagPassed  = MaildirFlags(1) << ('P' - 'A') // 已转发
+	FlagReplied = MaildirFlags(1) << ('R' - 'A') // 已回复
+	FlagSeen    = MaildirFlags(1) << ('S' - 'A') // 已读
+	FlagTrashed = MaildirFlags(1) << ('T' - 'A') // 已删除
+)
+
+func maildirFlagBit(c byte) MaildirFlags {
+	switch {
+	case c >= 'A' && c <= 'Z':
+		return MaildirFlags(1) << (c - 'A')
+	case c >= 'a' && c <= 'z':
+		return MaildirFlags(1) << (c - 'a' + 26)
+	}
+	return 0
+}
+
+// ParseMaildirFlags 解析标记字符串（如 "FRS"），忽略非字母字符
+func ParseMaildirFlags(s string) MaildirFlags {
+	var flags MaildirFlags
+	for i := 0; i < len(s); i++ {
+		flags |= maildirFlagBit(s[i])
+	}
+	return flags
+}
+
+// Has 是否包含全部指定标记
+func (f MaildirFlags) Has(flags MaildirFlags) bool {
+	return f&flags == flags
+}
+
+// String 按 ASCII 顺序输出标记字符串
+func (f MaildirFlags) String() string {
+	var sb strings.Builder
+	for c := byte('A'); c <= 'Z'; c++ {
+		if f&maildirFlagBit(c) != 0 {
+			sb.WriteByte(c)
+		}
+	}
+	for c := byte('a'); c <= 'z'; c++ {
+		if f&maildirFlagBit(c) != 0 {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+type MaildirOptions struct {
+	Path   string // Maildir 根目录
+	Create bool   // 目录不存在时创建 cur/new/tmp
+}
+
+// Maildir 表示一个 Maildir 目录
+type Maildir struct {
+	Path string
+}
+
+// MaildirNew 打开 Maildir
+func MaildirNew(options MaildirOptions) (*Maildir, error) {
+	for _, subdir := range []string{SubdirCur, SubdirNew, SubdirTmp} {
+		dir := filepath.Join(options.Path, subdir)
+		if options.Create {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if st, err := os.Stat(dir); err != nil {
+			return nil, err
+		} else if !st.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	return &Maildir{Path: options.Path}, nil
+}
+
+// MaildirMessage Maildir 中的一封邮件，邮件内容在调用 GetEmailParser 时才读取
+type MaildirMessage struct {
+	Maildir  *Maildir
+	Subdir   string       // 所在子目录（cur/new/tmp）
+	Filename string       // 文件名
+	Key      string       // 唯一名（文件名中 ":" 之前的部分）
+	Flags    MaildirFlags // 标记（文件名中 ":2," 之后的部分）
+	Size     int64        // 邮件大小，优先取文件名中的 S=，否则为 -1
+	parser   *emailparser.EmailParser
+}
+
+// parseMaildirFilename 解析文件名，返回唯一名、标记和大小
+func parseMaildirFilename(filename string) (string, MaildirFlags, int64) {
+	key := filename
+	var flags MaildirFlags
+	if idx := strings.LastIndexByte(filename, ':'); idx >= 0 {
+		key = filename[:idx]
+		if info := filename[idx+1:]; strings.HasPrefix(info, "2,") {
+			flags = ParseMaildirFlags(info[2:])
+		}
+	}
+	size := int64(-1)
+	for _, field := range strings.Split(key, ",")[1:] {
+		if value, ok := strings.CutPrefix(field, "S="); ok {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				size = n
+			}
+		}
+	}
+	return key, flags, size
+}
+
+func newMaildirMessage(d *Maildir, subdir string, filename string) *MaildirMessage {
+	key, flags, size := parseMaildirFilename(filename)
+	return &MaildirMessage{
+		Maildir:  d,
+		Subdir:   subdir,
+		Filename: filename,
+		Key:      key,
+		Flags:    flags,
+		Size:     size,
+	}
+}
+
+// List 列出子目录中的邮件，subdir 为空时列出 new 和 cur，结果按文件名排序
+func (d *Maildir) List(subdir string) ([]*MaildirMessage, error) {
+	subdirs := []string{subdir}
+	if subdir == "" {
+		subdirs = []string{SubdirNew, SubdirCur}
+	} else if subdir != SubdirCur && subdir != SubdirNew && subdir != SubdirTmp {
+		return nil, ErrInvalidSubdir
+	}
+	var messages []*MaildirMessage
+	for _, subdir := range subdirs {
+		entries, err := os.ReadDir(filepath.Join(d.Path, subdir))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			messages = append(messages, newMaildirMessage(d, subdir, entry.Name()))
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Filename < messages[j].Filename
+	})
+	return messages, nil
+}
+
+var maildirDeliveryCounter atomic.Uint64
+
+// newMaildirKey 生成唯一名：<秒>.M<微秒>P<进程号>Q<序号>.<主机名>
+func newMaildirKey() string {
+	now := time.Now()
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	hostname = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(hostname)
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(),
+		maildirDeliveryCounter.Add(1), hostname)
+}
+
+// linkMaildirFile 把 tmp 中的文件放到目标位置后删除 tmp 中的文件；与 os.Rename 不同，目标已存在时返回错误，不会覆盖已有的邮件
+// 优先使用硬链接，文件系统不支持硬链接时改为以 O_EXCL 创建目标文件并复制内容；
+// 目标文件就绪后邮件即已投递，删除 tmp 中的文件失败不作为错误（残留文件按 Maildir 约定由清理程序删除），避免调用方重试时重复投递
+func linkMaildirFile(tmpPath, newPath string) error {
+	if err := os.Link(tmpPath, newPath); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		if err := copyMaildirFile(tmpPath, newPath); err != nil {
+			return err
+		}
+	}
+	os.Remove(tmpPath)
+	return nil
+}
+
+// copyMaildirFile 以 O_EXCL 创建目标文件并复制内容，目标已存在时返回错误
+func copyMaildirFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+	}
+	return err
+}
+
+// Deliver 投递一封新邮件：先写入 tmp 并同步到磁盘，再链接到 new；new 中已有同名文件时返回错误
+func (d *Maildir) Deliver(r io.Reader) (*MaildirMessage, error) {
+	key := newMaildirKey()
+	tmpPath := filepath.Join(d.Path, SubdirTmp, key)
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	filename := key + ",S=" + strconv.FormatInt(size, 10)
+	if err := linkMaildirFile(tmpPath, filepath.Join(d.Path, SubdirNew, filename)); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	return newMaildirMessage(d, SubdirNew, filename), nil
+}
+
+// GetPath 返回邮件文件的完整路径
+func (m *MaildirMessage) GetPath() string {
+	return filepath.Join(m.Maildir.Path, m.Subdir, m.Filename)
+}
+
+// Open 打开邮件文件
+func (m *MaildirMessage) Open() (*os.File, error) {
+	return os.Open(m.GetPath())
+}
+
+// GetEmailParser 读取并解析邮件，结果会被缓存
+func (m *MaildirMessage) GetEmailParser() (*emailparser.EmailParser, error) {
+	if m.parser != nil {
+		return m.parser, nil
+	}
+	data, err := os.ReadFile(m.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	m.parser = emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: data})
+	return m.parser, nil
+}
+
+// SetFlags 设置标记，邮件会被移动到 cur（文件名为 <唯一名>:2,<标记>）
+func (m *MaildirMessage) SetFlags(flags MaildirFlags) error {
+	filename := m.Key + ":2," + flags.String()
+	if m.Subdir == SubdirCur && filename == m.Filename {
+		return nil
+	}
+	if err := os.Rename(m.GetPath(), filepath.Join(m.Maildir.Path, SubdirCur, filename)); err != nil {
+		return err
+	}
+	m.Subdir = SubdirCur
+	m.Filename = filename
+	m.Flags = flags
+	return nil
+}
+
+// AddFlags 增加标记
+func (m *MaildirMessage) AddFlags(flags MaildirFlags) error {
+	return m.SetFlags(m.Flags | flags)
+}
+
+// RemoveFlags 去除标记
+func (m *MaildirMessage) RemoveFlags(flags MaildirFlags) error {
+	return m.SetFlags(m.Flags &^ flags)
+}
+
+// Remove 删除邮件文件
+func (m *MaildirMessage) Remove() error {
+	return os.Remove(m.GetPath())
+}
@@ -0,0 +1,124 @@
+package maildir
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaildirFlags(t *testing.T) {
+	flags := ParseMaildirFlags("TSRa")
+	if !flags.Has(FlagSeen|FlagReplied|FlagTrashed) || flags.Has(FlagDraft) {
+		t.Fatalf("unexpected flags: %s", flags)
+	}
+	if flags.String() != "RSTa" {
+		t.Fatalf("unexpected flags string: %s", flags)
+	}
+	key, flags, size := parseMaildirFilename("1700000000.M1P2Q3.host,S=42:2,FS")
+	if key != "1700000000.M1P2Q3.host,S=42" || flags != FlagFlagged|FlagSeen || size != 42 {
+		t.Fatalf("unexpected filename parse: %s %s %d", key, flags, size)
+	}
+}
+
+func TestMaildirDeliver(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	if _, err := MaildirNew(MaildirOptions{Path: dir}); err == nil {
+		t.Fatalf("expected error for missing maildir")
+	}
+	d, err := MaildirNew(MaildirOptions{Path: dir, Create: true})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	data := "Subject: hello\r\n\r\nbody\r\n"
+	msg, err := d.Deliver(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("deliver failed: %v", err)
+	}
+	if msg.Subdir != SubdirNew || msg.Size != int64(len(data)) {
+		t.Fatalf("unexpected delivered message: %+v", msg)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, SubdirTmp)); len(entries) != 0 {
+		t.Fatalf("tmp not empty after delivery")
+	}
+
+	messages, err := d.List("")
+	if err != nil || len(messages) != 1 || messages[0].Key != msg.Key {
+		t.Fatalf("unexpected list: %v %v", messages, err)
+	}
+	parser, err := messages[0].GetEmailParser()
+	if err != nil || parser.Subject != "hello" {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if err := messages[0].AddFlags(FlagSeen | FlagReplied); err != nil {
+		t.Fatalf("set flags failed: %v", err)
+	}
+	if err := messages[0].RemoveFlags(FlagReplied); err != nil {
+		t.Fatalf("remove flags failed: %v", err)
+	}
+	cur, err := d.List(SubdirCur)
+	if err != nil || len(cur) != 1 || cur[0].Filename != msg.Key+":2,S" || cur[0].Flags != FlagSeen {
+		t.Fatalf("unexpected cur list: %v %v", cur, err)
+	}
+	if _, err := d.List("other"); err != ErrInvalidSubdir {
+		t.Fatalf("expected ErrInvalidSubdir, got %v", err)
+	}
+}
+
+func TestMaildirLinkExisting(t *testing.T) {
+	dir := t.TempDir()
+	tmpPath := filepath.Join(dir, "tmp-file")
+	newPath := filepath.Join(dir, "new-file")
+	if err := os.WriteFile(tmpPath, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkMaildirFile(tmpPath, newPath); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected ErrExist, got %v", err)
+	}
+	if data, _ := os.ReadFile(newPath); string(data) != "old" {
+		t.Fatalf("existing message replaced: %q", data)
+	}
+
+	os.Remove(newPath)
+	if err := linkMaildirFile(tmpPath, newPath); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Fatalf("tmp file not removed: %v", err)
+	}
+	if data, _ := os.ReadFile(newPath); string(data) != "new" {
+		t.Fatalf("unexpected content: %q", data)
+	}
+}
+
+func TestMaildirCopyFallback(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "tmp-file")
+	dstPath := filepath.Join(dir, "new-file")
+	if err := os.WriteFile(srcPath, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dstPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyMaildirFile(srcPath, dstPath); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected ErrExist, got %v", err)
+	}
+	if data, _ := os.ReadFile(dstPath); string(data) != "old" {
+		t.Fatalf("existing message replaced: %q", data)
+	}
+
+	os.Remove(dstPath)
+	if err := copyMaildirFile(srcPath, dstPath); err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	if data, _ := os.ReadFile(dstPath); string(data) != "new" {
+		t.Fatalf("unexpected content: %q", data)
+	}
+}
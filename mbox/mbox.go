@@ -0,0 +1,387 @@
+// Package mbox 读写 mbox 邮箱文件，支持 mboxo、mboxrd、mboxcl、mboxcl2 四种格式
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MboxFormat mbox 格式
+type MboxFormat int
+
+const (
+	// MboxFormatMboxo 正文中 "From " 开头的行写为 ">From "，读取时去掉一个 '>'（有损）
+	MboxFormatMboxo MboxFormat = iota
+	// MboxFormatMboxrd 正文中 ">*From " 开头的行写入时加一个 '>'，读取时去掉一个 '>'（无损）
+	MboxFormatMboxrd
+	// MboxFormatMboxcl 按 Content-Length 分隔，正文同时按 mboxo 方式转义
+	MboxFormatMboxcl
+	// MboxFormatMboxcl2 按 Content-Length 分隔，正文不转义
+	MboxFormatMboxcl2
+)
+
+var ErrInvalidMbox = errors.New("invalid mbox: missing From line")
+
+// mboxDateLayout "From " 行中的时间格式（asctime）
+const mboxDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// MboxMessage mbox 中的一封邮件
+type MboxMessage struct {
+	FromLine   string // "From " 分隔行（不含换行符）
+	Sender     string // 分隔行中的发件人
+	Date       string // 分隔行中的时间
+	Offset     int64  // 分隔行在文件中的起始偏移
+	DataOffset int64  // 邮件数据在文件中的起始偏移
+	Data       []byte // 邮件数据（已去除转义），可直接用于 emailparser.EmailParserNew
+}
+
+type MboxReaderOptions struct {
+	Reader io.Reader  // mbox 数据
+	Format MboxFormat // mbox 格式
+}
+
+// MboxReader 流式读取 mbox，每次只在内存中保留一封邮件
+type MboxReader struct {
+	format        MboxFormat
+	reader        *bufio.Reader
+	offset        int64
+	started       bool
+	pendingLine   []byte // 已读取的下一封邮件的 "From " 行
+	pendingOffset int64
+}
+
+// MboxReaderNew 创建 mbox 读取器
+func MboxReaderNew(options MboxReaderOptions) *MboxReader {
+	return &MboxReader{
+		format: options.Format,
+		reader: bufio.NewReaderSize(options.Reader, 64*1024),
+	}
+}
+
+func (r *MboxReader) readLine() ([]byte, error) {
+	line, err := r.reader.ReadBytes('\n')
+	r.offset += int64(len(line))
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	return line, err
+}
+
+func isMboxFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+func trimMboxEOL(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+func isMboxBlankLine(line []byte) bool {
+	return len(trimMboxEOL(line)) == 0
+}
+
+// Next 返回下一封邮件，没有更多邮件时返回 io.EOF
+func (r *MboxReader) Next() (*MboxMessage, error) {
+	if !r.started {
+		r.started = true
+		for {
+			line, err := r.readLine()
+			if err != nil {
+				return nil, err
+			}
+			if isMboxBlankLine(line) {
+				continue
+			}
+			if !isMboxFromLine(line) {
+				return nil, ErrInvalidMbox
+			}
+			r.pendingLine = line
+			r.pendingOffset = r.offset - int64(len(line))
+			break
+		}
+	}
+	if r.pendingLine == nil {
+		return nil, io.EOF
+	}
+
+	msg := &MboxMessage{
+		FromLine:   string(trimMboxEOL(r.pendingLine)),
+		Offset:     r.pendingOffset,
+		DataOffset: r.pendingOffset + int64(len(r.pendingLine)),
+	}
+	fields := strings.SplitN(msg.FromLine, " ", 3)
+	if len(fields) > 1 {
+		msg.Sender = fields[1]
+	}
+	if len(fields) > 2 {
+		msg.Date = strings.TrimSpace(fields[2])
+	}
+	r.pendingLine = nil
+
+	var data []byte
+	var err error
+	if r.format == MboxFormatMboxcl || r.format == MboxFormatMboxcl2 {
+		data, err = r.readByContentLength()
+	} else {
+		data, err = r.readByFromLine(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg.Data = unescapeMboxData(data, r.format)
+	return msg, nil
+}
+
+// readByFromLine 读取到下一个 "From " 行为止，并去掉分隔用的空行
+func (r *MboxReader) readByFromLine(data []byte) ([]byte, error) {
+	atLineStart := len(data) == 0 || data[len(data)-1] == '\n'
+	for {
+		line, err := r.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if atLineStart && isMboxFromLine(line) {
+			r.pendingLine = line
+			r.pendingOffset = r.offset - int64(len(line))
+			break
+		}
+		data = append(data, line...)
+		atLineStart = line[len(line)-1] == '\n'
+	}
+	return trimMboxSeparator(data), nil
+}
+
+// readByContentLength 按 Content-Length 读取正文，长度不可信时退回按 "From " 行分隔
+func (r *MboxReader) readByContentLength() ([]byte, error) {
+	var data []byte
+	contentLength := int64(-1)
+	for {
+		line, err := r.readLine()
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isMboxFromLine(line) {
+			r.pendingLine = line
+			r.pendingOffset = r.offset - int64(len(line))
+			return trimMboxSeparator(data), nil
+		}
+		data = append(data, line...)
+		if isMboxBlankLine(line) {
+			break
+		}
+		if name, value, ok := strings.Cut(string(line), ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && n >= 0 {
+				contentLength = n
+			}
+		}
+	}
+	if contentLength < 0 {
+		return r.readByFromLine(data)
+	}
+
+	// Content-Length 不可信，不按其预分配，内存随实际读到的数据增长
+	buf := bytes.NewBuffer(data)
+	n, err := io.CopyN(buf, r.reader, contentLength)
+	r.offset += n
+	data = buf.Bytes()
+	if err == io.EOF {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 正文之后应为 EOF、"From " 行，或空行加 "From " 行
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		return r.readByFromLine(data)
+	}
+	line, err := r.readLine()
+	if err == io.EOF {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isMboxFromLine(line) {
+		r.pendingLine = line
+		r.pendingOffset = r.offset - int64(len(line))
+		return data, nil
+	}
+	if isMboxBlankLine(line) {
+		next, err := r.readLine()
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isMboxFromLine(next) {
+			r.pendingLine = next
+			r.pendingOffset = r.offset - int64(len(next))
+			return data, nil
+		}
+		data = append(data, line...)
+		line = next
+	}
+	data = append(data, line...)
+	return r.readByFromLine(data)
+}
+
+// trimMboxSeparator 去掉邮件末尾用于分隔的空行
+func trimMboxSeparator(data []byte) []byte {
+	if bytes.HasSuffix(data, []byte("\r\n\r\n")) {
+		return data[:len(data)-2]
+	}
+	if bytes.HasSuffix(data, []byte("\n\n")) {
+		return data[:len(data)-1]
+	}
+	return data
+}
+
+// isMboxQuotedFromLine 行是否为 ">From "（mboxo）或 ">*From "（mboxrd）
+func isMboxQuotedFromLine(line []byte, format MboxFormat) bool {
+	if format == MboxFormatMboxrd {
+		if !bytes.HasPrefix(line, []byte(">")) {
+			return false
+		}
+		return isMboxFromLine(bytes.TrimLeft(line, ">"))
+	}
+	return bytes.HasPrefix(line, []byte(">From "))
+}
+
+func unescapeMboxData(data []byte, format MboxFormat) []byte {
+	if format == MboxFormatMboxcl2 || !bytes.Contains(data, []byte(">")) {
+		return data
+	}
+	result := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		if isMboxQuotedFromLine(line, format) {
+			line = line[1:]
+		}
+		result = append(result, line...)
+		data = data[end:]
+	}
+	return result
+}
+
+func escapeMboxData(data []byte, format MboxFormat) []byte {
+	if format == MboxFormatMboxcl2 {
+		return data
+	}
+	var result []byte
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		if isMboxFromLine(line) || (format == MboxFormatMboxrd && isMboxQuotedFromLine(line, format)) {
+			result = append(result, '>')
+		}
+		result = append(result, line...)
+		data = data[end:]
+	}
+	return result
+}
+
+type MboxWriterOptions struct {
+	Writer io.Writer  // 输出
+	Format MboxFormat // mbox 格式
+}
+
+// MboxWriter 向 mbox 追加邮件
+type MboxWriter struct {
+	format MboxFormat
+	writer io.Writer
+}
+
+// MboxWriterNew 创建 mbox 写入器，追加到已有文件时 Writer 应以追加方式打开
+func MboxWriterNew(options MboxWriterOptions) *MboxWriter {
+	return &MboxWriter{
+		format: options.Format,
+		writer: options.Writer,
+	}
+}
+
+// setMboxContentLength 删除已有的 Content-Length 头部，并在头部末尾写入正文长度
+func setMboxContentLength(data []byte) []byte {
+	eol := "\n"
+	if idx := bytes.IndexByte(data, '\n'); idx > 0 && data[idx-1] == '\r' {
+		eol = "\r\n"
+	}
+	var header, body []byte
+	if idx := bytes.Index(data, []byte(eol+eol)); idx >= 0 {
+		header, body = data[:idx+len(eol)], data[idx+2*len(eol):]
+	} else {
+		header = data
+		if len(header) > 0 && header[len(header)-1] != '\n' {
+			header = append(append([]byte(nil), header...), eol...)
+		}
+	}
+
+	var result []byte
+	skipping := false
+	for len(header) > 0 {
+		end := bytes.IndexByte(header, '\n') + 1
+		if end == 0 {
+			end = len(header)
+		}
+		line := header[:end]
+		header = header[end:]
+		if skipping && (line[0] == ' ' || line[0] == '\t') {
+			continue
+		}
+		name, _, _ := strings.Cut(string(line), ":")
+		skipping = strings.EqualFold(strings.TrimSpace(name), "Content-Length")
+		if !skipping {
+			result = append(result, line...)
+		}
+	}
+	result = append(result, "Content-Length: "+strconv.Itoa(len(body))+eol+eol...)
+	return append(result, body...)
+}
+
+// WriteMessage 追加一封邮件，sender 为空时使用 MAILER-DAEMON，date 为零值时使用当前时间
+func (w *MboxWriter) WriteMessage(sender string, date time.Time, data []byte) error {
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+	eol := "\n"
+	if idx := bytes.IndexByte(data, '\n'); idx > 0 && data[idx-1] == '\r' {
+		eol = "\r\n"
+	}
+
+	data = escapeMboxData(data, w.format)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, eol...)
+	}
+	if w.format == MboxFormatMboxcl || w.format == MboxFormatMboxcl2 {
+		data = setMboxContentLength(data)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From " + sender + " " + date.UTC().Format(mboxDateLayout) + eol)
+	buf.Write(data)
+	buf.WriteString(eol)
+	_, err := w.writer.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,94 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMboxMessages = []string{
+	"From: alice@example.com\nSubject: one\n\nFrom here on\n>From quoted\n>>From twice\n",
+	"From: bob@example.com\r\nSubject: two\r\nContent-Length: 999\r\n\r\nbody\r\n\r\n",
+	"Subject: three\n\nthird\n",
+}
+
+var testContentLengthRegexp = regexp.MustCompile(`Content-Length: \d+\r?\n`)
+
+func TestMboxRoundTrip(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, format := range []MboxFormat{MboxFormatMboxo, MboxFormatMboxrd, MboxFormatMboxcl, MboxFormatMboxcl2} {
+		var buf bytes.Buffer
+		w := MboxWriterNew(MboxWriterOptions{Writer: &buf, Format: format})
+		for _, data := range testMboxMessages {
+			if err := w.WriteMessage("sender@example.com", date, []byte(data)); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+		}
+
+		r := MboxReaderNew(MboxReaderOptions{Reader: bytes.NewReader(buf.Bytes()), Format: format})
+		for i, expected := range testMboxMessages {
+			msg, err := r.Next()
+			if err != nil {
+				t.Fatalf("format %d: read %d failed: %v", format, i, err)
+			}
+			if msg.Sender != "sender@example.com" || msg.Date != "Tue Jan  2 03:04:05 2024" {
+				t.Fatalf("format %d: unexpected From line: %q", format, msg.FromLine)
+			}
+			if !bytes.HasPrefix(buf.Bytes()[msg.Offset:], []byte("From sender@example.com ")) {
+				t.Fatalf("format %d: wrong offset %d", format, msg.Offset)
+			}
+			got := string(msg.Data)
+			if format == MboxFormatMboxcl || format == MboxFormatMboxcl2 {
+				// 写入时会重新生成 Content-Length
+				got = testContentLengthRegexp.ReplaceAllString(got, "")
+				expected = testContentLengthRegexp.ReplaceAllString(expected, "")
+			}
+			if format == MboxFormatMboxo || format == MboxFormatMboxcl {
+				// mboxo 读取时无法区分原有的 ">From "
+				expected = strings.Replace(expected, "\n>From quoted", "\nFrom quoted", 1)
+			}
+			if got != expected {
+				t.Fatalf("format %d: message %d mismatch:\n%q\n%q", format, i, got, expected)
+			}
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Fatalf("format %d: expected EOF, got %v", format, err)
+		}
+	}
+}
+
+func TestMboxContentLengthFallback(t *testing.T) {
+	data := "From a Mon Jan  1 00:00:00 2024\n" +
+		"Subject: wrong length\nContent-Length: 3\n\nhello world\n\n" +
+		"From b Mon Jan  1 00:00:00 2024\n" +
+		"Subject: second\n\nsecond body\n"
+	r := MboxReaderNew(MboxReaderOptions{Reader: strings.NewReader(data), Format: MboxFormatMboxcl2})
+	msg, err := r.Next()
+	if err != nil || string(msg.Data) != "Subject: wrong length\nContent-Length: 3\n\nhello world\n" {
+		t.Fatalf("unexpected first message: %q, %v", msg.Data, err)
+	}
+	msg, err = r.Next()
+	if err != nil || msg.Sender != "b" || msg.DataOffset != int64(strings.Index(data, "Subject: second")) {
+		t.Fatalf("unexpected second message: %+v, %v", msg, err)
+	}
+	if _, err := MboxReaderNew(MboxReaderOptions{Reader: strings.NewReader("Subject: x\n")}).Next(); err != ErrInvalidMbox {
+		t.Fatalf("expected ErrInvalidMbox, got %v", err)
+	}
+}
+
+func TestMboxOversizedContentLength(t *testing.T) {
+	// Content-Length 远大于实际数据时不应按其分配内存
+	data := "From a Mon Jan  1 00:00:00 2024\n" +
+		"Subject: huge\nContent-Length: 99999999999999\n\nshort body\n"
+	r := MboxReaderNew(MboxReaderOptions{Reader: strings.NewReader(data), Format: MboxFormatMboxcl2})
+	msg, err := r.Next()
+	if err != nil || string(msg.Data) != "Subject: huge\nContent-Length: 99999999999999\n\nshort body\n" {
+		t.Fatalf("unexpected message: %q, %v", msg.Data, err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
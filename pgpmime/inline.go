@@ -0,0 +1,169 @@
+package pgpmime
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/mailhonor/go-email/emailparser"
+	mailhonorcharsetutils "github.com/mailhonor/go-utils/charset"
+)
+
+// 内联 PGP 块的类型（ASCII armor 的 BEGIN PGP 之后的部分）
+const (
+	InlineMessage       = "MESSAGE"
+	InlineSignedMessage = "SIGNED MESSAGE"
+	InlineSignature     = "SIGNATURE"
+	InlinePublicKey     = "PUBLIC KEY BLOCK"
+	InlinePrivateKey    = "PRIVATE KEY BLOCK"
+)
+
+// InlineBlock 正文中的内联 PGP 块
+type InlineBlock struct {
+	Node      *emailparser.MIMENode // 所在的文本节点，直接调用 FindInlineBlocks 时为nil
+	Type      string                // InlineMessage 等
+	Start     int                   // 在文本中的起始位置（BEGIN 行）；GetInlineBlocks 返回的是节点解码传输编码后的正文（GetDecodedContent）中的位置
+	End       int                   // 在文本中的结束位置（END 行之后）
+	Armor     []byte                // ASCII armor；签名消息时为其中的签名块
+	Hash      []string              // 签名消息的 Hash 头
+	Text      []byte                // 签名消息的明文（已去除 dash-escape，换行为 LF）；GetInlineBlocks 返回的已转换为 UTF-8
+	textLines [][]byte
+}
+
+// SignedContent 返回签名消息用于验证的数据（RFC 4880 7.1）：去除行尾空白，CRLF 换行，最后一行没有换行
+func (b *InlineBlock) SignedContent() []byte {
+	lines := make([][]byte, len(b.textLines))
+	for i, line := range b.textLines {
+		lines[i] = bytes.TrimRight(line, " \t")
+	}
+	return bytes.Join(lines, []byte("\r\n"))
+}
+
+type inlineLine struct {
+	data  []byte // 去除行尾 CR、LF 后的内容
+	start int
+	end   int // 包括换行
+}
+
+func splitInlineLines(text []byte) []inlineLine {
+	var lines []inlineLine
+	for start := 0; start < len(text); {
+		end := bytes.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start + 1
+		}
+		data := bytes.TrimRight(text[start:end], "\r\n")
+		lines = append(lines, inlineLine{data: data, start: start, end: end})
+		start = end
+	}
+	return lines
+}
+
+// armorType 返回 "-----BEGIN PGP xxx-----" 或 "-----END PGP xxx-----" 中的 xxx
+func armorType(line []byte, prefix string) (string, bool) {
+	s := strings.TrimRight(string(line), " \t")
+	if !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s, "-----") || len(s) < len(prefix)+5 {
+		return "", false
+	}
+	return s[len(prefix) : len(s)-5], true
+}
+
+// FindInlineBlocks 查找文本中的内联 PGP 块，没有 END 行的块被忽略
+func FindInlineBlocks(text []byte) []*InlineBlock {
+	var blocks []*InlineBlock
+	lines := splitInlineLines(text)
+	for i := 0; i < len(lines); i++ {
+		typ, ok := armorType(lines[i].data, "-----BEGIN PGP ")
+		if !ok {
+			continue
+		}
+		block := &InlineBlock{Type: typ, Start: lines[i].start}
+		armorStart := i
+		j := i + 1
+		if typ == InlineSignedMessage {
+			for ; j < len(lines) && len(bytes.TrimSpace(lines[j].data)) > 0; j++ {
+				if name, value, found := bytes.Cut(lines[j].data, []byte(":")); found && strings.EqualFold(string(name), "Hash") {
+					for _, hash := range strings.Split(string(value), ",") {
+						block.Hash = append(block.Hash, strings.TrimSpace(hash))
+					}
+				}
+			}
+			j++
+			var textLines [][]byte
+			for ; j < len(lines); j++ {
+				if t, ok := armorType(lines[j].data, "-----BEGIN PGP "); ok && t == InlineSignature {
+					break
+				}
+				line := lines[j].data
+				if bytes.HasPrefix(line, []byte("- ")) {
+					line = line[2:]
+				}
+				textLines = append(textLines, line)
+			}
+			if j >= len(lines) {
+				continue
+			}
+			block.textLines = textLines
+			block.Text = bytes.Join(textLines, []byte("\n"))
+			armorStart = j
+			typ = InlineSignature
+			j++
+		}
+		for ; j < len(lines); j++ {
+			if t, ok := armorType(lines[j].data, "-----END PGP "); ok && t == typ {
+				break
+			}
+		}
+		if j >= len(lines) {
+			continue
+		}
+		block.End = lines[j].end
+		block.Armor = text[lines[armorStart].start:lines[j].end]
+		blocks = append(blocks, block)
+		i = j
+	}
+	return blocks
+}
+
+// GetInlineBlocks 查找邮件所有 text/plain 文本节点中的内联 PGP 块
+// 在原字符集的正文中查找，签名按原始字节验证；只有用于显示的 Text 转换为 UTF-8
+func GetInlineBlocks(parser *emailparser.EmailParser) []*InlineBlock {
+	var blocks []*InlineBlock
+	for _, node := range parser.GetTextNodes() {
+		if node.ContentType != "TEXT/PLAIN" {
+			continue
+		}
+		for _, block := range FindInlineBlocks(node.GetDecodedContent()) {
+			block.Node = node
+			if block.Text != nil {
+				block.Text = []byte(mailhonorcharsetutils.ConvertToUTF8(block.Text, node.Charset, parser.DefaultCharset))
+			}
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// VerifyInline 验证内联签名消息
+func VerifyInline(block *InlineBlock, pgp OpenPGP) (*VerifyResult, error) {
+	if pgp == nil {
+		return nil, ErrNoOpenPGP
+	}
+	if block.Type != InlineSignedMessage {
+		return nil, ErrNotPGPMIME
+	}
+	signer, err := pgp.Verify(block.SignedContent(), block.Armor)
+	return &VerifyResult{Signer: signer, Err: err}, nil
+}
+
+// DecryptInline 解密内联加密消息，返回明文（内联加密的明文通常不是 MIME 实体，不作解析）
+func DecryptInline(block *InlineBlock, pgp OpenPGP) ([]byte, *Signer, error) {
+	if pgp == nil {
+		return nil, nil, ErrNoOpenPGP
+	}
+	if block.Type != InlineMessage {
+		return nil, nil, ErrNotPGPMIME
+	}
+	return pgp.Decrypt(block.Armor)
+}
@@ -0,0 +1,171 @@
+// Package pgpmime 识别 PGP/MIME（RFC 3156）签名和加密结构，以及正文中的内联 PGP 块；
+// 签名验证和解密通过 OpenPGP 接口由调用者实现，解密后的 MIME 实体被解析为 emailparser 的内层邮件
+package pgpmime
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+var (
+	ErrNotPGPMIME   = errors.New("not a PGP/MIME node")
+	ErrInvalidParts = errors.New("invalid PGP/MIME parts")
+	ErrNoOpenPGP    = errors.New("no OpenPGP implementation")
+)
+
+// Signer 签名信息，由 OpenPGP 实现填写
+type Signer struct {
+	KeyID        string
+	Fingerprint  string
+	UserID       string
+	CreationTime time.Time
+}
+
+// OpenPGP 签名验证和解密的实现（如基于 ProtonMail/go-crypto 或 gpg 命令）
+type OpenPGP interface {
+	// Verify 验证分离签名，signed 为规范化后的被签名数据，signature 为二进制或 ASCII armor 格式的签名
+	// 签名无效时返回错误
+	Verify(signed []byte, signature []byte) (*Signer, error)
+	// Decrypt 解密二进制或 ASCII armor 格式的 OpenPGP 消息，消息同时被签名时返回签名者（否则为nil）
+	Decrypt(data []byte) (plaintext []byte, signer *Signer, err error)
+}
+
+// Signed multipart/signed; protocol="application/pgp-signature"
+type Signed struct {
+	Node      *emailparser.MIMENode
+	MicAlg    string // 如 pgp-sha256
+	Content   []byte // 被签名的 MIME 实体（第一个子节点的头部和正文），已规范化为 CRLF
+	Signature []byte // 第二个子节点（application/pgp-signature）的内容
+}
+
+// Encrypted multipart/encrypted; protocol="application/pgp-encrypted"
+type Encrypted struct {
+	Node    *emailparser.MIMENode
+	Control []byte // 第一个子节点（application/pgp-encrypted）的内容，通常为 "Version: 1"
+	Data    []byte // 第二个子节点（application/octet-stream）的内容，即加密的 OpenPGP 消息
+}
+
+// VerifyResult 验证结果
+type VerifyResult struct {
+	Signer *Signer
+	Err    error // 为nil表示签名有效
+}
+
+// DecryptResult 解密结果
+type DecryptResult struct {
+	Content []byte                   // 解密后的 MIME 实体
+	Signer  *Signer                  // 加密同时签名（RFC 3156 6.2）时的签名者
+	Parser  *emailparser.EmailParser // 解密后的内层邮件，与节点的 GetInnerEmailParser 相同
+}
+
+func getProtocol(node *emailparser.MIMENode) string {
+	vp := emailparser.ParseMimeValueParams(node.GetHeaderValueIgnoreNotFound("CONTENT-TYPE"))
+	return strings.ToLower(string(vp.TrimmedParam("PROTOCOL")))
+}
+
+// IsSigned 是否为 PGP/MIME 签名节点
+func IsSigned(node *emailparser.MIMENode) bool {
+	return node.ContentType == "MULTIPART/SIGNED" && getProtocol(node) == "application/pgp-signature"
+}
+
+// IsEncrypted 是否为 PGP/MIME 加密节点
+func IsEncrypted(node *emailparser.MIMENode) bool {
+	return node.ContentType == "MULTIPART/ENCRYPTED" && getProtocol(node) == "application/pgp-encrypted"
+}
+
+// FindNodes 返回邮件中所有 PGP/MIME 签名和加密节点（包括内嵌邮件中的）
+func FindNodes(parser *emailparser.EmailParser) (signed []*emailparser.MIMENode, encrypted []*emailparser.MIMENode) {
+	var walk func(node *emailparser.MIMENode)
+	walk = func(node *emailparser.MIMENode) {
+		if IsSigned(node) {
+			signed = append(signed, node)
+		} else if IsEncrypted(node) {
+			encrypted = append(encrypted, node)
+		}
+		for _, child := range node.Childs {
+			walk(child)
+		}
+		if embedded := node.GetEmbeddedEmailParser(); embedded != nil {
+			walk(embedded.GetTopMIMENode())
+		}
+		if inner := node.GetInnerEmailParser(); inner != nil {
+			walk(inner.GetTopMIMENode())
+		}
+	}
+	walk(parser.GetTopMIMENode())
+	return
+}
+
+// ParseSigned 取出被签名的数据和签名
+// 被签名的数据是第一个子节点从头部开始到正文结束的原始字节，不包括边界前的 CRLF
+func ParseSigned(node *emailparser.MIMENode) (*Signed, error) {
+	if !IsSigned(node) {
+		return nil, ErrNotPGPMIME
+	}
+	if len(node.Childs) != 2 || node.Childs[1].ContentType != "APPLICATION/PGP-SIGNATURE" {
+		return nil, ErrInvalidParts
+	}
+	first := node.Childs[0]
+	data := node.EmailParser.EmailData
+	if first.BodyStart+first.BodyLen > len(data) {
+		return nil, ErrInvalidParts
+	}
+	vp := emailparser.ParseMimeValueParams(node.GetHeaderValueIgnoreNotFound("CONTENT-TYPE"))
+	return &Signed{
+		Node:      node,
+		MicAlg:    strings.ToLower(string(vp.TrimmedParam("MICALG"))),
+		Content:   emailparser.CanonicalizeCRLF(data[first.HeaderStart : first.BodyStart+first.BodyLen]),
+		Signature: node.Childs[1].GetDecodedContent(),
+	}, nil
+}
+
+// ParseEncrypted 取出控制信息和加密数据
+func ParseEncrypted(node *emailparser.MIMENode) (*Encrypted, error) {
+	if !IsEncrypted(node) {
+		return nil, ErrNotPGPMIME
+	}
+	if len(node.Childs) != 2 || node.Childs[0].ContentType != "APPLICATION/PGP-ENCRYPTED" {
+		return nil, ErrInvalidParts
+	}
+	return &Encrypted{
+		Node:    node,
+		Control: node.Childs[0].GetDecodedContent(),
+		Data:    node.Childs[1].GetDecodedContent(),
+	}, nil
+}
+
+// Verify 验证签名节点；签名无效不作为错误返回，而是记录在结果的 Err 中
+func Verify(node *emailparser.MIMENode, pgp OpenPGP) (*VerifyResult, error) {
+	if pgp == nil {
+		return nil, ErrNoOpenPGP
+	}
+	signed, err := ParseSigned(node)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := pgp.Verify(signed.Content, signed.Signature)
+	return &VerifyResult{Signer: signer, Err: err}, nil
+}
+
+// Decrypt 解密加密节点，并将解密后的 MIME 实体解析为节点的内层邮件
+func Decrypt(node *emailparser.MIMENode, pgp OpenPGP) (*DecryptResult, error) {
+	if pgp == nil {
+		return nil, ErrNoOpenPGP
+	}
+	encrypted, err := ParseEncrypted(node)
+	if err != nil {
+		return nil, err
+	}
+	content, signer, err := pgp.Decrypt(encrypted.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptResult{
+		Content: content,
+		Signer:  signer,
+		Parser:  node.NewInnerEmailParser(content),
+	}, nil
+}
@@ -0,0 +1,171 @@
+package pgpmime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mailhonor/go-email/emailparser"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// fakeOpenPGP 签名为被签名数据 SHA-256 的十六进制，加密为 base64
+type fakeOpenPGP struct{}
+
+func (fakeOpenPGP) Verify(signed []byte, signature []byte) (*Signer, error) {
+	sum := sha256.Sum256(signed)
+	if !bytes.Contains(signature, []byte(hex.EncodeToString(sum[:]))) {
+		return nil, errors.New("bad signature")
+	}
+	return &Signer{KeyID: "0123456789ABCDEF", UserID: "alice@example.com"}, nil
+}
+
+func (fakeOpenPGP) Decrypt(data []byte) ([]byte, *Signer, error) {
+	plaintext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	return plaintext, nil, err
+}
+
+func parseTestEmail(data string) *emailparser.EmailParser {
+	return emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte(data)})
+}
+
+func fakeSign(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSigned(t *testing.T) {
+	inner := "Content-Type: text/plain\r\n\r\nhello\r\n"
+	email := "Content-Type: multipart/signed; micalg=pgp-sha256; protocol=\"application/pgp-signature\"; boundary=b1\n" +
+		"\n" +
+		"--b1\n" + strings.ReplaceAll(inner, "\r\n", "\n") +
+		"\n--b1\n" +
+		"Content-Type: application/pgp-signature\n" +
+		"\n" +
+		"-----BEGIN PGP SIGNATURE-----\n" + fakeSign(inner) + "\n-----END PGP SIGNATURE-----\n" +
+		"--b1--\n"
+	parser := parseTestEmail(email)
+	signedNodes, encryptedNodes := FindNodes(parser)
+	if len(signedNodes) != 1 || len(encryptedNodes) != 0 {
+		t.Fatalf("unexpected nodes: %d %d", len(signedNodes), len(encryptedNodes))
+	}
+	signed, err := ParseSigned(signedNodes[0])
+	if err != nil || string(signed.Content) != inner || signed.MicAlg != "pgp-sha256" {
+		t.Fatalf("unexpected signed content: %q %v", signed.Content, err)
+	}
+	result, err := Verify(signedNodes[0], fakeOpenPGP{})
+	if err != nil || result.Err != nil || result.Signer.UserID != "alice@example.com" {
+		t.Fatalf("signature not verified: %v %+v", err, result)
+	}
+
+	tampered := parseTestEmail(strings.Replace(email, "hello", "hellO", 1))
+	if result, err := Verify(tampered.GetTopMIMENode(), fakeOpenPGP{}); err != nil || result.Err == nil {
+		t.Fatal("tampered content verified")
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	inner := "Content-Type: text/plain\r\n\r\nsecret\r\n"
+	email := "Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=b1\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: application/pgp-encrypted\r\n" +
+		"\r\n" +
+		"Version: 1\r\n" +
+		"--b1\r\n" +
+		"Content-Type: application/octet-stream; name=encrypted.asc\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(inner)) + "\r\n" +
+		"--b1--\r\n"
+	top := parseTestEmail(email).GetTopMIMENode()
+	if !IsEncrypted(top) || IsSigned(top) {
+		t.Fatal("multipart/encrypted not detected")
+	}
+	if _, err := Decrypt(top, nil); err != ErrNoOpenPGP {
+		t.Fatalf("expected ErrNoOpenPGP, got %v", err)
+	}
+	result, err := Decrypt(top, fakeOpenPGP{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.GetInnerEmailParser() != result.Parser || result.Parser.GetTopMIMENode().GetDecodedTextContent() != "secret\r\n" {
+		t.Fatal("decrypted entity not parsed")
+	}
+}
+
+func TestInlineBlocks(t *testing.T) {
+	text := "before\r\n" +
+		"-----BEGIN PGP SIGNED MESSAGE-----\r\n" +
+		"Hash: SHA256\r\n" +
+		"\r\n" +
+		"line one  \r\n" +
+		"- -- dashed\r\n" +
+		"-----BEGIN PGP SIGNATURE-----\r\n" +
+		"\r\n" +
+		fakeSign("line one\r\n-- dashed") + "\r\n" +
+		"-----END PGP SIGNATURE-----\r\n" +
+		"between\r\n" +
+		"-----BEGIN PGP MESSAGE-----\r\n" +
+		"\r\n" +
+		"c2VjcmV0\r\n" +
+		"-----END PGP MESSAGE-----\r\n" +
+		"-----BEGIN PGP MESSAGE-----\r\n" +
+		"unterminated\r\n"
+	email := "Content-Type: text/plain; charset=utf-8\r\n\r\n" + text
+	blocks := GetInlineBlocks(parseTestEmail(email))
+	if len(blocks) != 2 || blocks[0].Type != InlineSignedMessage || blocks[1].Type != InlineMessage {
+		t.Fatalf("unexpected blocks: %+v", blocks)
+	}
+	signed := blocks[0]
+	if string(signed.Text) != "line one  \n-- dashed" || len(signed.Hash) != 1 || signed.Hash[0] != "SHA256" ||
+		!strings.HasPrefix(text[signed.Start:], "-----BEGIN PGP SIGNED MESSAGE") ||
+		!bytes.HasPrefix(signed.Armor, []byte("-----BEGIN PGP SIGNATURE")) {
+		t.Fatalf("unexpected signed block: %+v", signed)
+	}
+	if result, err := VerifyInline(signed, fakeOpenPGP{}); err != nil || result.Err != nil {
+		t.Fatalf("inline signature not verified: %v %+v", err, result)
+	}
+	if text[blocks[1].Start:blocks[1].End] != string(blocks[1].Armor) {
+		t.Fatal("unexpected message block range")
+	}
+}
+
+func TestInlineBlocksCharset(t *testing.T) {
+	for _, c := range []struct {
+		charset string
+		encoder *encoding.Encoder
+		plain   string
+	}{
+		{"gbk", simplifiedchinese.GBK.NewEncoder(), "你好，世界"},
+		{"iso-8859-1", charmap.ISO8859_1.NewEncoder(), "Grüße, café"},
+	} {
+		signedText, err := c.encoder.String(c.plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := "-----BEGIN PGP SIGNED MESSAGE-----\r\n" +
+			"Hash: SHA256\r\n" +
+			"\r\n" +
+			signedText + "\r\n" +
+			"-----BEGIN PGP SIGNATURE-----\r\n" +
+			"\r\n" +
+			fakeSign(signedText) + "\r\n" +
+			"-----END PGP SIGNATURE-----\r\n"
+		email := "Content-Type: text/plain; charset=" + c.charset + "\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" + base64.StdEncoding.EncodeToString([]byte(body)) + "\r\n"
+		blocks := GetInlineBlocks(parseTestEmail(email))
+		if len(blocks) != 1 || string(blocks[0].Text) != c.plain {
+			t.Fatalf("%s: unexpected blocks: %+v", c.charset, blocks)
+		}
+		if result, err := VerifyInline(blocks[0], fakeOpenPGP{}); err != nil || result.Err != nil {
+			t.Fatalf("%s: inline signature not verified: %v %+v", c.charset, err, result)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// CMS（RFC 5652）中 S/MIME 用到的结构，只实现 SignedData 和 EnvelopedData（KeyTransRecipientInfo）
+
+var (
+	oidData                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidDigestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidEncryptionRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidEncryptionRSAOAEP = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+
+	oidCipherAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidCipherAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidCipherAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidCipherDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+var digestAlgorithms = map[string]crypto.Hash{
+	oidDigestSHA1.String():   crypto.SHA1,
+	oidDigestSHA256.String(): crypto.SHA256,
+	oidDigestSHA384.String(): crypto.SHA384,
+	oidDigestSHA512.String(): crypto.SHA512,
+}
+
+// 带 explicit 标签的 asn1.RawValue 字段保存的是 [0] 外层元素，内层元素的编码在 Bytes 中
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type rsaOAEPParameters struct {
+	HashFunc pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+}
+
+var (
+	errInvalidBER = errors.New("invalid BER encoding")
+	errBERTooDeep = errors.New("BER nesting too deep")
+)
+
+// berMaxDepth BER 元素的最大嵌套层数，防止恶意数据耗尽栈空间（PKCS#7 结构实际不超过十几层）
+const berMaxDepth = 64
+
+// berToDER 将 BER（如不定长编码）转换为 encoding/asn1 可以解析的定长编码
+func berToDER(data []byte) ([]byte, error) {
+	out, rest, err := berElementToDER(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errInvalidBER
+	}
+	return out, nil
+}
+
+func encodeASN1Length(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// berElementToDER 转换一个元素，返回转换结果和剩余数据；depth 为当前嵌套层数
+func berElementToDER(data []byte, depth int) ([]byte, []byte, error) {
+	if depth > berMaxDepth {
+		return nil, nil, errBERTooDeep
+	}
+	if len(data) < 2 {
+		return nil, nil, errInvalidBER
+	}
+	tagLen := 1
+	if data[0]&0x1f == 0x1f {
+		for tagLen < len(data) && data[tagLen]&0x80 != 0 {
+			tagLen++
+		}
+		tagLen++
+	}
+	if tagLen >= len(data) {
+		return nil, nil, errInvalidBER
+	}
+	tag := data[:tagLen]
+	constructed := data[0]&0x20 != 0
+	data = data[tagLen:]
+
+	lengthByte := data[0]
+	data = data[1:]
+	if lengthByte == 0x80 {
+		// 不定长：子元素直到 00 00
+		if !constructed {
+			return nil, nil, errInvalidBER
+		}
+		var body []byte
+		for {
+			if len(data) < 2 {
+				return nil, nil, errInvalidBER
+			}
+			if data[0] == 0 && data[1] == 0 {
+				data = data[2:]
+				break
+			}
+			child, rest, err := berElementToDER(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			body = append(body, child...)
+			data = rest
+		}
+		out := append(append([]byte(nil), tag...), encodeASN1Length(len(body))...)
+		return append(out, body...), data, nil
+	}
+
+	length := int(lengthByte)
+	if lengthByte&0x80 != 0 {
+		n := int(lengthByte & 0x7f)
+		if n > 4 || n > len(data) {
+			return nil, nil, errInvalidBER
+		}
+		length = 0
+		for _, b := range data[:n] {
+			length = length<<8 | int(b)
+		}
+		data = data[n:]
+	}
+	if length < 0 || length > len(data) {
+		return nil, nil, errInvalidBER
+	}
+	content, rest := data[:length], data[length:]
+	if constructed {
+		var body []byte
+		for len(content) > 0 {
+			child, more, err := berElementToDER(content, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			body = append(body, child...)
+			content = more
+		}
+		content = body
+	}
+	out := append(append([]byte(nil), tag...), encodeASN1Length(len(content))...)
+	return append(out, content...), rest, nil
+}
+
+// octetStringBytes 返回 OCTET STRING 的内容，BER 中的分段（constructed）OCTET STRING 会被拼接
+func octetStringBytes(raw asn1.RawValue) ([]byte, error) {
+	if !raw.IsCompound {
+		return raw.Bytes, nil
+	}
+	var result []byte
+	rest := raw.Bytes
+	for len(rest) > 0 {
+		var child asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &child); err != nil {
+			return nil, err
+		}
+		data, err := octetStringBytes(child)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data...)
+	}
+	return result, nil
+}
+
+// parseContentInfo 解析 ContentInfo（支持 BER）
+func parseContentInfo(data []byte) (*contentInfo, error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, err
+	}
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after ContentInfo")
+	}
+	return &ci, nil
+}
+
+// parseAttributes 解析 SignedAttributes（[0] IMPLICIT SET OF Attribute）
+func parseAttributes(raw asn1.RawValue) ([]attribute, error) {
+	var attrs []attribute
+	rest := raw.Bytes
+	for len(rest) > 0 {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+// findAttribute 返回属性的第一个值
+func findAttribute(attrs []attribute, oid asn1.ObjectIdentifier) (asn1.RawValue, bool) {
+	for _, attr := range attrs {
+		if attr.Type.Equal(oid) {
+			var value asn1.RawValue
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err == nil {
+				return value, true
+			}
+		}
+	}
+	return asn1.RawValue{}, false
+}
+
+// matchRecipientID 判断 SignerIdentifier / RecipientIdentifier 是否与证书对应
+// IssuerAndSerialNumber 为 SEQUENCE，SubjectKeyIdentifier 为 [0]
+func matchRecipientID(id asn1.RawValue, rawIssuer []byte, serial *big.Int, subjectKeyID []byte) bool {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		return len(subjectKeyID) > 0 && bytes.Equal(id.Bytes, subjectKeyID)
+	}
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil {
+		return false
+	}
+	return ias.SerialNumber != nil && ias.SerialNumber.Cmp(serial) == 0 && bytes.Equal(ias.Issuer.FullBytes, rawIssuer)
+}
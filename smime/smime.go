@@ -0,0 +1,401 @@
+// Package smime 验证 S/MIME 签名（multipart/signed、application/pkcs7-mime signed-data），
+// 解密 application/pkcs7-mime enveloped-data，并将内层 MIME 实体解析为 emailparser 的内层邮件
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+var (
+	ErrNotSMIME             = errors.New("not an S/MIME node")
+	ErrNoContent            = errors.New("signed data has no content")
+	ErrNoSigner             = errors.New("signed data has no signer")
+	ErrSignerNotFound       = errors.New("signer certificate not found")
+	ErrDigestMismatch       = errors.New("message digest mismatch")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	ErrNoRecipient          = errors.New("no matching recipient")
+	ErrInvalidPadding       = errors.New("invalid padding")
+)
+
+// VerifyOptions 验证参数
+type VerifyOptions struct {
+	Roots          *x509.CertPool      // 受信任的根证书，nil 表示使用系统根证书
+	Intermediates  *x509.CertPool      // 额外的中间证书（签名中附带的证书会自动加入）
+	CurrentTime    time.Time           // 验证证书有效期的时间，为零值时取当前时间
+	UseSigningTime bool                // CurrentTime 为零值时改用签名时间；签名时间由签名者填写，仅在信任其时钟时使用
+	KeyUsages      []x509.ExtKeyUsage  // 要求的扩展密钥用途，为空时不限制
+	Certificates   []*x509.Certificate // 签名中未附带签名者证书时，用于查找签名者的证书
+}
+
+// Signer 一个签名者的验证结果
+type Signer struct {
+	Certificate *x509.Certificate     // 签名者证书，找不到时为nil
+	SigningTime time.Time             // 签名属性中的签名时间，没有时为零值
+	Chains      [][]*x509.Certificate // 证书链
+	Err         error                 // 为nil表示签名和证书链均有效
+}
+
+// VerifyResult 验证结果
+type VerifyResult struct {
+	Content []byte                   // 被签名的 MIME 实体
+	Signers []*Signer                // 签名者
+	Parser  *emailparser.EmailParser // 不透明签名（pkcs7-mime）解析出的内层邮件，分离签名时为nil
+}
+
+// Valid 是否至少有一个签名者且全部有效
+func (r *VerifyResult) Valid() bool {
+	if len(r.Signers) == 0 {
+		return false
+	}
+	for _, signer := range r.Signers {
+		if signer.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// getNodeParam 返回 Content-Type 的参数
+func getNodeParam(node *emailparser.MIMENode, name string) string {
+	vp := emailparser.ParseMimeValueParams(node.GetHeaderValueIgnoreNotFound("CONTENT-TYPE"))
+	return strings.ToLower(string(vp.TrimmedParam(name)))
+}
+
+// IsSigned 是否为 S/MIME 签名节点
+func IsSigned(node *emailparser.MIMENode) bool {
+	switch node.ContentType {
+	case "MULTIPART/SIGNED":
+		protocol := getNodeParam(node, "PROTOCOL")
+		return protocol == "application/pkcs7-signature" || protocol == "application/x-pkcs7-signature"
+	case "APPLICATION/PKCS7-MIME", "APPLICATION/X-PKCS7-MIME":
+		return getNodeParam(node, "SMIME-TYPE") == "signed-data"
+	}
+	return false
+}
+
+// IsEncrypted 是否为 S/MIME 加密节点
+func IsEncrypted(node *emailparser.MIMENode) bool {
+	switch node.ContentType {
+	case "APPLICATION/PKCS7-MIME", "APPLICATION/X-PKCS7-MIME":
+		smimeType := getNodeParam(node, "SMIME-TYPE")
+		return smimeType == "enveloped-data" || (smimeType == "" && !strings.EqualFold(node.Filename, "smime.p7s"))
+	}
+	return false
+}
+
+// VerifyNode 验证签名节点；不透明签名时内层 MIME 实体被解析为节点的内层邮件（GetInnerEmailParser）
+func VerifyNode(node *emailparser.MIMENode, options VerifyOptions) (*VerifyResult, error) {
+	if node.ContentType == "MULTIPART/SIGNED" {
+		if len(node.Childs) < 2 {
+			return nil, ErrNotSMIME
+		}
+		signed := node.Childs[0]
+		data := node.EmailParser.EmailData
+		if signed.BodyStart+signed.BodyLen > len(data) {
+			return nil, ErrNoContent
+		}
+		content := data[signed.HeaderStart : signed.BodyStart+signed.BodyLen]
+		return VerifyDetached(content, node.Childs[1].GetDecodedContent(), options)
+	}
+	if node.ContentType != "APPLICATION/PKCS7-MIME" && node.ContentType != "APPLICATION/X-PKCS7-MIME" {
+		return nil, ErrNotSMIME
+	}
+	result, err := VerifyOpaque(node.GetDecodedContent(), options)
+	if err != nil {
+		return nil, err
+	}
+	result.Parser = node.NewInnerEmailParser(result.Content)
+	return result, nil
+}
+
+// VerifyDetached 验证分离签名，content 为被签名的 MIME 实体（头部和正文），signature 为 DER/BER 编码的 SignedData
+func VerifyDetached(content []byte, signature []byte, options VerifyOptions) (*VerifyResult, error) {
+	sd, err := parseSignedData(signature)
+	if err != nil {
+		return nil, err
+	}
+	return verifySignedData(sd, emailparser.CanonicalizeCRLF(content), options)
+}
+
+// VerifyOpaque 验证不透明签名，被签名的内容包含在 SignedData 中
+func VerifyOpaque(data []byte, options VerifyOptions) (*VerifyResult, error) {
+	sd, err := parseSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.EncapContentInfo.EContent.FullBytes) == 0 {
+		return nil, ErrNoContent
+	}
+	var eContent asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &eContent); err != nil {
+		return nil, err
+	}
+	content, err := octetStringBytes(eContent)
+	if err != nil {
+		return nil, err
+	}
+	return verifySignedData(sd, content, options)
+}
+
+func parseSignedData(data []byte) (*signedData, error) {
+	ci, err := parseContentInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %s is not signed data", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	return &sd, nil
+}
+
+func verifySignedData(sd *signedData, content []byte, options VerifyOptions) (*VerifyResult, error) {
+	if len(sd.SignerInfos) == 0 {
+		return nil, ErrNoSigner
+	}
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		parsed, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = parsed
+	}
+	certs = append(certs, options.Certificates...)
+
+	intermediates := x509.NewCertPool()
+	if options.Intermediates != nil {
+		intermediates = options.Intermediates.Clone()
+	}
+	for _, cert := range certs {
+		intermediates.AddCert(cert)
+	}
+
+	result := &VerifyResult{Content: content}
+	for _, si := range sd.SignerInfos {
+		signer := &Signer{}
+		result.Signers = append(result.Signers, signer)
+		for _, cert := range certs {
+			if matchRecipientID(si.SID, cert.RawIssuer, cert.SerialNumber, cert.SubjectKeyId) {
+				signer.Certificate = cert
+				break
+			}
+		}
+		if signer.Certificate == nil {
+			signer.Err = ErrSignerNotFound
+			continue
+		}
+		if signer.Err = verifySignerInfo(&si, signer, content); signer.Err != nil {
+			continue
+		}
+
+		verifyOptions := x509.VerifyOptions{
+			Roots:         options.Roots,
+			Intermediates: intermediates,
+			CurrentTime:   options.CurrentTime,
+			KeyUsages:     options.KeyUsages,
+		}
+		if verifyOptions.CurrentTime.IsZero() && options.UseSigningTime {
+			verifyOptions.CurrentTime = signer.SigningTime
+		}
+		if len(verifyOptions.KeyUsages) == 0 {
+			verifyOptions.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+		}
+		signer.Chains, signer.Err = signer.Certificate.Verify(verifyOptions)
+	}
+	return result, nil
+}
+
+// verifySignerInfo 校验摘要和签名，并取出签名时间
+func verifySignerInfo(si *signerInfo, signer *Signer, content []byte) error {
+	hash, ok := digestAlgorithms[si.DigestAlgorithm.Algorithm.String()]
+	if !ok || !hash.Available() {
+		return ErrUnsupportedAlgorithm
+	}
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+
+	signed := content
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		attrs, err := parseAttributes(si.SignedAttrs)
+		if err != nil {
+			return err
+		}
+		value, ok := findAttribute(attrs, oidAttributeMessageDigest)
+		if !ok || !bytes.Equal(value.Bytes, digest) {
+			return ErrDigestMismatch
+		}
+		if value, ok := findAttribute(attrs, oidAttributeSigningTime); ok {
+			var t time.Time
+			if _, err := asn1.Unmarshal(value.FullBytes, &t); err == nil {
+				signer.SigningTime = t
+			}
+		}
+		// 签名针对 SET OF Attribute 的 DER 编码，而不是 [0] IMPLICIT
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	}
+	return verifySignature(signer.Certificate.PublicKey, hash, signed, si.Signature)
+}
+
+func verifySignature(publicKey crypto.PublicKey, hash crypto.Hash, signed []byte, signature []byte) error {
+	h := hash.New()
+	h.Write(signed)
+	hashed := h.Sum(nil)
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, hash, hashed, signature) != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, hashed, signature) {
+			return ErrInvalidSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, signed, signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+	return nil
+}
+
+// DecryptNode 解密加密节点，并将解密后的 MIME 实体解析为节点的内层邮件
+// cert 为接收者证书，用于选择 RecipientInfo，为nil时逐个尝试
+func DecryptNode(node *emailparser.MIMENode, cert *x509.Certificate, key crypto.PrivateKey) (*emailparser.EmailParser, error) {
+	if node.ContentType != "APPLICATION/PKCS7-MIME" && node.ContentType != "APPLICATION/X-PKCS7-MIME" {
+		return nil, ErrNotSMIME
+	}
+	content, err := Decrypt(node.GetDecodedContent(), cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return node.NewInnerEmailParser(content), nil
+}
+
+// Decrypt 解密 DER/BER 编码的 EnvelopedData，返回解密后的内容
+// 支持 RSA（PKCS#1 v1.5、OAEP）密钥传输和 AES-CBC、3DES-CBC 内容加密
+func Decrypt(data []byte, cert *x509.Certificate, key crypto.PrivateKey) ([]byte, error) {
+	ci, err := parseContentInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, fmt.Errorf("content type %s is not enveloped data", ci.ContentType)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, err
+	}
+	decrypter, ok := key.(crypto.Decrypter)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	lastErr := ErrNoRecipient
+	for _, raw := range ed.RecipientInfos {
+		if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagSequence {
+			// 只支持 KeyTransRecipientInfo
+			continue
+		}
+		var ktri keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(raw.FullBytes, &ktri); err != nil {
+			continue
+		}
+		if cert != nil && !matchRecipientID(ktri.RID, cert.RawIssuer, cert.SerialNumber, cert.SubjectKeyId) {
+			continue
+		}
+		var opts crypto.DecrypterOpts
+		switch {
+		case ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidEncryptionRSA):
+			opts = &rsa.PKCS1v15DecryptOptions{}
+		case ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidEncryptionRSAOAEP):
+			hash := crypto.SHA1
+			var params rsaOAEPParameters
+			if len(ktri.KeyEncryptionAlgorithm.Parameters.FullBytes) > 0 {
+				if _, err := asn1.Unmarshal(ktri.KeyEncryptionAlgorithm.Parameters.FullBytes, &params); err == nil {
+					if h, ok := digestAlgorithms[params.HashFunc.Algorithm.String()]; ok {
+						hash = h
+					}
+				}
+			}
+			opts = &rsa.OAEPOptions{Hash: hash}
+		default:
+			lastErr = ErrUnsupportedAlgorithm
+			continue
+		}
+		cek, err := decrypter.Decrypt(rand.Reader, ktri.EncryptedKey, opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return decryptContent(&ed.EncryptedContentInfo, cek)
+	}
+	return nil, lastErr
+}
+
+// decryptContent 用内容加密密钥解密 EncryptedContentInfo
+func decryptContent(eci *encryptedContentInfo, cek []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+	algorithm := eci.ContentEncryptionAlgorithm.Algorithm
+	switch {
+	case algorithm.Equal(oidCipherAES128CBC), algorithm.Equal(oidCipherAES192CBC), algorithm.Equal(oidCipherAES256CBC):
+		block, err = aes.NewCipher(cek)
+	case algorithm.Equal(oidCipherDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(cek)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("invalid IV length")
+	}
+	ciphertext, err := octetStringBytes(eci.EncryptedContent)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid ciphertext length")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrInvalidPadding
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, ErrInvalidPadding
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
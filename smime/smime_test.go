@@ -0,0 +1,302 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+type testIdentity struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func newTestIdentity(t *testing.T, name string, parent *testIdentity) *testIdentity {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		BasicConstraintsValid: true,
+	}
+	issuer, signer := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{cert: cert, key: key}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	data, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func explicitTag0(data []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data}
+}
+
+func marshalContentInfo(t *testing.T, contentType asn1.ObjectIdentifier, content []byte) []byte {
+	return mustMarshal(t, contentInfo{ContentType: contentType, Content: explicitTag0(content)})
+}
+
+func recipientID(t *testing.T, cert *x509.Certificate) asn1.RawValue {
+	return asn1.RawValue{FullBytes: mustMarshal(t, issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})}
+}
+
+// buildSignedData 生成带签名属性的 SignedData，detached 时不包含内容
+func buildSignedData(t *testing.T, signer *testIdentity, content []byte, detached bool) []byte {
+	return buildSignedDataAt(t, signer, content, detached, time.Now())
+}
+
+// buildSignedDataAt 同 buildSignedData，签名时间为 signingTime
+func buildSignedDataAt(t *testing.T, signer *testIdentity, content []byte, detached bool, signingTime time.Time) []byte {
+	digest := crypto.SHA256.New()
+	digest.Write(content)
+	var attrs []byte
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidAttributeContentType, oidData},
+		{oidAttributeSigningTime, signingTime.UTC()},
+		{oidAttributeMessageDigest, digest.Sum(nil)},
+	} {
+		values := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, attr.value)}
+		attrs = append(attrs, mustMarshal(t, attribute{Type: attr.oid, Values: values})...)
+	}
+	signed := mustMarshal(t, asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	hashed := crypto.SHA256.New()
+	hashed.Write(signed)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signer.key, crypto.SHA256, hashed.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha256 := pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue}
+	encap := encapsulatedContentInfo{EContentType: oidData}
+	if !detached {
+		encap.EContent = explicitTag0(mustMarshal(t, content))
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256},
+		EncapContentInfo: encap,
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signer.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                recipientID(t, signer.cert),
+			DigestAlgorithm:    sha256,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEncryptionRSA, Parameters: asn1.NullRawValue},
+			Signature:          signature,
+		}},
+	}
+	return marshalContentInfo(t, oidSignedData, mustMarshal(t, sd))
+}
+
+// buildEnvelopedData 用 AES-256-CBC 加密内容，RSA-OAEP(SHA-256) 加密内容密钥
+func buildEnvelopedData(t *testing.T, recipient *testIdentity, content []byte) []byte {
+	cek := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	rand.Read(cek)
+	rand.Read(iv)
+	padding := aes.BlockSize - len(content)%aes.BlockSize
+	plaintext := append(append([]byte(nil), content...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	block, _ := aes.NewCipher(cek)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	encryptedKey, err := rsa.EncryptOAEP(crypto.SHA256.New(), rand.Reader, &recipient.key.PublicKey, cek, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oaepParams := rsaOAEPParameters{HashFunc: pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue}}
+	ktri := keyTransRecipientInfo{
+		RID:                    recipientID(t, recipient.cert),
+		KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEncryptionRSAOAEP, Parameters: asn1.RawValue{FullBytes: mustMarshal(t, oaepParams)}},
+		EncryptedKey:           encryptedKey,
+	}
+	ed := envelopedData{
+		RecipientInfos: []asn1.RawValue{{FullBytes: mustMarshal(t, ktri)}},
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidCipherAES256CBC, Parameters: asn1.RawValue{FullBytes: mustMarshal(t, iv)}},
+			EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ciphertext},
+		},
+	}
+	return marshalContentInfo(t, oidEnvelopedData, mustMarshal(t, ed))
+}
+
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var sb strings.Builder
+	for len(encoded) > 76 {
+		sb.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	sb.WriteString(encoded + "\r\n")
+	return sb.String()
+}
+
+func parseTestEmail(data string) *emailparser.EmailParser {
+	return emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte(data)})
+}
+
+const testInnerEntity = "Content-Type: text/plain; charset=utf-8\r\n\r\nsecret hello\r\n"
+
+func TestVerifyDetached(t *testing.T) {
+	ca := newTestIdentity(t, "Test CA", nil)
+	signer := newTestIdentity(t, "alice@example.com", ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// 边界前的 CRLF 属于边界，不在签名内容中；签名针对 CRLF 规范化后的内容，邮件本身使用 LF 也应验证通过
+	signature := buildSignedData(t, signer, []byte(strings.TrimSuffix(testInnerEntity, "\r\n")), true)
+	email := "From: alice@example.com\r\n" +
+		"Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" + testInnerEntity +
+		"--b1\r\n" +
+		"Content-Type: application/pkcs7-signature; name=smime.p7s\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" + wrapBase64(signature) +
+		"--b1--\r\n"
+	for _, data := range []string{email, strings.ReplaceAll(email, "\r\n", "\n")} {
+		top := parseTestEmail(data).GetTopMIMENode()
+		if !IsSigned(top) {
+			t.Fatal("multipart/signed not detected")
+		}
+		result, err := VerifyNode(top, VerifyOptions{Roots: roots})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Valid() || result.Signers[0].Certificate.Subject.CommonName != "alice@example.com" ||
+			result.Signers[0].SigningTime.IsZero() || len(result.Signers[0].Chains) == 0 {
+			t.Fatalf("unexpected result: %+v", result.Signers[0])
+		}
+	}
+
+	// 内容被篡改
+	tampered := strings.Replace(email, "secret hello", "secret hellO", 1)
+	result, err := VerifyNode(parseTestEmail(tampered).GetTopMIMENode(), VerifyOptions{Roots: roots})
+	if err != nil || result.Valid() || result.Signers[0].Err != ErrDigestMismatch {
+		t.Fatalf("tampered content verified: %v %v", err, result.Signers[0].Err)
+	}
+
+	// 不受信任的根证书
+	result, err = VerifyNode(parseTestEmail(email).GetTopMIMENode(), VerifyOptions{Roots: x509.NewCertPool()})
+	if err != nil || result.Valid() || result.Signers[0].Certificate == nil {
+		t.Fatalf("untrusted signer verified: %v", err)
+	}
+
+	// 签名时间早于证书有效期：默认按当前时间验证，UseSigningTime 时按签名时间验证
+	backdated := buildSignedDataAt(t, signer, []byte(testInnerEntity), false, time.Now().Add(-24*time.Hour))
+	opaque := "Content-Type: application/pkcs7-mime; smime-type=signed-data; name=smime.p7m\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" + wrapBase64(backdated)
+	result, err = VerifyNode(parseTestEmail(opaque).GetTopMIMENode(), VerifyOptions{Roots: roots})
+	if err != nil || !result.Valid() {
+		t.Fatalf("backdated signature not verified at current time: %v %v", err, result.Signers[0].Err)
+	}
+	result, err = VerifyNode(parseTestEmail(opaque).GetTopMIMENode(), VerifyOptions{Roots: roots, UseSigningTime: true})
+	if err != nil || result.Valid() {
+		t.Fatalf("backdated signature verified at signing time: %v", err)
+	}
+}
+
+func TestVerifyOpaqueAndDecrypt(t *testing.T) {
+	ca := newTestIdentity(t, "Test CA", nil)
+	alice := newTestIdentity(t, "alice@example.com", ca)
+	bob := newTestIdentity(t, "bob@example.com", ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	signed := buildSignedData(t, alice, []byte(testInnerEntity), false)
+	email := "Content-Type: application/pkcs7-mime; smime-type=signed-data; name=smime.p7m\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" + wrapBase64(signed)
+	top := parseTestEmail(email).GetTopMIMENode()
+	result, err := VerifyNode(top, VerifyOptions{Roots: roots})
+	if err != nil || !result.Valid() {
+		t.Fatalf("opaque signature not verified: %v", err)
+	}
+	if result.Parser == nil || top.GetInnerEmailParser() != result.Parser ||
+		string(result.Parser.GetTopMIMENode().GetDecodedTextContent()) != "secret hello\r\n" {
+		t.Fatal("inner entity not parsed")
+	}
+
+	encrypted := buildEnvelopedData(t, bob, []byte(testInnerEntity))
+	email = "Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" + wrapBase64(encrypted)
+	top = parseTestEmail(email).GetTopMIMENode()
+	if !IsEncrypted(top) || IsSigned(top) {
+		t.Fatal("enveloped-data not detected")
+	}
+	if _, err := DecryptNode(top, alice.cert, alice.key); err != ErrNoRecipient {
+		t.Fatalf("expected ErrNoRecipient, got %v", err)
+	}
+	inner, err := DecryptNode(top, bob.cert, bob.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(inner.GetTopMIMENode().GetDecodedTextContent()) != "secret hello\r\n" || top.GetInnerEmailParser() != inner {
+		t.Fatal("decrypted entity not parsed")
+	}
+}
+
+func TestBERNestingLimit(t *testing.T) {
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x30, 0x80}, depth), bytes.Repeat([]byte{0, 0}, depth)...)
+	}
+	der, err := berToDER(nested(10))
+	if err != nil {
+		t.Fatalf("nested BER rejected: %v", err)
+	}
+	if der[0] != 0x30 || der[1] != 18 {
+		t.Fatalf("unexpected DER: %x", der)
+	}
+	if _, err := berToDER(nested(100000)); err != errBERTooDeep {
+		t.Fatalf("expected errBERTooDeep, got %v", err)
+	}
+	if _, err := VerifyOpaque(nested(100000), VerifyOptions{}); err == nil {
+		t.Fatal("deeply nested signed data accepted")
+	}
+}
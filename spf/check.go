@@ -0,0 +1,360 @@
+package spf
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// checkError 检查中止时的结果（temperror 或 permerror）
+type checkError struct {
+	status Status
+	reason string
+}
+
+func (e *checkError) Error() string {
+	return string(e.status) + ": " + e.reason
+}
+
+// checker 一次检查的状态，DNS 查询计数在 include、redirect 之间共享
+type checker struct {
+	options     *CheckOptions
+	ip          net.IP // IPv4 为 4 字节
+	helo        string
+	sender      string
+	local       string
+	domain      string // 发件地址的域名
+	identity    string
+	lookups     int
+	voidLookups int
+	ptrNames    []string
+	ptrDone     bool
+}
+
+var qualifierStatus = map[byte]Status{
+	'+': StatusPass,
+	'-': StatusFail,
+	'~': StatusSoftFail,
+	'?': StatusNeutral,
+}
+
+// validDomain 判断是否为可检查的域名：至少两个标签，标签非空且不超过 63 个字符，顶级标签不是纯数字
+func validDomain(domain string) bool {
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+	}
+	_, err := strconv.Atoi(labels[len(labels)-1])
+	return err != nil
+}
+
+// countLookup 记录一次引起 DNS 查询的机制或修饰符
+func (c *checker) countLookup() error {
+	c.lookups++
+	if c.lookups > c.options.MaxLookups {
+		return &checkError{StatusPermError, "too many DNS lookups"}
+	}
+	return nil
+}
+
+// lookupError 处理查询错误：不存在的记录计为空查询，返回nil；其它错误为 temperror
+func (c *checker) lookupError(err error, name string) error {
+	if err == ErrNotFound {
+		c.voidLookups++
+		if c.voidLookups > c.options.MaxVoidLookups {
+			return &checkError{StatusPermError, "too many void DNS lookups"}
+		}
+		return nil
+	}
+	return &checkError{StatusTempError, "DNS lookup of " + name + " failed: " + err.Error()}
+}
+
+func (c *checker) network() (string, int) {
+	if len(c.ip) == net.IPv4len {
+		return "ip4", 32
+	}
+	return "ip6", 128
+}
+
+// matchIPs 判断客户端 IP 是否在任一地址的 cidr 范围内
+func (c *checker) matchIPs(ips []net.IP, cidr int) bool {
+	_, bits := c.network()
+	mask := net.CIDRMask(cidr, bits)
+	for _, ip := range ips {
+		if bits == 32 {
+			ip = ip.To4()
+		} else {
+			ip = ip.To16()
+		}
+		if ip != nil && ip.Mask(mask).Equal(c.ip.Mask(mask)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatedNames 返回经过正向确认的 PTR 主机名（RFC 7208 5.5），最多检查 10 个
+func (c *checker) validatedNames() []string {
+	if c.ptrDone {
+		return c.ptrNames
+	}
+	c.ptrDone = true
+	names, err := c.options.Resolver.LookupAddr(c.ip.String())
+	if err != nil {
+		return nil
+	}
+	network, bits := c.network()
+	for i, name := range names {
+		if i >= 10 {
+			break
+		}
+		name = strings.TrimSuffix(name, ".")
+		ips, err := c.options.Resolver.LookupIP(network, name)
+		if err != nil {
+			continue
+		}
+		if c.matchIPs(ips, bits) {
+			c.ptrNames = append(c.ptrNames, name)
+		}
+	}
+	return c.ptrNames
+}
+
+// isSubdomain 判断 name 是否为 domain 或其子域名
+func isSubdomain(name string, domain string) bool {
+	name, domain = strings.ToLower(name), strings.ToLower(domain)
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// macroValues 返回当前域名为 domain 时的宏取值
+func (c *checker) macroValues(domain string) macroValues {
+	return func(letter byte) string {
+		switch letter {
+		case 's':
+			return c.sender
+		case 'l':
+			return c.local
+		case 'o':
+			return c.domain
+		case 'd':
+			return domain
+		case 'i':
+			return ipMacroValue(c.ip)
+		case 'p':
+			names := c.validatedNames()
+			for _, name := range names {
+				if isSubdomain(name, domain) {
+					return name
+				}
+			}
+			if len(names) > 0 {
+				return names[0]
+			}
+			return "unknown"
+		case 'v':
+			if len(c.ip) == net.IPv4len {
+				return "in-addr"
+			}
+			return "ip6"
+		case 'h':
+			return c.helo
+		case 'c':
+			return c.ip.String()
+		case 'r':
+			if c.options.Receiver == "" {
+				return "unknown"
+			}
+			return c.options.Receiver
+		case 't':
+			return strconv.FormatInt(c.options.CurrentTime.Unix(), 10)
+		}
+		return ""
+	}
+}
+
+// expandDomain 展开 domain-spec
+func (c *checker) expandDomain(spec string, domain string) (string, error) {
+	expanded, err := expandMacroString(spec, c.macroValues(domain), false)
+	if err != nil {
+		return "", &checkError{StatusPermError, err.Error()}
+	}
+	return truncateDomain(expanded), nil
+}
+
+// match 判断一个机制是否匹配
+func (c *checker) match(d *Directive, domain string) (bool, error) {
+	target := domain
+	if d.Domain != "" {
+		var err error
+		if target, err = c.expandDomain(d.Domain, domain); err != nil {
+			return false, err
+		}
+	}
+	switch d.Mechanism {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		return d.Network.Contains(c.ip), nil
+	}
+
+	if err := c.countLookup(); err != nil {
+		return false, err
+	}
+	network, _ := c.network()
+	cidr := d.CIDR6
+	if network == "ip4" {
+		cidr = d.CIDR4
+	}
+	switch d.Mechanism {
+	case "include":
+		result := c.checkHost(target)
+		switch result.Status {
+		case StatusPass:
+			return true, nil
+		case StatusTempError:
+			return false, &checkError{StatusTempError, result.Reason}
+		case StatusPermError:
+			return false, &checkError{StatusPermError, result.Reason}
+		case StatusNone:
+			return false, &checkError{StatusPermError, "included domain " + target + " has no SPF record"}
+		}
+		return false, nil
+	case "a":
+		ips, err := c.options.Resolver.LookupIP(network, target)
+		if err != nil {
+			return false, c.lookupError(err, target)
+		}
+		return c.matchIPs(ips, cidr), nil
+	case "mx":
+		hosts, err := c.options.Resolver.LookupMX(target)
+		if err != nil {
+			return false, c.lookupError(err, target)
+		}
+		if len(hosts) > 10 {
+			return false, &checkError{StatusPermError, "too many MX records for " + target}
+		}
+		for _, host := range hosts {
+			ips, err := c.options.Resolver.LookupIP(network, host)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return false, &checkError{StatusTempError, "DNS lookup of " + host + " failed: " + err.Error()}
+			}
+			if c.matchIPs(ips, cidr) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "ptr":
+		for _, name := range c.validatedNames() {
+			if isSubdomain(name, target) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "exists":
+		ips, err := c.options.Resolver.LookupIP("ip4", target)
+		if err != nil {
+			return false, c.lookupError(err, target)
+		}
+		return len(ips) > 0, nil
+	}
+	return false, nil
+}
+
+// explain 取得 exp= 的说明文字，出错时返回空
+func (c *checker) explain(record *Record, domain string) string {
+	if record.Explanation == "" {
+		return ""
+	}
+	target, err := c.expandDomain(record.Explanation, domain)
+	if err != nil || target == "" {
+		return ""
+	}
+	records, err := c.options.Resolver.LookupTXT(target)
+	if err != nil || len(records) != 1 {
+		return ""
+	}
+	text, err := expandMacroString(records[0], c.macroValues(domain), true)
+	if err != nil {
+		return ""
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] < 0x20 || text[i] >= 0x7f {
+			return ""
+		}
+	}
+	return text
+}
+
+// checkHost 即 RFC 7208 4 中的 check_host()
+func (c *checker) checkHost(domain string) *Result {
+	if !validDomain(domain) {
+		return &Result{Status: StatusNone, Reason: "invalid domain " + domain}
+	}
+	txts, err := c.options.Resolver.LookupTXT(domain)
+	if err != nil && err != ErrNotFound {
+		return &Result{Status: StatusTempError, Reason: "DNS lookup of " + domain + " failed: " + err.Error()}
+	}
+	var spfRecords []string
+	for _, txt := range txts {
+		if isSPFRecord(txt) {
+			spfRecords = append(spfRecords, txt)
+		}
+	}
+	switch len(spfRecords) {
+	case 0:
+		return &Result{Status: StatusNone}
+	case 1:
+	default:
+		return &Result{Status: StatusPermError, Reason: "multiple SPF records for " + domain}
+	}
+	record, err := ParseRecord(spfRecords[0])
+	if err != nil {
+		return &Result{Status: StatusPermError, Reason: err.Error()}
+	}
+
+	abort := func(err error) *Result {
+		e := err.(*checkError)
+		return &Result{Status: e.status, Reason: e.reason}
+	}
+	for _, d := range record.Directives {
+		matched, err := c.match(d, domain)
+		if err != nil {
+			return abort(err)
+		}
+		if !matched {
+			continue
+		}
+		result := &Result{Status: qualifierStatus[d.Qualifier], Mechanism: d.Text}
+		if result.Status == StatusFail {
+			result.Explanation = c.explain(record, domain)
+		}
+		return result
+	}
+
+	if record.Redirect != "" {
+		if err := c.countLookup(); err != nil {
+			return abort(err)
+		}
+		target, err := c.expandDomain(record.Redirect, domain)
+		if err != nil {
+			return abort(err)
+		}
+		result := c.checkHost(target)
+		if result.Status == StatusNone {
+			return &Result{Status: StatusPermError, Reason: "redirect domain " + target + " has no SPF record"}
+		}
+		return result
+	}
+	return &Result{Status: StatusNeutral}
+}
@@ -0,0 +1,163 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var errInvalidMacro = errors.New("invalid macro")
+
+// macroValues 返回宏字母（小写）的取值，为nil时只检查语法
+type macroValues func(letter byte) string
+
+// expandMacroString 展开 macro-string（RFC 7208 7），exp 为 true 时允许 c、r、t
+func expandMacroString(s string, values macroValues, exp bool) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", errInvalidMacro
+		}
+		i++
+		switch s[i] {
+		case '%':
+			sb.WriteByte('%')
+			continue
+		case '_':
+			sb.WriteByte(' ')
+			continue
+		case '-':
+			sb.WriteString("%20")
+			continue
+		case '{':
+		default:
+			return "", fmt.Errorf("%w: %q", errInvalidMacro, s)
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 2 {
+			return "", fmt.Errorf("%w: %q", errInvalidMacro, s)
+		}
+		expanded, err := expandMacro(s[i+1:i+end], values, exp)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q", err, s)
+		}
+		sb.WriteString(expanded)
+		i += end
+	}
+	return sb.String(), nil
+}
+
+// expandMacro 展开一个 %{...} 中的内容：letter [digits] ["r"] [delimiters]
+func expandMacro(spec string, values macroValues, exp bool) (string, error) {
+	letter := spec[0]
+	lower := letter | 0x20
+	switch lower {
+	case 's', 'l', 'o', 'd', 'i', 'p', 'v', 'h':
+	case 'c', 'r', 't':
+		if !exp {
+			return "", errInvalidMacro
+		}
+	default:
+		return "", errInvalidMacro
+	}
+	spec = spec[1:]
+	n := 0
+	for n < len(spec) && spec[n] >= '0' && spec[n] <= '9' {
+		n++
+	}
+	keep := 0
+	if n > 0 {
+		var err error
+		if keep, err = strconv.Atoi(spec[:n]); err != nil || keep == 0 {
+			return "", errInvalidMacro
+		}
+	}
+	spec = spec[n:]
+	reverse := false
+	if strings.HasPrefix(spec, "r") || strings.HasPrefix(spec, "R") {
+		reverse = true
+		spec = spec[1:]
+	}
+	delimiters := spec
+	for i := 0; i < len(delimiters); i++ {
+		if strings.IndexByte(".-+,/_=", delimiters[i]) < 0 {
+			return "", errInvalidMacro
+		}
+	}
+	if values == nil {
+		return "", nil
+	}
+
+	value := values(lower)
+	if keep > 0 || reverse || delimiters != "" {
+		if delimiters == "" {
+			delimiters = "."
+		}
+		parts := strings.FieldsFunc(value, func(r rune) bool { return strings.ContainsRune(delimiters, r) })
+		if reverse {
+			for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+				parts[i], parts[j] = parts[j], parts[i]
+			}
+		}
+		if keep > 0 && keep < len(parts) {
+			parts = parts[len(parts)-keep:]
+		}
+		value = strings.Join(parts, ".")
+	}
+	if letter != lower {
+		value = urlEscape(value)
+	}
+	return value, nil
+}
+
+// urlEscape 大写的宏字母按 URL 编码，只保留 unreserved 字符
+func urlEscape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("-._~", c) >= 0 {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// checkMacroString 检查 domain-spec 中宏的语法
+func checkMacroString(s string) error {
+	_, err := expandMacroString(s, nil, false)
+	return err
+}
+
+// ipMacroValue %{i} 的值：IPv4 为点分十进制，IPv6 为以点分隔的 32 个十六进制数字
+func ipMacroValue(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	nibbles := make([]string, 0, 32)
+	for _, b := range ip.To16() {
+		nibbles = append(nibbles, strconv.FormatInt(int64(b>>4), 16), strconv.FormatInt(int64(b&0xf), 16))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// truncateDomain 展开后超过 253 个字符的域名从左边去掉标签
+func truncateDomain(domain string) string {
+	domain = strings.TrimSuffix(domain, ".")
+	for len(domain) > 253 {
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return ""
+		}
+		domain = domain[dot+1:]
+	}
+	return domain
+}
@@ -0,0 +1,93 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+// isDotAtom 判断是否可以不加引号输出（RFC 5322 dot-atom）
+func isDotAtom(s string) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("!#$%&'*+-/=?^_`{|}~.", c) >= 0 {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func receivedSPFValue(s string) string {
+	if isDotAtom(s) {
+		return s
+	}
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(s) + "\""
+}
+
+// ReceivedSPF 生成 Received-SPF 头部的值（RFC 7208 9.1），如
+// pass (mx.example.org: domain of alice@example.com designates 192.0.2.1 as permitted sender) client-ip=192.0.2.1; ...
+func (r *Result) ReceivedSPF() string {
+	ip := r.ClientIP.String()
+	var comment string
+	switch r.Status {
+	case StatusPass:
+		comment = "domain of " + r.Sender + " designates " + ip + " as permitted sender"
+	case StatusFail:
+		comment = "domain of " + r.Sender + " does not designate " + ip + " as permitted sender"
+	case StatusSoftFail:
+		comment = "domain of transitioning " + r.Sender + " does not designate " + ip + " as permitted sender"
+	case StatusNeutral:
+		comment = ip + " is neither permitted nor denied by domain of " + r.Sender
+	case StatusNone:
+		comment = "domain of " + r.Sender + " does not provide an SPF record"
+	default:
+		comment = "error in processing during lookup of " + r.Sender + ": " + r.Reason
+	}
+	if r.Receiver != "" {
+		comment = r.Receiver + ": " + comment
+	}
+	comment = strings.NewReplacer("\\", "\\\\", "(", "\\(", ")", "\\)").Replace(comment)
+
+	var sb strings.Builder
+	sb.WriteString(string(r.Status) + " (" + comment + ")")
+	sb.WriteString(" client-ip=" + receivedSPFValue(ip) + ";")
+	sb.WriteString(" envelope-from=" + receivedSPFValue(r.Sender) + ";")
+	if r.Helo != "" {
+		sb.WriteString(" helo=" + receivedSPFValue(r.Helo) + ";")
+	}
+	if r.Receiver != "" {
+		sb.WriteString(" receiver=" + receivedSPFValue(r.Receiver) + ";")
+	}
+	sb.WriteString(" identity=" + r.Identity + ";")
+	if r.Mechanism != "" {
+		sb.WriteString(" mechanism=" + receivedSPFValue(r.Mechanism) + ";")
+	}
+	if r.Reason != "" && (r.Status == StatusTempError || r.Status == StatusPermError) {
+		sb.WriteString(" problem=" + receivedSPFValue(r.Reason) + ";")
+	}
+	return sb.String()
+}
+
+// CheckParser 使用已解析邮件中的信息检查 MAIL FROM 身份：
+// 客户端 IP 和 HELO 取自最近一跳（最上面的）Received 头部，MAIL FROM 取自 Return-Path；用于离线重新评估
+func CheckParser(parser *emailparser.EmailParser, options CheckOptions) (*Result, error) {
+	hops := parser.GetReceivedHops()
+	if len(hops) == 0 {
+		return nil, errors.New("no Received header")
+	}
+	hop := hops[len(hops)-1]
+	ip := net.ParseIP(hop.FromIP)
+	if ip == nil {
+		return nil, errors.New("no client IP in Received header")
+	}
+	helo := strings.Trim(hop.FromHost, "[]")
+	returnPath := parser.GetTopMIMENode().GetHeaderValueIgnoreNotFound("RETURN-PATH")
+	mailFrom := emailparser.ParseMimeAddressFirstOne(returnPath, parser.DefaultCharset).Email
+	return Check(ip, helo, mailFrom, options), nil
+}
@@ -0,0 +1,212 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Directive 一个 [qualifier]mechanism[:domain-spec][/cidr] 指令
+type Directive struct {
+	Qualifier byte   // '+'、'-'、'~'、'?'
+	Mechanism string // all、include、a、mx、ptr、ip4、ip6、exists
+	Domain    string // 未展开的 domain-spec，为空表示当前域名
+	CIDR4     int
+	CIDR6     int
+	Network   *net.IPNet // ip4、ip6 的地址段
+	Text      string     // 原始文本
+}
+
+// Record 解析后的 SPF 记录
+type Record struct {
+	Directives  []*Directive
+	Redirect    string // redirect= 的 domain-spec
+	Explanation string // exp= 的 domain-spec
+}
+
+// isSPFRecord 判断 TXT 记录是否为 SPF 记录（以 "v=spf1" 开头，其后为空格或结尾）
+func isSPFRecord(txt string) bool {
+	if len(txt) < 6 || !strings.EqualFold(txt[:6], "v=spf1") {
+		return false
+	}
+	return len(txt) == 6 || txt[6] == ' '
+}
+
+// isModifierName 判断是否为合法的修饰符名称：ALPHA *( ALPHA / DIGIT / "-" / "_" / "." )
+func isModifierName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		alpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !alpha && (i == 0 || !((c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.')) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// splitCIDR 从 domain-spec 的结尾取出 /cidr4 和 //cidr6（跳过宏中的 /）
+func splitCIDR(s string) (string, string) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				return s[:i], s[i:]
+			}
+		}
+	}
+	return s, ""
+}
+
+// parseCIDR 解析 "/n"、"//n" 或 "/n//m"
+func parseCIDR(s string, d *Directive, allow6 bool) error {
+	parse := func(v string, max int) (int, error) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > max || (len(v) > 1 && v[0] == '0') {
+			return 0, fmt.Errorf("invalid cidr length %q", v)
+		}
+		return n, nil
+	}
+	var err error
+	v4, v6, dual := strings.Cut(s, "//")
+	if dual && !allow6 {
+		return fmt.Errorf("invalid cidr %q", s)
+	}
+	if v4 != "" {
+		if !strings.HasPrefix(v4, "/") {
+			return fmt.Errorf("invalid cidr %q", s)
+		}
+		if d.CIDR4, err = parse(v4[1:], 32); err != nil {
+			return err
+		}
+	}
+	if dual {
+		if d.CIDR6, err = parse(v6, 128); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDirective 解析一个指令
+func parseDirective(term string) (*Directive, error) {
+	d := &Directive{Qualifier: '+', CIDR4: 32, CIDR6: 128, Text: term}
+	if strings.IndexByte("+-~?", term[0]) >= 0 {
+		d.Qualifier = term[0]
+		term = term[1:]
+	}
+	end := strings.IndexAny(term, ":/")
+	if end < 0 {
+		end = len(term)
+	}
+	d.Mechanism = strings.ToLower(term[:end])
+	arg := term[end:]
+	domain, cidr := "", ""
+	if strings.HasPrefix(arg, ":") {
+		domain, cidr = splitCIDR(arg[1:])
+		if domain == "" {
+			return nil, fmt.Errorf("empty argument in %q", d.Text)
+		}
+	} else {
+		cidr = arg
+	}
+
+	switch d.Mechanism {
+	case "all":
+		if arg != "" {
+			return nil, fmt.Errorf("unexpected argument in %q", d.Text)
+		}
+	case "include", "exists":
+		if domain == "" || cidr != "" {
+			return nil, fmt.Errorf("invalid %q", d.Text)
+		}
+	case "a", "mx":
+		if err := parseCIDR(cidr, d, true); err != nil {
+			return nil, err
+		}
+	case "ptr":
+		if cidr != "" {
+			return nil, fmt.Errorf("unexpected cidr in %q", d.Text)
+		}
+	case "ip4", "ip6":
+		// ip6 的地址中含有冒号，不能按 domain-spec 切分
+		addr, length, hasLength := strings.Cut(strings.TrimPrefix(arg, ":"), "/")
+		ip := net.ParseIP(addr)
+		if !strings.HasPrefix(arg, ":") || ip == nil || strings.Contains(addr, ":") == (d.Mechanism == "ip4") {
+			return nil, fmt.Errorf("invalid address in %q", d.Text)
+		}
+		bits := 128
+		ip = ip.To16()
+		if d.Mechanism == "ip4" {
+			bits = 32
+			ip = ip.To4()
+		}
+		ones := bits
+		if hasLength {
+			n, err := strconv.Atoi(length)
+			if err != nil || n < 0 || n > bits || (len(length) > 1 && length[0] == '0') {
+				return nil, fmt.Errorf("invalid cidr length in %q", d.Text)
+			}
+			ones = n
+		}
+		mask := net.CIDRMask(ones, bits)
+		d.Network = &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("unknown mechanism %q", d.Text)
+	}
+	if domain != "" {
+		if err := checkMacroString(domain); err != nil {
+			return nil, err
+		}
+	}
+	d.Domain = domain
+	return d, nil
+}
+
+// ParseRecord 解析 SPF 记录，语法错误时返回错误（检查结果为 permerror）
+func ParseRecord(txt string) (*Record, error) {
+	if !isSPFRecord(txt) {
+		return nil, fmt.Errorf("not an SPF record")
+	}
+	record := &Record{}
+	hasRedirect, hasExp := false, false
+	for _, term := range strings.Fields(txt[6:]) {
+		if eq := strings.IndexByte(term, '='); eq > 0 && !strings.ContainsAny(term[:eq], ":/") {
+			name, value := strings.ToLower(term[:eq]), term[eq+1:]
+			if !isModifierName(name) {
+				return nil, fmt.Errorf("invalid modifier %q", term)
+			}
+			if err := checkMacroString(value); err != nil {
+				return nil, err
+			}
+			switch name {
+			case "redirect":
+				if hasRedirect || value == "" {
+					return nil, fmt.Errorf("invalid redirect modifier %q", term)
+				}
+				hasRedirect = true
+				record.Redirect = value
+			case "exp":
+				if hasExp || value == "" {
+					return nil, fmt.Errorf("invalid exp modifier %q", term)
+				}
+				hasExp = true
+				record.Explanation = value
+			}
+			// 未知的修饰符被忽略
+			continue
+		}
+		d, err := parseDirective(term)
+		if err != nil {
+			return nil, err
+		}
+		record.Directives = append(record.Directives, d)
+	}
+	return record, nil
+}
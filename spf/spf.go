@@ -0,0 +1,233 @@
+// Package spf 实现 SPF 检查（RFC 7208），DNS 查询通过 Resolver 接口完成
+package spf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("dns record not found")
+
+// Resolver SPF 需要的 DNS 查询；域名不存在或没有对应类型的记录时应返回 ErrNotFound，其它错误视为临时错误
+type Resolver interface {
+	LookupTXT(name string) ([]string, error)
+	LookupIP(network string, name string) ([]net.IP, error) // network 为 "ip4"（A）或 "ip6"（AAAA）
+	LookupMX(name string) ([]string, error)                 // 返回按优先级排列的主机名
+	LookupAddr(ip string) ([]string, error)                 // PTR
+}
+
+// MapResolver 使用内存中的区域数据，用于测试和离线重新评估，键为小写域名（PTR 的键为 IP 地址）
+type MapResolver struct {
+	TXT    map[string][]string
+	A      map[string][]string // A 和 AAAA 记录
+	MX     map[string][]string
+	PTR    map[string][]string
+	Errors map[string]error // 查询这些域名时返回的错误，用于模拟临时错误
+}
+
+func mapResolverKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func (m MapResolver) lookup(records map[string][]string, name string) ([]string, error) {
+	name = mapResolverKey(name)
+	if err := m.Errors[name]; err != nil {
+		return nil, err
+	}
+	values, ok := records[name]
+	if !ok || len(values) == 0 {
+		return nil, ErrNotFound
+	}
+	return values, nil
+}
+
+func (m MapResolver) LookupTXT(name string) ([]string, error) {
+	return m.lookup(m.TXT, name)
+}
+
+func (m MapResolver) LookupIP(network string, name string) ([]net.IP, error) {
+	values, err := m.lookup(m.A, name)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, value := range values {
+		ip := net.ParseIP(value)
+		if ip == nil || (ip.To4() != nil) != (network == "ip4") {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	if len(ips) == 0 {
+		return nil, ErrNotFound
+	}
+	return ips, nil
+}
+
+func (m MapResolver) LookupMX(name string) ([]string, error) {
+	return m.lookup(m.MX, name)
+}
+
+func (m MapResolver) LookupAddr(ip string) ([]string, error) {
+	return m.lookup(m.PTR, ip)
+}
+
+// DNSResolver 使用系统 DNS 查询
+type DNSResolver struct {
+	Resolver *net.Resolver // 为nil时使用 net.DefaultResolver
+}
+
+func (r DNSResolver) resolver() *net.Resolver {
+	if r.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return r.Resolver
+}
+
+// dnsError 将“不存在”转换为 ErrNotFound
+func dnsError(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r DNSResolver) LookupTXT(name string) ([]string, error) {
+	records, err := r.resolver().LookupTXT(context.Background(), name)
+	return records, dnsError(err)
+}
+
+func (r DNSResolver) LookupIP(network string, name string) ([]net.IP, error) {
+	ips, err := r.resolver().LookupIP(context.Background(), network, name)
+	return ips, dnsError(err)
+}
+
+func (r DNSResolver) LookupMX(name string) ([]string, error) {
+	records, err := r.resolver().LookupMX(context.Background(), name)
+	if err != nil {
+		return nil, dnsError(err)
+	}
+	hosts := make([]string, 0, len(records))
+	for _, mx := range records {
+		hosts = append(hosts, strings.TrimSuffix(mx.Host, "."))
+	}
+	return hosts, nil
+}
+
+func (r DNSResolver) LookupAddr(ip string) ([]string, error) {
+	names, err := r.resolver().LookupAddr(context.Background(), ip)
+	if err != nil {
+		return nil, dnsError(err)
+	}
+	for i := range names {
+		names[i] = strings.TrimSuffix(names[i], ".")
+	}
+	return names, nil
+}
+
+// Status 检查结果（RFC 7208 2.6）
+type Status string
+
+const (
+	StatusNone      Status = "none"
+	StatusNeutral   Status = "neutral"
+	StatusPass      Status = "pass"
+	StatusFail      Status = "fail"
+	StatusSoftFail  Status = "softfail"
+	StatusTempError Status = "temperror"
+	StatusPermError Status = "permerror"
+)
+
+// Result 检查结果
+type Result struct {
+	Status      Status
+	Reason      string // temperror、permerror 的原因
+	Mechanism   string // 匹配的机制（如 "-all"、"include:_spf.example.com"），使用缺省结果时为空
+	Explanation string // fail 时 exp= 给出的说明
+	Identity    string // "mailfrom" 或 "helo"
+	Domain      string // 被检查的域名
+	Sender      string // 用于检查的发件地址，MAIL FROM 为空时为 postmaster@HELO
+	ClientIP    net.IP
+	Helo        string
+	Receiver    string
+}
+
+// CheckOptions 检查参数
+type CheckOptions struct {
+	Resolver       Resolver  // 为nil时使用 DNSResolver
+	MaxLookups     int       // 引起 DNS 查询的机制和修饰符的上限，0 表示 10
+	MaxVoidLookups int       // 空结果查询的上限，0 表示 2
+	Receiver       string    // 检查方的主机名，用于 %{r} 和 Received-SPF，为空表示 unknown
+	CurrentTime    time.Time // %{t} 的时间，零值表示当前时间
+}
+
+func (o *CheckOptions) setDefaults() {
+	if o.Resolver == nil {
+		o.Resolver = DNSResolver{}
+	}
+	if o.MaxLookups == 0 {
+		o.MaxLookups = 10
+	}
+	if o.MaxVoidLookups == 0 {
+		o.MaxVoidLookups = 2
+	}
+	if o.CurrentTime.IsZero() {
+		o.CurrentTime = time.Now()
+	}
+}
+
+// splitSender 拆分发件地址，没有 local-part 时使用 postmaster
+func splitSender(sender string) (string, string) {
+	at := strings.LastIndexByte(sender, '@')
+	if at < 0 {
+		return "postmaster", sender
+	}
+	local := sender[:at]
+	if local == "" {
+		local = "postmaster"
+	}
+	return local, sender[at+1:]
+}
+
+// Check 检查 MAIL FROM 身份；MAIL FROM 为空（退信）时检查 postmaster@HELO
+func Check(ip net.IP, helo string, mailFrom string, options CheckOptions) *Result {
+	sender := strings.Trim(mailFrom, "<>")
+	if sender == "" {
+		sender = "postmaster@" + helo
+	}
+	return check(ip, helo, sender, "mailfrom", options)
+}
+
+// CheckHELO 检查 HELO 身份
+func CheckHELO(ip net.IP, helo string, options CheckOptions) *Result {
+	return check(ip, helo, "postmaster@"+helo, "helo", options)
+}
+
+func check(ip net.IP, helo string, sender string, identity string, options CheckOptions) *Result {
+	options.setDefaults()
+	local, domain := splitSender(sender)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	c := &checker{
+		options:  &options,
+		ip:       ip,
+		helo:     helo,
+		sender:   local + "@" + domain,
+		local:    local,
+		domain:   domain,
+		identity: identity,
+	}
+	result := c.checkHost(domain)
+	result.Identity = identity
+	result.Domain = domain
+	result.Sender = sender
+	result.ClientIP = ip
+	result.Helo = helo
+	result.Receiver = options.Receiver
+	return result
+}
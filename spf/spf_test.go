@@ -0,0 +1,153 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mailhonor/go-email/emailparser"
+)
+
+var testResolver = MapResolver{
+	TXT: map[string][]string{
+		"example.com":          {"v=spf1 ip4:192.0.2.0/24 include:_spf.example.net a:mail.example.com/32 mx -all exp=explain.example.com", "google-site-verification=x"},
+		"_spf.example.net":     {"v=spf1 ip6:2001:db8::/32 ~all"},
+		"explain.example.com":  {"%{i} is not one of %{d}'s designated mail servers (%{s}, %{r})"},
+		"soft.example.com":     {"v=spf1 ?ip4:198.51.100.1 redirect=_spf.example.net"},
+		"multi.example.com":    {"v=spf1 -all", "v=spf1 +all"},
+		"syntax.example.com":   {"v=spf1 ip4:300.1.1.1 -all"},
+		"loop.example.com":     {"v=spf1 include:loop.example.com -all"},
+		"void.example.com":     {"v=spf1 a:a.none.example a:b.none.example a:c.none.example -all"},
+		"temp.example.com":     {"v=spf1 include:broken.example.com -all"},
+		"ptr.example.com":      {"v=spf1 ptr exists:%{ir}.%{v}.bl.example.com -all"},
+		"redirect.example.com": {"v=spf1 redirect=norecord.example.com"},
+		"helo.example.com":     {"v=spf1 a -all"},
+		"empty.example.com":    {"v=spf1"},
+	},
+	A: map[string][]string{
+		"mail.example.com":                    {"203.0.113.5"},
+		"mx1.example.com":                     {"203.0.113.10", "2001:db9::10"},
+		"host.ptr.example.com":                {"198.51.100.7"},
+		"7.100.51.198.in-addr.bl.example.com": {"127.0.0.2"},
+		"helo.example.com":                    {"198.51.100.9"},
+	},
+	MX: map[string][]string{
+		"example.com": {"mx1.example.com"},
+	},
+	PTR: map[string][]string{
+		"198.51.100.7": {"host.ptr.example.com.", "fake.example.org"},
+	},
+	Errors: map[string]error{
+		"broken.example.com": errors.New("SERVFAIL"),
+	},
+}
+
+func TestCheck(t *testing.T) {
+	options := CheckOptions{Resolver: testResolver, Receiver: "mx.example.org"}
+	tests := []struct {
+		ip        string
+		mailFrom  string
+		status    Status
+		mechanism string
+	}{
+		{"192.0.2.10", "alice@example.com", StatusPass, "ip4:192.0.2.0/24"},
+		{"2001:db8::1", "alice@example.com", StatusPass, "include:_spf.example.net"},
+		{"203.0.113.5", "alice@example.com", StatusPass, "a:mail.example.com/32"},
+		{"2001:db9::10", "alice@example.com", StatusPass, "mx"},
+		{"::ffff:203.0.113.10", "alice@example.com", StatusPass, "mx"},
+		{"198.51.100.1", "alice@example.com", StatusFail, "-all"},
+		{"198.51.100.1", "bob@soft.example.com", StatusNeutral, "?ip4:198.51.100.1"},
+		{"198.51.100.2", "bob@soft.example.com", StatusSoftFail, "~all"},
+		{"198.51.100.2", "bob@none.example.com", StatusNone, ""},
+		{"198.51.100.2", "bob@empty.example.com", StatusNeutral, ""},
+		{"198.51.100.2", "bob@multi.example.com", StatusPermError, ""},
+		{"198.51.100.2", "bob@syntax.example.com", StatusPermError, ""},
+		{"198.51.100.2", "bob@loop.example.com", StatusPermError, ""},
+		{"198.51.100.2", "bob@void.example.com", StatusPermError, ""},
+		{"198.51.100.2", "bob@temp.example.com", StatusTempError, ""},
+		{"198.51.100.2", "bob@redirect.example.com", StatusPermError, ""},
+		{"198.51.100.7", "bob@ptr.example.com", StatusPass, "ptr"},
+		{"198.51.100.8", "bob@ptr.example.com", StatusFail, "-all"},
+		{"198.51.100.2", "bob@localhost", StatusNone, ""},
+	}
+	for _, test := range tests {
+		result := Check(net.ParseIP(test.ip), "helo.example.com", test.mailFrom, options)
+		if result.Status != test.status || result.Mechanism != test.mechanism {
+			t.Fatalf("%s %s: unexpected result %+v", test.ip, test.mailFrom, result)
+		}
+	}
+
+	result := Check(net.ParseIP("198.51.100.1"), "helo.example.com", "alice@example.com", options)
+	if result.Explanation != "198.51.100.1 is not one of example.com's designated mail servers (alice@example.com, mx.example.org)" {
+		t.Fatalf("unexpected explanation: %q", result.Explanation)
+	}
+	if result = Check(net.ParseIP("198.51.100.9"), "helo.example.com", "", options); result.Status != StatusPass || result.Sender != "postmaster@helo.example.com" {
+		t.Fatalf("unexpected null sender result: %+v", result)
+	}
+	if result = CheckHELO(net.ParseIP("198.51.100.1"), "helo.example.com", options); result.Status != StatusFail || result.Identity != "helo" {
+		t.Fatalf("unexpected HELO result: %+v", result)
+	}
+	header := Check(net.ParseIP("192.0.2.10"), "helo.example.com", "alice@example.com", options).ReceivedSPF()
+	if header != "pass (mx.example.org: domain of alice@example.com designates 192.0.2.10 as permitted sender)"+
+		" client-ip=192.0.2.10; envelope-from=\"alice@example.com\"; helo=helo.example.com; receiver=mx.example.org;"+
+		" identity=mailfrom; mechanism=\"ip4:192.0.2.0/24\";" {
+		t.Fatalf("unexpected Received-SPF: %s", header)
+	}
+}
+
+func TestMacro(t *testing.T) {
+	c := &checker{
+		options: &CheckOptions{CurrentTime: time.Unix(1000, 0)},
+		ip:      net.ParseIP("192.0.2.3").To4(),
+		sender:  "strong-bad@email.example.com",
+		local:   "strong-bad",
+		domain:  "email.example.com",
+	}
+	tests := map[string]string{
+		"%{s}":                  "strong-bad@email.example.com",
+		"%{o}":                  "email.example.com",
+		"%{d4}":                 "email.example.com",
+		"%{d2}":                 "example.com",
+		"%{dr}":                 "com.example.email",
+		"%{d2r}":                "example.email",
+		"%{l-}":                 "strong.bad",
+		"%{lr-}":                "bad.strong",
+		"%{l1r-}":               "strong",
+		"%{ir}.%{v}._spf.%{d2}": "3.2.0.192.in-addr._spf.example.com",
+		"%{lr-}.lp._spf.%{d2}":  "bad.strong.lp._spf.example.com",
+		"%{S}%%%_%-":            "strong-bad%40email.example.com% %20",
+	}
+	for spec, expected := range tests {
+		value, err := expandMacroString(spec, c.macroValues("email.example.com"), false)
+		if err != nil || value != expected {
+			t.Fatalf("%s: expected %q, got %q (%v)", spec, expected, value, err)
+		}
+	}
+	c.ip = net.ParseIP("2001:db8::cb01")
+	if value, _ := expandMacroString("%{ir}.%{v}._spf.%{d2}", c.macroValues("email.example.com"), false); value !=
+		"1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com" {
+		t.Fatalf("unexpected IPv6 expansion: %s", value)
+	}
+	for _, spec := range []string{"%{t}", "%{x}", "%{d0}", "%{d", "%a"} {
+		if err := checkMacroString(spec); err == nil {
+			t.Fatalf("%s: expected error", spec)
+		}
+	}
+}
+
+func TestCheckParser(t *testing.T) {
+	message := "Return-Path: <alice@example.com>\r\n" +
+		"Received: from mail.example.com (mail.example.com [203.0.113.5])\r\n" +
+		"\tby mx.example.org with ESMTP id 1; Mon, 02 Jan 2006 15:04:05 +0800\r\n" +
+		"Received: from [10.0.0.2] by mail.example.com; Mon, 02 Jan 2006 15:04:00 +0800\r\n" +
+		"Subject: test\r\n" +
+		"\r\n" +
+		"body\r\n"
+	parser := emailparser.EmailParserNew(emailparser.EmailParserOptions{EmailData: []byte(message)})
+	result, err := CheckParser(parser, CheckOptions{Resolver: testResolver})
+	if err != nil || result.Status != StatusPass || result.Helo != "mail.example.com" || !strings.HasPrefix(result.ReceivedSPF(), "pass (domain of alice@example.com") {
+		t.Fatalf("unexpected result: %+v %v", result, err)
+	}
+}
@@ -0,0 +1,180 @@
+package tnef
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MAPI 属性类型
+const (
+	PtUnspecified = 0x0000
+	PtNull        = 0x0001
+	PtI2          = 0x0002
+	PtLong        = 0x0003
+	PtR4          = 0x0004
+	PtDouble      = 0x0005
+	PtCurrency    = 0x0006
+	PtAppTime     = 0x0007
+	PtError       = 0x000A
+	PtBoolean     = 0x000B
+	PtObject      = 0x000D
+	PtI8          = 0x0014
+	PtString8     = 0x001E
+	PtUnicode     = 0x001F
+	PtSysTime     = 0x0040
+	PtClsid       = 0x0048
+	PtBinary      = 0x0102
+	PtMultiple    = 0x1000
+)
+
+// 常用 MAPI 属性ID
+const (
+	PidTagMessageClass       = 0x001A
+	PidTagSubject            = 0x0037
+	PidTagSenderName         = 0x0C1A
+	PidTagSenderEmailAddress = 0x0C1F
+	PidTagBody               = 0x1000
+	PidTagRtfCompressed      = 0x1009
+	PidTagBodyHTML           = 0x1013
+	PidTagInternetMessageID  = 0x1035
+	PidTagDisplayName        = 0x3001
+	PidTagAttachDataBinary   = 0x3701
+	PidTagAttachFilename     = 0x3704
+	PidTagAttachMethod       = 0x3705
+	PidTagAttachLongFilename = 0x3707
+	PidTagAttachMimeTag      = 0x370E
+	PidTagAttachContentID    = 0x3712
+	PidTagSenderSmtpAddress  = 0x5D01
+)
+
+// Property MAPI 属性
+type Property struct {
+	ID     uint16
+	Type   uint16   // 不含 PtMultiple 标志
+	Multi  bool     // 是否为多值属性
+	GUID   []byte   // 命名属性的 GUID（ID >= 0x8000 时有效）
+	Kind   uint32   // 命名属性类型：0 为数字ID，1 为字符串名
+	NameID uint32   // 命名属性的数字ID
+	Name   string   // 命名属性的字符串名
+	Values [][]byte // 属性值（原始字节）
+}
+
+// Named 是否为命名属性
+func (p *Property) Named() bool {
+	return p.ID >= 0x8000
+}
+
+func fixedPropertySize(t uint16) int {
+	switch t {
+	case PtUnspecified, PtNull, PtI2, PtLong, PtR4, PtError, PtBoolean:
+		return 4
+	case PtDouble, PtCurrency, PtAppTime, PtI8, PtSysTime:
+		return 8
+	case PtClsid:
+		return 16
+	}
+	return -1
+}
+
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+// DecodeProperties 解码 attMsgProps/attAttachment 中的 MAPI 属性列表
+func DecodeProperties(data []byte) ([]Property, error) {
+	r := &reader{data: data}
+	count, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	var props []Property
+	for i := uint32(0); i < count; i++ {
+		var p Property
+		t, err := r.uint16()
+		if err != nil {
+			return props, err
+		}
+		p.ID, err = r.uint16()
+		if err != nil {
+			return props, err
+		}
+		p.Multi = t&PtMultiple != 0
+		p.Type = t &^ PtMultiple
+
+		if p.Named() {
+			if p.GUID, err = r.bytes(16); err != nil {
+				return props, err
+			}
+			if p.Kind, err = r.uint32(); err != nil {
+				return props, err
+			}
+			if p.Kind == 0 {
+				if p.NameID, err = r.uint32(); err != nil {
+					return props, err
+				}
+			} else {
+				nameLen, err := r.uint32()
+				if err != nil {
+					return props, err
+				}
+				name, err := r.bytes(int(nameLen))
+				if err != nil {
+					return props, err
+				}
+				p.Name = decodeUTF16(name)
+				if _, err := r.bytes(pad4(int(nameLen))); err != nil {
+					return props, err
+				}
+			}
+		}
+
+		valueCount := uint32(1)
+		size := fixedPropertySize(p.Type)
+		if p.Multi || size < 0 {
+			// 变长类型即使是单值也带有数量字段
+			if valueCount, err = r.uint32(); err != nil {
+				return props, err
+			}
+		}
+		if uint64(valueCount) > uint64(r.left()) {
+			return props, ErrTruncated
+		}
+		for j := uint32(0); j < valueCount; j++ {
+			if size >= 0 {
+				v, err := r.bytes(size)
+				if err != nil {
+					return props, err
+				}
+				p.Values = append(p.Values, v)
+				continue
+			}
+			switch p.Type {
+			case PtString8, PtUnicode, PtBinary, PtObject:
+			default:
+				return props, fmt.Errorf("tnef: unsupported property type 0x%04X", p.Type)
+			}
+			length, err := r.uint32()
+			if err != nil {
+				return props, err
+			}
+			v, err := r.bytes(int(length))
+			if err != nil {
+				return props, err
+			}
+			if _, err := r.bytes(pad4(int(length))); err != nil {
+				return props, err
+			}
+			p.Values = append(p.Values, v)
+		}
+		props = append(props, p)
+	}
+	return props, nil
+}
+
+// Uint32 返回整数属性的值
+func (p *Property) Uint32() uint32 {
+	if len(p.Values) == 0 || len(p.Values[0]) < 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(p.Values[0])
+}
@@ -0,0 +1,87 @@
+package tnef
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 压缩 RTF 格式（MS-OXRTFCP）
+const (
+	rtfCompressed   = 0x75465A4C // "LZFu"
+	rtfUncompressed = 0x414C454D // "MELA"
+)
+
+const rtfPrebuf = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}" +
+	"{\\f0\\fnil \\froman \\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier" +
+	"{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+// ErrInvalidRTF 压缩 RTF 数据格式错误
+var ErrInvalidRTF = errors.New("tnef: invalid compressed rtf")
+
+// DecompressRTF 解压 PidTagRtfCompressed 属性中的 RTF 数据
+func DecompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, ErrInvalidRTF
+	}
+	compSize := binary.LittleEndian.Uint32(data[0:4])
+	rawSize := binary.LittleEndian.Uint32(data[4:8])
+	compType := binary.LittleEndian.Uint32(data[8:12])
+	src := data[16:]
+	// compSize 不含自身的4字节
+	if int64(compSize)-12 < int64(len(src)) && compSize >= 12 {
+		src = src[:compSize-12]
+	}
+
+	switch compType {
+	case rtfUncompressed:
+		if uint64(rawSize) < uint64(len(src)) {
+			src = src[:rawSize]
+		}
+		return src, nil
+	case rtfCompressed:
+	default:
+		return nil, ErrInvalidRTF
+	}
+
+	var dict [4096]byte
+	copy(dict[:], rtfPrebuf)
+	writePos := len(rtfPrebuf)
+	// rawSize 来自不可信的头部，预分配不超过压缩数据可能展开的长度（每2字节引用最多17字节），其余由 append 增长
+	capacity := uint64(rawSize)
+	if limit := uint64(len(src)) * 9; capacity > limit {
+		capacity = limit
+	}
+	out := make([]byte, 0, capacity)
+	pos := 0
+	for pos < len(src) {
+		control := src[pos]
+		pos++
+		for bit := 0; bit < 8 && pos < len(src); bit++ {
+			if control&(1<<bit) == 0 {
+				b := src[pos]
+				pos++
+				out = append(out, b)
+				dict[writePos] = b
+				writePos = (writePos + 1) % len(dict)
+				continue
+			}
+			if pos+1 >= len(src) {
+				return out, ErrInvalidRTF
+			}
+			ref := int(src[pos])<<8 | int(src[pos+1])
+			pos += 2
+			offset := ref >> 4
+			length := ref&0x0F + 2
+			if offset == writePos {
+				return out, nil
+			}
+			for i := 0; i < length; i++ {
+				b := dict[(offset+i)%len(dict)]
+				out = append(out, b)
+				dict[writePos] = b
+				writePos = (writePos + 1) % len(dict)
+			}
+		}
+	}
+	return out, nil
+}
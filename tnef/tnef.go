@@ -0,0 +1,374 @@
+// Package tnef 解析 TNEF（winmail.dat，APPLICATION/MS-TNEF）数据
+// 提取附件、正文（纯文本/HTML/RTF）以及常用 MAPI 属性
+package tnef
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	mailhonorcharsetutils "github.com/mailhonor/go-utils/charset"
+)
+
+// Signature TNEF 数据流的魔数
+const Signature = 0x223E9F78
+
+// TNEF 属性级别
+const (
+	LevelMessage    = 0x01
+	LevelAttachment = 0x02
+)
+
+// TNEF 属性ID（低16位）
+const (
+	AttFrom             = 0x8000
+	AttSubject          = 0x8004
+	AttDateSent         = 0x8005
+	AttDateRecd         = 0x8006
+	AttMessageClass     = 0x8008
+	AttMessageID        = 0x8009
+	AttBody             = 0x800C
+	AttAttachData       = 0x800F
+	AttAttachTitle      = 0x8010
+	AttAttachMetaFile   = 0x8011
+	AttAttachCreateDate = 0x8012
+	AttAttachModifyDate = 0x8013
+	AttAttachRenddata   = 0x9002
+	AttMsgProps         = 0x9003
+	AttAttachment       = 0x9005
+	AttOemCodepage      = 0x9007
+)
+
+// ErrInvalidSignature 数据不是 TNEF 格式
+var ErrInvalidSignature = errors.New("tnef: invalid signature")
+
+// ErrTruncated 数据被截断
+var ErrTruncated = errors.New("tnef: truncated data")
+
+// Attribute TNEF 原始属性
+type Attribute struct {
+	Level byte
+	ID    uint16 // 属性ID（低16位）
+	Type  uint16 // 属性类型（高16位）
+	Data  []byte
+}
+
+// Attachment TNEF 中的附件
+type Attachment struct {
+	Filename   string // 文件名（优先使用长文件名）
+	MimeType   string // 媒体类型（小写，如 application/pdf）
+	ContentID  string // 内容ID（用于内嵌资源）
+	Data       []byte
+	Properties []Property // 附件的 MAPI 属性
+}
+
+// Message TNEF 解码结果
+type Message struct {
+	Subject      string
+	MessageClass string // 如 IPM.Note、IPM.Microsoft Schedule.MtgReq
+	MessageID    string
+	SenderName   string
+	SenderEmail  string
+	Codepage     int    // attOemCodepage 中声明的代码页
+	Charset      string // 由代码页推导的字符集
+	Body         string // 纯文本正文（UTF-8）
+	BodyHTML     []byte // HTML 正文（按 Charset 编码）
+	BodyRTF      []byte // 解压后的 RTF 正文
+	Attachments  []*Attachment
+	Properties   []Property  // 邮件级 MAPI 属性
+	Attributes   []Attribute // 全部原始属性
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) left() int {
+	return len(r.data) - r.pos
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.left() < n {
+		return nil, ErrTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) uint16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (r *reader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// Decode 解码 TNEF 数据
+func Decode(data []byte) (*Message, error) {
+	r := &reader{data: data}
+	sig, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if sig != Signature {
+		return nil, ErrInvalidSignature
+	}
+	// legacy key
+	if _, err := r.uint16(); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{}
+	var attachment *Attachment
+	var attachTitle string
+	finishAttachment := func() {
+		if attachment == nil {
+			return
+		}
+		if attachment.Filename == "" {
+			attachment.Filename = attachTitle
+		}
+		if attachment.MimeType == "" {
+			attachment.MimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(attachment.Filename)))
+			if idx := strings.Index(attachment.MimeType, ";"); idx > 0 {
+				attachment.MimeType = attachment.MimeType[:idx]
+			}
+		}
+		if attachment.MimeType == "" {
+			attachment.MimeType = "application/octet-stream"
+		}
+		msg.Attachments = append(msg.Attachments, attachment)
+		attachment = nil
+		attachTitle = ""
+	}
+
+	for r.left() > 0 {
+		attr, err := readAttribute(r)
+		if err != nil {
+			return msg, err
+		}
+		msg.Attributes = append(msg.Attributes, attr)
+
+		switch attr.ID {
+		case AttOemCodepage:
+			if len(attr.Data) >= 4 {
+				msg.Codepage = int(binary.LittleEndian.Uint32(attr.Data))
+				msg.Charset = CodepageToCharset(msg.Codepage)
+			}
+		case AttSubject:
+			msg.Subject = msg.decodeString8(attr.Data)
+		case AttMessageClass:
+			msg.MessageClass = msg.decodeString8(attr.Data)
+		case AttMessageID:
+			msg.MessageID = msg.decodeString8(attr.Data)
+		case AttBody:
+			msg.Body = msg.decodeString8(attr.Data)
+		case AttMsgProps:
+			props, err := DecodeProperties(attr.Data)
+			if err != nil {
+				return msg, err
+			}
+			msg.Properties = append(msg.Properties, props...)
+			msg.applyProperties(props)
+		case AttAttachRenddata:
+			finishAttachment()
+			attachment = &Attachment{}
+		case AttAttachTitle:
+			if attachment != nil {
+				attachTitle = msg.decodeString8(attr.Data)
+			}
+		case AttAttachData:
+			if attachment != nil {
+				attachment.Data = attr.Data
+			}
+		case AttAttachment:
+			if attachment == nil {
+				continue
+			}
+			props, err := DecodeProperties(attr.Data)
+			if err != nil {
+				return msg, err
+			}
+			attachment.Properties = append(attachment.Properties, props...)
+			msg.applyAttachmentProperties(attachment, props)
+		}
+	}
+	finishAttachment()
+	return msg, nil
+}
+
+func readAttribute(r *reader) (Attribute, error) {
+	var attr Attribute
+	level, err := r.bytes(1)
+	if err != nil {
+		return attr, err
+	}
+	id, err := r.uint32()
+	if err != nil {
+		return attr, err
+	}
+	length, err := r.uint32()
+	if err != nil {
+		return attr, err
+	}
+	if uint64(length) > uint64(r.left()) {
+		return attr, ErrTruncated
+	}
+	data, err := r.bytes(int(length))
+	if err != nil {
+		return attr, err
+	}
+	// checksum，兼容不规范的数据，不做校验
+	if _, err := r.uint16(); err != nil {
+		return attr, err
+	}
+	attr.Level = level[0]
+	attr.ID = uint16(id & 0xFFFF)
+	attr.Type = uint16(id >> 16)
+	attr.Data = data
+	return attr, nil
+}
+
+// decodeString8 解码以 NUL 结尾的 8 位字符串
+func (m *Message) decodeString8(data []byte) string {
+	data = trimNul(data)
+	if m.Charset == "" {
+		return string(data)
+	}
+	return mailhonorcharsetutils.ConvertToUTF8(data, m.Charset, "UTF-8")
+}
+
+func (m *Message) propertyString(p *Property) string {
+	if len(p.Values) == 0 {
+		return ""
+	}
+	switch p.Type {
+	case PtUnicode:
+		return decodeUTF16(p.Values[0])
+	case PtString8:
+		return m.decodeString8(p.Values[0])
+	}
+	return ""
+}
+
+func (m *Message) applyProperties(props []Property) {
+	for i := range props {
+		p := &props[i]
+		if p.Named() || len(p.Values) == 0 {
+			continue
+		}
+		switch p.ID {
+		case PidTagSubject:
+			m.Subject = m.propertyString(p)
+		case PidTagMessageClass:
+			m.MessageClass = m.propertyString(p)
+		case PidTagInternetMessageID:
+			m.MessageID = m.propertyString(p)
+		case PidTagSenderName:
+			m.SenderName = m.propertyString(p)
+		case PidTagSenderEmailAddress:
+			m.SenderEmail = m.propertyString(p)
+		case PidTagSenderSmtpAddress:
+			if s := m.propertyString(p); s != "" {
+				m.SenderEmail = s
+			}
+		case PidTagBody:
+			m.Body = m.propertyString(p)
+		case PidTagBodyHTML:
+			if p.Type == PtUnicode {
+				m.BodyHTML = []byte(decodeUTF16(p.Values[0]))
+			} else {
+				m.BodyHTML = trimNul(p.Values[0])
+			}
+		case PidTagRtfCompressed:
+			rtf, err := DecompressRTF(p.Values[0])
+			if err == nil {
+				m.BodyRTF = rtf
+			}
+		}
+	}
+}
+
+func (m *Message) applyAttachmentProperties(a *Attachment, props []Property) {
+	for i := range props {
+		p := &props[i]
+		if p.Named() || len(p.Values) == 0 {
+			continue
+		}
+		switch p.ID {
+		case PidTagAttachLongFilename:
+			a.Filename = m.propertyString(p)
+		case PidTagDisplayName:
+			if a.Filename == "" {
+				a.Filename = m.propertyString(p)
+			}
+		case PidTagAttachMimeTag:
+			a.MimeType = strings.ToLower(strings.TrimSpace(m.propertyString(p)))
+		case PidTagAttachContentID:
+			a.ContentID = strings.Trim(m.propertyString(p), "<> ")
+		case PidTagAttachDataBinary:
+			if len(a.Data) == 0 && p.Type == PtBinary {
+				a.Data = p.Values[0]
+			}
+		}
+	}
+}
+
+// CodepageToCharset 将 Windows 代码页转换为字符集名称
+func CodepageToCharset(codepage int) string {
+	switch codepage {
+	case 0:
+		return ""
+	case 936:
+		return "GBK"
+	case 950:
+		return "BIG5"
+	case 932:
+		return "SHIFT_JIS"
+	case 949:
+		return "EUC-KR"
+	case 20127:
+		return "US-ASCII"
+	case 28591:
+		return "ISO-8859-1"
+	case 50220:
+		return "ISO-2022-JP"
+	case 54936:
+		return "GB18030"
+	case 65001:
+		return "UTF-8"
+	}
+	return fmt.Sprintf("WINDOWS-%d", codepage)
+}
+
+func trimNul(data []byte) []byte {
+	for len(data) > 0 && data[len(data)-1] == 0 {
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+func decodeUTF16(data []byte) string {
+	u := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		u = append(u, binary.LittleEndian.Uint16(data[i:]))
+	}
+	for len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,117 @@
+package tnef
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func testAttribute(level byte, id uint32, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(level)
+	binary.Write(&b, binary.LittleEndian, id)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	sum := uint16(0)
+	for _, c := range data {
+		sum += uint16(c)
+	}
+	binary.Write(&b, binary.LittleEndian, sum)
+	return b.Bytes()
+}
+
+func testStringProperty(t uint16, id uint16, value []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, t)
+	binary.Write(&b, binary.LittleEndian, id)
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+	b.Write(value)
+	b.Write(make([]byte, pad4(len(value))))
+	return b.Bytes()
+}
+
+func testProperties(props ...[]byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len(props)))
+	for _, p := range props {
+		b.Write(p)
+	}
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(Signature))
+	binary.Write(&b, binary.LittleEndian, uint16(0x0001))
+	b.Write(testAttribute(LevelMessage, 0x00069007, []byte{0xE9, 0xFD, 0x00, 0x00, 0, 0, 0, 0}))
+	b.Write(testAttribute(LevelMessage, 0x00078008, []byte("IPM.Note\x00")))
+	b.Write(testAttribute(LevelMessage, 0x00069003, testProperties(
+		testStringProperty(PtString8, PidTagSubject, []byte("hello\x00")),
+		testStringProperty(PtUnicode, PidTagSenderName, []byte("B\x00o\x00b\x00\x00\x00")),
+		testStringProperty(PtBinary, PidTagBodyHTML, []byte("<p>hi</p>")),
+	)))
+	b.Write(testAttribute(LevelAttachment, 0x00069002, make([]byte, 14)))
+	b.Write(testAttribute(LevelAttachment, 0x00018010, []byte("REPORT~1.PDF\x00")))
+	b.Write(testAttribute(LevelAttachment, 0x0006800F, []byte("%PDF-1.4")))
+	b.Write(testAttribute(LevelAttachment, 0x00069005, testProperties(
+		testStringProperty(PtString8, PidTagAttachLongFilename, []byte("report 2024.pdf\x00")),
+	)))
+	b.Write(testAttribute(LevelAttachment, 0x00069002, make([]byte, 14)))
+	b.Write(testAttribute(LevelAttachment, 0x00018010, []byte("a.txt\x00")))
+	b.Write(testAttribute(LevelAttachment, 0x0006800F, []byte("text")))
+
+	msg, err := Decode(b.Bytes())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if msg.Subject != "hello" || msg.MessageClass != "IPM.Note" || msg.SenderName != "Bob" || msg.Charset != "UTF-8" {
+		t.Fatalf("unexpected message properties: %+v", msg)
+	}
+	if string(msg.BodyHTML) != "<p>hi</p>" {
+		t.Fatalf("unexpected html body: %q", msg.BodyHTML)
+	}
+	if len(msg.Attachments) != 2 {
+		t.Fatalf("unexpected attachment count: %d", len(msg.Attachments))
+	}
+	a := msg.Attachments[0]
+	if a.Filename != "report 2024.pdf" || a.MimeType != "application/pdf" || string(a.Data) != "%PDF-1.4" {
+		t.Fatalf("unexpected attachment: %+v", a)
+	}
+	if msg.Attachments[1].Filename != "a.txt" || msg.Attachments[1].MimeType != "text/plain" {
+		t.Fatalf("unexpected attachment: %+v", msg.Attachments[1])
+	}
+
+	if _, err := Decode([]byte("not tnef data")); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestDecompressRTF(t *testing.T) {
+	// MS-OXRTFCP 3.1.1 示例
+	data := []byte{
+		0x2d, 0x00, 0x00, 0x00, 0x2b, 0x00, 0x00, 0x00, 0x4c, 0x5a, 0x46, 0x75, 0xf1, 0xc5, 0xc7, 0xa7,
+		0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42, 0x32, 0x0a, 0xf3, 0x20,
+		0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77, 0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f,
+		0xa0,
+	}
+	rtf, err := DecompressRTF(data)
+	if err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if string(rtf) != "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n" {
+		t.Fatalf("unexpected rtf: %q", rtf)
+	}
+}
+
+func TestDecompressRTFMalformedHeader(t *testing.T) {
+	// rawSize 为 0xFFFFFFF0 的20字节数据不应按 rawSize 预分配
+	data := []byte{
+		0x10, 0x00, 0x00, 0x00, 0xf0, 0xff, 0xff, 0xff, 0x4c, 0x5a, 0x46, 0x75, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x61, 0x62, 0x63,
+	}
+	rtf, err := DecompressRTF(data)
+	if err != nil || string(rtf) != "abc" || cap(rtf) > 9*len(data) {
+		t.Fatalf("unexpected result: %q, cap %d, %v", rtf, cap(rtf), err)
+	}
+}